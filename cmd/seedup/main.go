@@ -1,16 +1,7 @@
 package main
 
-import (
-	"fmt"
-	"os"
-
-	"github.com/tmwinc/seedup/internal/cli"
-)
+import "github.com/tmwinc/seedup"
 
 func main() {
-	rootCmd := cli.NewRootCmd()
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
-	}
+	seedup.Main(nil)
 }
@@ -1,11 +1,9 @@
 package cli
 
 import (
-	"context"
 	"fmt"
 
 	"github.com/tmwinc/seedup/pkg/check"
-	"github.com/tmwinc/seedup/pkg/executor"
 	"github.com/spf13/cobra"
 )
 
@@ -24,10 +22,10 @@ This command is intended for use in CI pipelines.`,
 				return fmt.Errorf("not in a git repository")
 			}
 
-			exec := executor.New(executor.WithVerbose(verbose))
+			exec := newExecutor()
 			c := check.New(exec)
 
-			return c.Check(context.Background(), getMigrationsDir(), baseBranch)
+			return c.Check(cmd.Context(), getMigrationsDir(), baseBranch)
 		},
 	}
 
@@ -6,10 +6,11 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/tmwinc/seedup/pkg/db"
-	"github.com/tmwinc/seedup/pkg/executor"
+	"github.com/tmwinc/seedup/pkg/events"
 )
 
 var adminURL string
@@ -27,6 +28,7 @@ func newDBCmd() *cobra.Command {
 	cmd.AddCommand(newDBDropCmd())
 	cmd.AddCommand(newDBCreateCmd())
 	cmd.AddCommand(newDBSetupCmd())
+	cmd.AddCommand(newDBWaitCmd())
 
 	return cmd
 }
@@ -49,21 +51,21 @@ func newDBDropCmd() *cobra.Command {
 				return err
 			}
 
-			if !force {
-				if !confirmAction(fmt.Sprintf("Drop database '%s'?", cfg.Database)) {
+			if !force && !plan {
+				if !confirmAction(cmd.Context(), fmt.Sprintf("Drop database '%s'?", cfg.Database)) {
 					fmt.Println("Aborted.")
 					return nil
 				}
 			}
 
-			exec := executor.New(executor.WithVerbose(verbose))
+			exec := newExecutor()
 			m := db.New(exec)
 
-			if err := m.Drop(context.Background(), dbURL, adminURL); err != nil {
+			if err := m.Drop(cmd.Context(), dbURL, adminURL); err != nil {
 				return err
 			}
 
-			fmt.Printf("Database '%s' dropped successfully.\n", cfg.Database)
+			events.FromContext(cmd.Context()).Info("db-drop", fmt.Sprintf("Database '%s' dropped successfully.", cfg.Database))
 			return nil
 		},
 	}
@@ -88,14 +90,14 @@ func newDBCreateCmd() *cobra.Command {
 				return err
 			}
 
-			exec := executor.New(executor.WithVerbose(verbose))
+			exec := newExecutor()
 			m := db.New(exec)
 
-			if err := m.Create(context.Background(), dbURL, adminURL); err != nil {
+			if err := m.Create(cmd.Context(), dbURL, adminURL); err != nil {
 				return err
 			}
 
-			fmt.Printf("Database '%s' created successfully.\n", cfg.Database)
+			events.FromContext(cmd.Context()).Info("db-create", fmt.Sprintf("Database '%s' created successfully.", cfg.Database))
 			return nil
 		},
 	}
@@ -127,14 +129,14 @@ This is a destructive operation that will drop and recreate the database.`,
 				return err
 			}
 
-			if !force {
-				if !confirmAction(fmt.Sprintf("This will DROP and recreate database '%s'. Continue?", cfg.Database)) {
+			if !force && !plan {
+				if !confirmAction(cmd.Context(), fmt.Sprintf("This will DROP and recreate database '%s'. Continue?", cfg.Database)) {
 					fmt.Println("Aborted.")
 					return nil
 				}
 			}
 
-			exec := executor.New(executor.WithVerbose(verbose))
+			exec := newExecutor()
 			m := db.New(exec)
 
 			opts := db.SetupOptions{
@@ -146,11 +148,11 @@ This is a destructive operation that will drop and recreate the database.`,
 				SkipSeed:      skipSeed,
 			}
 
-			if err := m.Setup(context.Background(), opts); err != nil {
+			if err := m.Setup(cmd.Context(), opts); err != nil {
 				return err
 			}
 
-			fmt.Println("Database setup completed successfully.")
+			events.FromContext(cmd.Context()).Info("db-setup", "Database setup completed successfully.")
 			return nil
 		},
 	}
@@ -161,10 +163,65 @@ This is a destructive operation that will drop and recreate the database.`,
 	return cmd
 }
 
-func confirmAction(prompt string) bool {
+// defaultWaitTimeout bounds db wait when --timeout is not set
+const defaultWaitTimeout = 30 * time.Second
+
+func newDBWaitCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "wait",
+		Short: "Wait until the database accepts connections",
+		Long: `Wait until the database specified in DATABASE_URL accepts connections.
+
+Connection refused, "the database system is starting up" and "too many connections"
+errors are retried until --timeout expires (30s if unset); any other error fails immediately.
+Useful in docker-compose entrypoints and CI before running migrations.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dbURL := getDatabaseURL()
+			if dbURL == "" {
+				return fmt.Errorf("database URL required (use -d flag or DATABASE_URL env)")
+			}
+
+			// Wait retries until its deadline itself, regardless of --retry-attempts
+			exec := buildExecutor(false)
+			m := db.New(exec)
+
+			ctx := cmd.Context()
+			if timeout == 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeoutCause(ctx, defaultWaitTimeout,
+					fmt.Errorf("timed out after %s", defaultWaitTimeout))
+				defer cancel()
+			}
+
+			if err := m.Wait(ctx, dbURL); err != nil {
+				return err
+			}
+
+			events.FromContext(cmd.Context()).Info("db-wait", "Database is ready.")
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// confirmAction prompts for a yes/no answer; an interrupt counts as "no"
+func confirmAction(ctx context.Context, prompt string) bool {
 	fmt.Printf("%s [y/N]: ", prompt)
-	reader := bufio.NewReader(os.Stdin)
-	response, _ := reader.ReadString('\n')
-	response = strings.ToLower(strings.TrimSpace(response))
-	return response == "y" || response == "yes"
+
+	answer := make(chan string, 1)
+	go func() {
+		reader := bufio.NewReader(os.Stdin)
+		response, _ := reader.ReadString('\n')
+		answer <- response
+	}()
+
+	select {
+	case <-ctx.Done():
+		fmt.Println()
+		return false
+	case response := <-answer:
+		response = strings.ToLower(strings.TrimSpace(response))
+		return response == "y" || response == "yes"
+	}
 }
@@ -1,13 +1,11 @@
 package cli
 
 import (
-	"context"
 	"fmt"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/tmwinc/seedup/pkg/dbml"
-	"github.com/tmwinc/seedup/pkg/executor"
 )
 
 func newDBMLCmd() *cobra.Command {
@@ -37,7 +35,7 @@ Examples:
 				return fmt.Errorf("database URL required (use -d flag or DATABASE_URL env)")
 			}
 
-			exec := executor.New(executor.WithVerbose(verbose))
+			exec := newExecutor()
 			gen := dbml.New(exec)
 
 			opts := dbml.Options{
@@ -51,7 +49,7 @@ Examples:
 				opts.ExcludeTables = strings.Split(excludeTables, ",")
 			}
 
-			return gen.Generate(context.Background(), dbURL, opts)
+			return gen.Generate(cmd.Context(), dbURL, opts)
 		},
 	}
 
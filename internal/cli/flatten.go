@@ -1,10 +1,9 @@
 package cli
 
 import (
-	"context"
 	"fmt"
 
-	"github.com/tmwinc/seedup/pkg/executor"
+	"github.com/tmwinc/seedup/pkg/events"
 	"github.com/tmwinc/seedup/pkg/migrate"
 	"github.com/spf13/cobra"
 )
@@ -26,15 +25,16 @@ This is useful for:
 				return fmt.Errorf("database URL required (use -d flag or DATABASE_URL env)")
 			}
 
-			exec := executor.New(executor.WithVerbose(verbose))
+			exec := newExecutor()
 			f := migrate.NewFlattener(exec)
 
-			fmt.Println("Flattening migrations...")
-			if err := f.Flatten(context.Background(), dbURL, getMigrationsDir()); err != nil {
+			log := events.FromContext(cmd.Context())
+			log.Info("flatten", "Flattening migrations...")
+			if err := f.Flatten(cmd.Context(), dbURL, getMigrationsDir()); err != nil {
 				return err
 			}
 
-			fmt.Println("Migrations flattened successfully")
+			log.Info("flatten", "Migrations flattened successfully")
 			return nil
 		},
 	}
@@ -1,12 +1,20 @@
 package cli
 
 import (
-	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	osexec "os/exec"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 
-	"github.com/tmwinc/seedup/pkg/executor"
+	"github.com/tmwinc/seedup/pkg/db"
+	"github.com/tmwinc/seedup/pkg/events"
 	"github.com/tmwinc/seedup/pkg/migrate"
+	"github.com/tmwinc/seedup/pkg/schema"
 	"github.com/spf13/cobra"
 )
 
@@ -14,13 +22,25 @@ func newMigrateCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "migrate",
 		Short: "Database migration commands",
-		Long:  "Commands for managing database migrations using goose",
+		Long:  "Commands for managing database migrations in goose format",
 	}
 
 	cmd.AddCommand(newMigrateUpCmd())
 	cmd.AddCommand(newMigrateUpByOneCmd())
+	cmd.AddCommand(newMigrateUpToCmd())
 	cmd.AddCommand(newMigrateDownCmd())
+	cmd.AddCommand(newMigrateDownToCmd())
+	cmd.AddCommand(newMigrateRedoCmd())
+	cmd.AddCommand(newMigrateResetCmd())
+	cmd.AddCommand(newMigrateVersionCmd())
 	cmd.AddCommand(newMigrateStatusCmd())
+	cmd.AddCommand(newMigrateVerifyCmd())
+	cmd.AddCommand(newMigrateLintCmd())
+	cmd.AddCommand(newMigrateTestCmd())
+	cmd.AddCommand(newMigrateDriftCmd())
+	cmd.AddCommand(newMigrateDiffCmd())
+	cmd.AddCommand(newMigrateDataCmd())
+	cmd.AddCommand(newMigrateBaselineCmd())
 	cmd.AddCommand(newMigrateCreateCmd())
 
 	return cmd
@@ -36,10 +56,10 @@ func newMigrateUpCmd() *cobra.Command {
 				return fmt.Errorf("database URL required (use -d flag or DATABASE_URL env)")
 			}
 
-			exec := executor.New(executor.WithVerbose(verbose))
+			exec := newExecutor()
 			m := migrate.New(exec)
 
-			return m.Up(context.Background(), dbURL, getMigrationsDir())
+			return m.Up(cmd.Context(), dbURL, getMigrationsDir())
 		},
 	}
 }
@@ -54,10 +74,10 @@ func newMigrateUpByOneCmd() *cobra.Command {
 				return fmt.Errorf("database URL required (use -d flag or DATABASE_URL env)")
 			}
 
-			exec := executor.New(executor.WithVerbose(verbose))
+			exec := newExecutor()
 			m := migrate.New(exec)
 
-			return m.UpByOne(context.Background(), dbURL, getMigrationsDir())
+			return m.UpByOne(cmd.Context(), dbURL, getMigrationsDir())
 		},
 	}
 }
@@ -65,55 +85,696 @@ func newMigrateUpByOneCmd() *cobra.Command {
 func newMigrateDownCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "down",
-		Short: "Rollback the last migration",
+		Short: "Rollback the most recently applied migration",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			dbURL := getDatabaseURL()
 			if dbURL == "" {
 				return fmt.Errorf("database URL required (use -d flag or DATABASE_URL env)")
 			}
 
-			exec := executor.New(executor.WithVerbose(verbose))
+			exec := newExecutor()
 			m := migrate.New(exec)
 
-			return m.Down(context.Background(), dbURL, getMigrationsDir())
+			return m.Down(cmd.Context(), dbURL, getMigrationsDir())
 		},
 	}
 }
 
-func newMigrateStatusCmd() *cobra.Command {
+func newMigrateUpToCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "up-to <version>",
+		Short: "Run pending migrations up to and including a version",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			version, err := parseVersion(args[0])
+			if err != nil {
+				return err
+			}
+
+			dbURL := getDatabaseURL()
+			if dbURL == "" {
+				return fmt.Errorf("database URL required (use -d flag or DATABASE_URL env)")
+			}
+
+			exec := newExecutor()
+			m := migrate.New(exec)
+
+			return m.UpTo(cmd.Context(), dbURL, getMigrationsDir(), version)
+		},
+	}
+}
+
+func newMigrateDownToCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "down-to <version>",
+		Short: "Rollback migrations newer than a version",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			version, err := parseVersion(args[0])
+			if err != nil {
+				return err
+			}
+
+			dbURL := getDatabaseURL()
+			if dbURL == "" {
+				return fmt.Errorf("database URL required (use -d flag or DATABASE_URL env)")
+			}
+
+			exec := newExecutor()
+			m := migrate.New(exec)
+
+			return m.DownTo(cmd.Context(), dbURL, getMigrationsDir(), version)
+		},
+	}
+}
+
+func newMigrateRedoCmd() *cobra.Command {
 	return &cobra.Command{
+		Use:   "redo",
+		Short: "Rollback the most recently applied migration and apply it again",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dbURL := getDatabaseURL()
+			if dbURL == "" {
+				return fmt.Errorf("database URL required (use -d flag or DATABASE_URL env)")
+			}
+
+			exec := newExecutor()
+			m := migrate.New(exec)
+
+			return m.Redo(cmd.Context(), dbURL, getMigrationsDir())
+		},
+	}
+}
+
+func newMigrateResetCmd() *cobra.Command {
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "reset",
+		Short: "Rollback all migrations",
+		Long:  "Rollback every applied migration. This is a destructive operation.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dbURL := getDatabaseURL()
+			if dbURL == "" {
+				return fmt.Errorf("database URL required (use -d flag or DATABASE_URL env)")
+			}
+
+			cfg, err := db.ParseDatabaseURL(dbURL)
+			if err != nil {
+				return err
+			}
+
+			if !force && !plan {
+				if !confirmAction(cmd.Context(), fmt.Sprintf("Rollback all migrations on database '%s'?", cfg.Database)) {
+					fmt.Println("Aborted.")
+					return nil
+				}
+			}
+
+			exec := newExecutor()
+			m := migrate.New(exec)
+
+			return m.Reset(cmd.Context(), dbURL, getMigrationsDir())
+		},
+	}
+
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Skip confirmation prompt")
+	return cmd
+}
+
+func newMigrateVersionCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Print the current migration version",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dbURL := getDatabaseURL()
+			if dbURL == "" {
+				return fmt.Errorf("database URL required (use -d flag or DATABASE_URL env)")
+			}
+
+			exec := newExecutor()
+			m := migrate.New(exec)
+
+			version, err := m.Version(cmd.Context(), dbURL)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(os.Stdout, version)
+			return nil
+		},
+	}
+}
+
+// parseVersion parses a migration version argument
+func parseVersion(s string) (int64, error) {
+	version, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("invalid version %q: expected a migration version number", s)
+	}
+	return version, nil
+}
+
+func newMigrateStatusCmd() *cobra.Command {
+	var (
+		output string
+		data   bool
+	)
+
+	cmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show migration status",
+		Long: `Show the status of every migration. States:
+  applied               applied in version order
+  pending               on disk but not applied
+  missing               applied but no longer on disk
+  applied-out-of-order  applied after a newer version
+Pending migrations older than the current version are flagged "behind current"
+("behind_current": true in JSON): up applies them only if the out-of-order policy
+(--out-of-order or SEEDUP_OUT_OF_ORDER) allows. Applied migrations whose file changed
+are flagged "modified".
+With --data, show the progress of data migrations instead.
+
+Examples:
+  seedup migrate status
+  seedup migrate status -o json | jq -e 'all(.state != "pending")'
+  seedup migrate status --data`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("invalid output format %q: expected table or json", output)
+			}
+
 			dbURL := getDatabaseURL()
 			if dbURL == "" {
 				return fmt.Errorf("database URL required (use -d flag or DATABASE_URL env)")
 			}
 
-			exec := executor.New(executor.WithVerbose(verbose))
+			exec := newExecutor()
 			m := migrate.New(exec)
 
-			return m.Status(context.Background(), dbURL, getMigrationsDir())
+			if data {
+				statuses, err := m.DataStatus(cmd.Context(), dbURL, getMigrationsDir())
+				if err != nil {
+					return err
+				}
+				if output == "json" {
+					return writeJSON(os.Stdout, statuses)
+				}
+				return printDataMigrationStatus(os.Stdout, statuses)
+			}
+
+			statuses, err := m.Status(cmd.Context(), dbURL, getMigrationsDir())
+			if err != nil {
+				return err
+			}
+
+			if output == "json" {
+				return writeJSON(os.Stdout, statuses)
+			}
+			return printMigrationStatus(os.Stdout, statuses, getOutOfOrderPolicy())
 		},
 	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table or json")
+	cmd.Flags().BoolVar(&data, "data", false, "Show data migrations instead of schema migrations")
+
+	return cmd
 }
 
-func newMigrateCreateCmd() *cobra.Command {
+func newMigrateVerifyCmd() *cobra.Command {
 	return &cobra.Command{
+		Use:   "verify",
+		Short: "Check that applied migrations were not modified or removed",
+		Long: `Compare each applied migration with the checksum recorded when it was applied,
+and fail if any file was modified or is missing from the migrations directory.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dbURL := getDatabaseURL()
+			if dbURL == "" {
+				return fmt.Errorf("database URL required (use -d flag or DATABASE_URL env)")
+			}
+
+			exec := newExecutor()
+			m := migrate.New(exec)
+
+			problems, err := m.Verify(cmd.Context(), dbURL, getMigrationsDir())
+			if err != nil {
+				return err
+			}
+
+			log := events.FromContext(cmd.Context())
+			if len(problems) == 0 {
+				log.Info("verify", "All applied migrations match their files.")
+				return nil
+			}
+
+			for _, st := range problems {
+				if st.State == migrate.StateMissing {
+					log.Info("verify", fmt.Sprintf("  %s: applied but missing from %s", st.Version, getMigrationsDir()))
+				} else {
+					log.Info("verify", fmt.Sprintf("  %s_%s.sql: modified after it was applied", st.Version, st.Name))
+				}
+			}
+			return fmt.Errorf("%d applied migration(s) modified or missing", len(problems))
+		},
+	}
+}
+
+func newMigrateLintCmd() *cobra.Command {
+	var severities []string
+
+	var rules strings.Builder
+	for _, rule := range migrate.LintRules {
+		fmt.Fprintf(&rules, "  %-28s %-8s %s\n", rule.ID, rule.Severity, rule.Description)
+	}
+
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Check migrations for risky operations",
+		Long: `Check every migration in the migrations directory for risky operations.
+Exits non-zero if any finding has severity error.
+
+Rules (default severity):
+` + rules.String() + `
+Suppress a rule for one statement with a comment in or directly above it, or
+after it on the line of its terminating semicolon:
+  -- seedup:lint-ignore create-index-concurrently
+File-level rules (missing-down, statement-block) are suppressed by such a comment anywhere in the file.
+
+Severities can be changed with --severity or SEEDUP_LINT_SEVERITY, e.g.
+  seedup migrate lint --severity drop-column=warning,missing-down=off`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			spec := os.Getenv("SEEDUP_LINT_SEVERITY")
+			if len(severities) > 0 {
+				spec += "," + strings.Join(severities, ",")
+			}
+			opts := migrate.LintOptions{}
+			var err error
+			if opts.Severities, err = migrate.ParseSeverities(spec); err != nil {
+				return err
+			}
+
+			exec := newExecutor()
+			m := migrate.New(exec)
+
+			findings, err := m.Lint(getMigrationsDir(), opts)
+			if err != nil {
+				return err
+			}
+
+			log := events.FromContext(cmd.Context())
+			errors := 0
+			for _, f := range findings {
+				log.Info("lint", f.String())
+				if f.Severity == migrate.SeverityError {
+					errors++
+				}
+			}
+			if errors > 0 {
+				return fmt.Errorf("%d lint error(s) in migrations", errors)
+			}
+			if len(findings) == 0 {
+				log.Info("lint", "No issues found.")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&severities, "severity", nil,
+		"Override rule severity as rule=error|warning|off (or SEEDUP_LINT_SEVERITY env)")
+
+	return cmd
+}
+
+func newMigrateTestCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "test",
+		Short: "Check that each migration's Down reverts its Up",
+		Long: `Create a scratch database on the server of DATABASE_URL and, for each migration in
+order, apply it, roll it back and apply it again, comparing the schema (pg_dump --schema-only)
+after each step. Fails naming the first migration whose Down does not restore the previous
+schema or whose re-application produces a different one. The scratch database is dropped
+afterwards, even on failure. DATABASE_URL's own database is not touched.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dbURL := getDatabaseURL()
+			if dbURL == "" {
+				return fmt.Errorf("database URL required (use -d flag or DATABASE_URL env)")
+			}
+
+			exec := newExecutor()
+			m := db.New(exec)
+
+			return m.TestMigrations(cmd.Context(), dbURL, adminURL, getMigrationsDir())
+		},
+	}
+
+	cmd.Flags().StringVar(&adminURL, "admin-url", "",
+		"Admin database URL used to create and drop the scratch database (default: current system user)")
+
+	return cmd
+}
+
+func newMigrateDriftCmd() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "drift",
+		Short: "Compare the database schema with the schema the migrations produce",
+		Long: `Apply the migrations to a scratch database on the server of DATABASE_URL, then compare its
+objects with those of DATABASE_URL. Objects are reported as missing (only in the migrations), extra
+(only in the database, e.g. a hotfix applied by hand) or modified. Exits non-zero if any drift is found.
+
+Both schemas are read from pg_dump --schema-only output, like flatten writes it, and compared
+statement by statement with whitespace normalized, so differences name an object:
+  extensions, types, domains, sequences, tables, columns, constraints, indexes, functions,
+  views, triggers and policies
+  other: any other statement, named by its keywords and object (schemas, aggregates, rules,
+  row level security, ...)
+Privileges (GRANT/REVOKE), comments, object ownership and sequence values are not compared.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "text" && output != "json" {
+				return fmt.Errorf("invalid output format %q: expected text or json", output)
+			}
+
+			dbURL := getDatabaseURL()
+			if dbURL == "" {
+				return fmt.Errorf("database URL required (use -d flag or DATABASE_URL env)")
+			}
+
+			exec := newExecutor()
+			m := db.New(exec)
+
+			changes, err := m.Drift(cmd.Context(), dbURL, adminURL, getMigrationsDir())
+			if err != nil {
+				return err
+			}
+
+			if output == "json" {
+				if err := writeJSON(os.Stdout, changes); err != nil {
+					return err
+				}
+			} else {
+				printSchemaChanges(os.Stdout, changes)
+			}
+
+			if len(changes) > 0 {
+				return fmt.Errorf("schema drift: %d difference(s) between migrations and database", len(changes))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format: text or json")
+	cmd.Flags().StringVar(&adminURL, "admin-url", "",
+		"Admin database URL used to create and drop the scratch database (default: current system user)")
+
+	return cmd
+}
+
+func newMigrateDiffCmd() *cobra.Command {
+	var schemaPath string
+
+	cmd := &cobra.Command{
+		Use:   "diff <name>",
+		Short: "Generate a migration from a desired-state schema",
+		Long: `Load the desired schema (a SQL file, or a directory of SQL files applied in name order)
+into a scratch database on the server of DATABASE_URL, apply the migrations to another, and write
+a new migration with the DDL that turns the migrated schema into the desired one, plus a
+best-effort Down. Changes that cannot be generated, such as modified enum types, partition keys
+or generated columns, are listed and left as TODO comments in the migration. Review the
+migration before applying it: dropped tables and columns lose their data.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dbURL := getDatabaseURL()
+			if dbURL == "" {
+				return fmt.Errorf("database URL required (use -d flag or DATABASE_URL env)")
+			}
+			if schemaPath == "" {
+				schemaPath = os.Getenv("SCHEMA_PATH")
+			}
+			if schemaPath == "" {
+				schemaPath = "./schema.sql"
+			}
+
+			exec := newExecutor()
+			m := db.New(exec)
+
+			result, err := m.GenerateMigration(cmd.Context(), dbURL, adminURL, getMigrationsDir(), schemaPath, args[0])
+			if err != nil {
+				return err
+			}
+			if result.Path == "" {
+				return nil
+			}
+
+			log := events.FromContext(cmd.Context())
+			for _, c := range result.Changes {
+				log.Info("migrate-diff", fmt.Sprintf("%s %s %s", c.Type, c.Kind, c.Name))
+			}
+			log.Info("migrate-diff", fmt.Sprintf("Created migration: %s", result.Path))
+			if len(result.Unsupported) > 0 {
+				log.Info("migrate-diff", fmt.Sprintf("%d change(s) could not be generated, see the TODO comments in the migration", len(result.Unsupported)))
+				for _, c := range result.Unsupported {
+					log.Info("migrate-diff", fmt.Sprintf("Not generated: %s %s %s", c.Type, c.Kind, c.Name))
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&schemaPath, "schema", "",
+		"Desired schema file or directory (or SCHEMA_PATH env, default: ./schema.sql)")
+	cmd.Flags().StringVar(&adminURL, "admin-url", "",
+		"Admin database URL used to create and drop the scratch databases (default: current system user)")
+
+	return cmd
+}
+
+// printSchemaChanges writes one line per change, with both definitions for modified objects
+func printSchemaChanges(w io.Writer, changes []schema.Change) {
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "No drift: the database matches the migrations.")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range changes {
+		switch c.Type {
+		case schema.Missing:
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", c.Type, c.Kind, c.Name, summarize(c.Expected.Definition))
+		case schema.Extra:
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", c.Type, c.Kind, c.Name, summarize(c.Actual.Definition))
+		case schema.Modified:
+			fmt.Fprintf(tw, "%s\t%s\t%s\t\n", c.Type, c.Kind, c.Name)
+			fmt.Fprintf(tw, "\t\t  migrations:\t%s\n", summarize(c.Expected.Definition))
+			fmt.Fprintf(tw, "\t\t  database:\t%s\n", summarize(c.Actual.Definition))
+		}
+	}
+	tw.Flush()
+}
+
+// summarize collapses a definition onto one line and shortens it for display
+func summarize(definition string) string {
+	const maxLen = 120
+	s := strings.Join(strings.Fields(definition), " ")
+	if len(s) > maxLen {
+		s = s[:maxLen-3] + "..."
+	}
+	return s
+}
+
+// writeJSON writes v as indented JSON
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printMigrationStatus writes statuses as an aligned table
+func printMigrationStatus(w io.Writer, statuses []migrate.MigrationStatus, policy migrate.OutOfOrderPolicy) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	var behind int
+	for _, st := range statuses {
+		appliedAt := "-"
+		if st.AppliedAt != nil {
+			appliedAt = st.AppliedAt.Format(time.DateTime)
+		}
+		name := st.Name
+		if name == "" {
+			name = "-"
+		}
+		state := string(st.State)
+		if st.Modified {
+			state += " (modified)"
+		}
+		if st.BehindCurrent {
+			state += " (behind current)"
+			behind++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", st.Version, name, state, appliedAt)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if behind > 0 {
+		action := "will apply them"
+		if policy == migrate.OutOfOrderError {
+			action = "will refuse to run"
+		}
+		fmt.Fprintf(w, "\n%d pending migration(s) are behind the current version: up %s (out-of-order policy: %s)\n",
+			behind, action, policy)
+	}
+	return nil
+}
+
+// printDataMigrationStatus writes data migration progress as an aligned table
+func printDataMigrationStatus(w io.Writer, statuses []migrate.DataMigrationStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATE\tROWS\tCURSOR\tSTARTED AT\tCOMPLETED AT")
+	for _, st := range statuses {
+		startedAt, completedAt, cursor := "-", "-", "-"
+		if st.StartedAt != nil {
+			startedAt = st.StartedAt.Format(time.DateTime)
+		}
+		if st.CompletedAt != nil {
+			completedAt = st.CompletedAt.Format(time.DateTime)
+		}
+		if st.State != migrate.DataPending {
+			cursor = st.Cursor
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n", st.Version, st.Name, st.State, st.Rows, cursor, startedAt, completedAt)
+	}
+	return tw.Flush()
+}
+
+func newMigrateDataCmd() *cobra.Command {
+	var opts migrate.DataOptions
+
+	cmd := &cobra.Command{
+		Use:   "data",
+		Short: "Run batched data migrations",
+		Long: `Run the data migrations in the data subdirectory of the migrations directory that have
+not completed, in version order. Each runs its batch query until it processes no more rows,
+committing each batch together with its progress, so an interrupted run resumes where it
+stopped. A data migration only runs once the schema version it is numbered after has been
+applied. Progress (rows, percentage and ETA when the file has a count query) is reported
+every few seconds; see migrate status --data.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dbURL := getDatabaseURL()
+			if dbURL == "" {
+				return fmt.Errorf("database URL required (use -d flag or DATABASE_URL env)")
+			}
+			if opts.BatchSize < 0 {
+				return fmt.Errorf("invalid batch size %d", opts.BatchSize)
+			}
+
+			exec := newExecutor()
+			m := migrate.New(exec)
+
+			return m.RunData(cmd.Context(), dbURL, getMigrationsDir(), opts)
+		},
+	}
+
+	cmd.Flags().IntVar(&opts.BatchSize, "batch-size", 0, "Rows per batch, overriding the migrations' batch_size")
+	cmd.Flags().DurationVar(&opts.Sleep, "sleep", 0, "Pause between batches, overriding the migrations' sleep")
+
+	return cmd
+}
+
+func newMigrateBaselineCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "baseline",
+		Short: "Start managing an existing database with migrations",
+		Long: `Dump the schema of a database that predates seedup into an initial migration and record
+it as applied without running it, so later migrations build on the existing schema. Refuses
+if the database has applied migrations or the migrations directory is not empty.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dbURL := getDatabaseURL()
+			if dbURL == "" {
+				return fmt.Errorf("database URL required (use -d flag or DATABASE_URL env)")
+			}
+
+			exec := newExecutor()
+			m := migrate.New(exec)
+
+			path, err := m.Baseline(cmd.Context(), dbURL, getMigrationsDir())
+			if err != nil {
+				return err
+			}
+
+			events.FromContext(cmd.Context()).Info("baseline", fmt.Sprintf("Created migration: %s", path))
+			return nil
+		},
+	}
+}
+
+func newMigrateCreateCmd() *cobra.Command {
+	var (
+		opts migrate.CreateOptions
+		edit bool
+	)
+
+	cmd := &cobra.Command{
 		Use:   "create <name>",
 		Short: "Create a new migration file",
-		Args:  cobra.ExactArgs(1),
+		Long: `Create a new SQL migration file, or with --go a Go migration stub registered in the
+migrations package's Registry (created on first use). Go migrations only run from a binary
+built around seedup.Main with that registry.
+
+With --template the migration is rendered from a template in the templates subdirectory of
+the migrations directory (<name>.sql, using Go text/template syntax) or from a built-in one:
+create_table (table), add_column (table, column, type) and add_index_concurrently (table,
+columns, index). Set template variables with --var key=value; {{.name}} and {{.version}}
+are always available.`,
+		Example: `  seedup migrate create add_users --template create_table --var table=users
+  seedup migrate create index_users_email -t add_index_concurrently \
+    --var table=users --var columns=email --var index=users_email_idx
+  seedup migrate create backfill_names --sequential --edit`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			exec := executor.New(executor.WithVerbose(verbose))
+			exec := newExecutor()
 			m := migrate.New(exec)
 
-			filepath, err := m.Create(getMigrationsDir(), args[0])
+			filepath, err := m.CreateWith(getMigrationsDir(), args[0], opts)
 			if err != nil {
 				return err
 			}
 
-			fmt.Fprintf(os.Stdout, "Created migration: %s\n", filepath)
+			events.FromContext(cmd.Context()).Info("migrate-create", fmt.Sprintf("Created migration: %s", filepath))
+
+			if edit && !plan {
+				return openEditor(filepath)
+			}
 			return nil
 		},
 	}
+
+	cmd.Flags().StringVarP(&opts.Template, "template", "t", "", "Render the migration from a project or built-in template")
+	cmd.Flags().StringToStringVar(&opts.Vars, "var", nil, "Template variable as key=value (repeatable)")
+	cmd.Flags().BoolVarP(&opts.Sequential, "sequential", "s", false, "Number the migration after the highest existing version instead of by timestamp")
+	cmd.Flags().BoolVar(&opts.Go, "go", false, "Create a Go migration instead of a SQL one")
+	cmd.Flags().BoolVar(&edit, "edit", false, "Open the new migration in $VISUAL or $EDITOR")
+
+	return cmd
+}
+
+// openEditor opens path in the user's editor, attached to the terminal
+func openEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	// The editor may carry arguments, e.g. EDITOR="code --wait"
+	fields := strings.Fields(editor)
+	editCmd := osexec.Command(fields[0], append(fields[1:], path)...)
+	editCmd.Stdin, editCmd.Stdout, editCmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := editCmd.Run(); err != nil {
+		return fmt.Errorf("running editor %s: %w", fields[0], err)
+	}
+	return nil
 }
@@ -1,9 +1,16 @@
 package cli
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/tmwinc/seedup/pkg/events"
+	"github.com/tmwinc/seedup/pkg/executor"
+	"github.com/tmwinc/seedup/pkg/migrate"
 )
 
 var (
@@ -11,19 +18,78 @@ var (
 	databaseURL   string
 	migrationsDir string
 	verbose       bool
+	executorKind  string
+	plan          bool
+	retryAttempts int
+	retryBackoff  time.Duration
+	timeout       time.Duration
+	lockTimeout   time.Duration
+	logFormat     string
+
+	// Session settings for migrations without their own directives
+	migrationLockTimeout      string
+	migrationStatementTimeout string
+
+	// What up does with pending migrations older than the current version
+	outOfOrder string
+
+	// cancelTimeout releases the --timeout deadline once the command returns
+	cancelTimeout context.CancelFunc = func() {}
 )
 
+// Execute runs the seedup command line with ctx
+func Execute(ctx context.Context) error {
+	defer func() { cancelTimeout() }()
+	return NewRootCmd().ExecuteContext(ctx)
+}
+
 func NewRootCmd() *cobra.Command {
 	rootCmd := &cobra.Command{
 		Use:   "seedup",
 		Short: "Database migration and seed management tool",
 		Long: `seedup is a CLI tool for managing database migrations and seed data.
-It wraps goose for migrations and provides utilities for creating and applying seed data.
+It runs goose-compatible migrations and provides utilities for creating and applying seed data.
 
 Configuration is done via environment variables or CLI flags:
   DATABASE_URL    - PostgreSQL connection URL
   MIGRATIONS_DIR  - Path to migrations directory (default: ./migrations)
-  SEED_DIR        - Path to seed data directory (default: ./seed)`,
+  SEED_DIR        - Path to seed data directory (default: ./seed)
+  SEEDUP_EXECUTOR - How SQL is executed: psql or native (default: psql)`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			switch getExecutorKind() {
+			case "psql", "native":
+			default:
+				return fmt.Errorf("invalid executor %q: expected psql or native", getExecutorKind())
+			}
+
+			switch events.Format(logFormat) {
+			case events.FormatText, events.FormatJSON:
+			default:
+				return fmt.Errorf("invalid log format %q: expected text or json", logFormat)
+			}
+			cmd.SetContext(events.WithLogger(cmd.Context(), events.New(os.Stdout, events.Format(logFormat))))
+			cmd.SetContext(migrate.WithLockTimeout(cmd.Context(), lockTimeout))
+
+			settings := getMigrationSettings()
+			if err := settings.Validate(); err != nil {
+				return err
+			}
+			cmd.SetContext(migrate.WithSessionDefaults(cmd.Context(), settings))
+
+			policy := getOutOfOrderPolicy()
+			if err := policy.Validate(); err != nil {
+				return err
+			}
+			cmd.SetContext(migrate.WithOutOfOrderPolicy(cmd.Context(), policy))
+
+			if timeout > 0 {
+				ctx, cancel := context.WithTimeoutCause(cmd.Context(), timeout,
+					fmt.Errorf("timed out after %s", timeout))
+				cancelTimeout = cancel
+				cmd.SetContext(ctx)
+			}
+			return nil
+		},
 	}
 
 	// Global flags
@@ -33,6 +99,26 @@ Configuration is done via environment variables or CLI flags:
 		"Migrations directory (or MIGRATIONS_DIR env)")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false,
 		"Verbose output")
+	rootCmd.PersistentFlags().StringVar(&executorKind, "executor", "",
+		"SQL executor: psql or native (or SEEDUP_EXECUTOR env)")
+	rootCmd.PersistentFlags().BoolVar(&plan, "plan", false,
+		"Print the commands, SQL and file changes that would be made without making them (reads such as queries and pg_dump still run against the database)")
+	rootCmd.PersistentFlags().IntVar(&retryAttempts, "retry-attempts", executor.DefaultRetryPolicy.Attempts,
+		"Attempts for operations failing with transient connection errors (1 disables retries)")
+	rootCmd.PersistentFlags().DurationVar(&retryBackoff, "retry-backoff", executor.DefaultRetryPolicy.InitialBackoff,
+		"Initial delay between retries, doubled after each attempt")
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 0,
+		"Abort the command after this duration (0 means no timeout)")
+	rootCmd.PersistentFlags().DurationVar(&lockTimeout, "lock-timeout", 0,
+		"Give up waiting for the migration lock held by another seedup after this duration (0 waits indefinitely)")
+	rootCmd.PersistentFlags().StringVar(&migrationLockTimeout, "migration-lock-timeout", "",
+		"Default lock_timeout for migrations, e.g. 5s (or SEEDUP_MIGRATION_LOCK_TIMEOUT env)")
+	rootCmd.PersistentFlags().StringVar(&migrationStatementTimeout, "migration-statement-timeout", "",
+		"Default statement_timeout for migrations, e.g. 10min (or SEEDUP_MIGRATION_STATEMENT_TIMEOUT env)")
+	rootCmd.PersistentFlags().StringVar(&outOfOrder, "out-of-order", "",
+		"Pending migrations older than the current version: error, allow or allow-with-warning (or SEEDUP_OUT_OF_ORDER env, default error)")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", string(events.FormatText),
+		"Output format: text or json (one event per step on stdout)")
 
 	// Add subcommands
 	rootCmd.AddCommand(newMigrateCmd())
@@ -71,3 +157,80 @@ func getSeedDir() string {
 	}
 	return "./seed"
 }
+
+// getMigrationSettings returns the default migration session settings from flags or environment
+func getMigrationSettings() migrate.SessionSettings {
+	settings := migrate.SessionSettings{
+		LockTimeout:      migrationLockTimeout,
+		StatementTimeout: migrationStatementTimeout,
+	}
+	if settings.LockTimeout == "" {
+		settings.LockTimeout = os.Getenv("SEEDUP_MIGRATION_LOCK_TIMEOUT")
+	}
+	if settings.StatementTimeout == "" {
+		settings.StatementTimeout = os.Getenv("SEEDUP_MIGRATION_STATEMENT_TIMEOUT")
+	}
+	return settings
+}
+
+// getOutOfOrderPolicy returns the out-of-order migration policy from flag or environment
+func getOutOfOrderPolicy() migrate.OutOfOrderPolicy {
+	if outOfOrder != "" {
+		return migrate.OutOfOrderPolicy(outOfOrder)
+	}
+	if policy := os.Getenv("SEEDUP_OUT_OF_ORDER"); policy != "" {
+		return migrate.OutOfOrderPolicy(policy)
+	}
+	return migrate.OutOfOrderError
+}
+
+// getExecutorKind returns the executor kind from flag or environment
+func getExecutorKind() string {
+	if executorKind != "" {
+		return executorKind
+	}
+	if kind := os.Getenv("SEEDUP_EXECUTOR"); kind != "" {
+		return kind
+	}
+	return "psql"
+}
+
+// newExecutor creates the executor selected by the global flags.
+// The native executor runs SQL in-process and does not require psql.
+// Transient connection failures are retried per the retry flags.
+// In plan mode, changes are printed instead of executed.
+func newExecutor() executor.Executor {
+	return buildExecutor(retryAttempts != 1)
+}
+
+// buildExecutor creates the executor selected by the global flags, retrying
+// transient connection failures only if retry is set, for callers such as
+// db wait that run their own retry loop.
+func buildExecutor(retry bool) executor.Executor {
+	// In JSON mode stdout is reserved for events, so tool output goes to stderr
+	out := io.Writer(os.Stdout)
+	if events.Format(logFormat) == events.FormatJSON {
+		out = os.Stderr
+	}
+
+	opts := []executor.Option{executor.WithVerbose(verbose), executor.WithStdout(out)}
+
+	var exec executor.Executor
+	if getExecutorKind() == "native" {
+		exec = executor.NewNative(opts...)
+	} else {
+		exec = executor.New(opts...)
+	}
+
+	if retry {
+		policy := executor.DefaultRetryPolicy
+		policy.Attempts = max(retryAttempts, 1)
+		policy.InitialBackoff = retryBackoff
+		exec = executor.NewRetrying(exec, policy, os.Stderr)
+	}
+
+	if plan {
+		return executor.NewPlanner(exec, out)
+	}
+	return exec
+}
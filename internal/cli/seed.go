@@ -1,12 +1,10 @@
 package cli
 
 import (
-	"context"
 	"fmt"
 	"path/filepath"
 
 	"github.com/spf13/cobra"
-	"github.com/tmwinc/seedup/pkg/executor"
 	"github.com/tmwinc/seedup/pkg/seed"
 )
 
@@ -47,13 +45,13 @@ Example:
 				return fmt.Errorf("database URL required (use -d flag or DATABASE_URL env)")
 			}
 
-			exec := executor.New(executor.WithVerbose(verbose))
+			exec := newExecutor()
 			s := seed.New(exec)
 
 			// Seed data directory: ./seed/<name>/
 			dir := filepath.Join(getSeedDir(), name)
 
-			return s.Apply(context.Background(), dbURL, getMigrationsDir(), dir)
+			return s.Apply(cmd.Context(), dbURL, getMigrationsDir(), dir)
 		},
 	}
 
@@ -85,7 +83,12 @@ Example:
 				return fmt.Errorf("database URL required (use -d flag or DATABASE_URL env)")
 			}
 
-			exec := executor.New(executor.WithVerbose(verbose))
+			// Dry run previews the extraction and file changes without executing them
+			if dryRun {
+				plan = true
+			}
+
+			exec := newExecutor()
 			s := seed.New(exec)
 
 			// Seed data directory: ./seed/<name>/
@@ -94,15 +97,11 @@ Example:
 			// Seed query file: ./seed/<name>.sql
 			queryFile := filepath.Join(getSeedDir(), name+".sql")
 
-			opts := seed.CreateOptions{
-				DryRun: dryRun,
-			}
-
-			return s.Create(context.Background(), dbURL, getMigrationsDir(), dir, queryFile, opts)
+			return s.Create(cmd.Context(), dbURL, getMigrationsDir(), dir, queryFile, seed.CreateOptions{})
 		},
 	}
 
-	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview without modifying files")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview without modifying files or running the extraction (same as --plan)")
 
 	return cmd
 }
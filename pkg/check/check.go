@@ -9,6 +9,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/tmwinc/seedup/pkg/events"
 	"github.com/tmwinc/seedup/pkg/executor"
 )
 
@@ -25,6 +26,13 @@ func New(exec executor.Executor) *Checker {
 // Check validates that new migrations have the latest timestamps
 // This prevents merge conflicts when multiple developers add migrations
 func (c *Checker) Check(ctx context.Context, migrationsDir, baseBranch string) error {
+	step := events.FromContext(ctx).Start("check", "")
+	return step.End(c.check(ctx, migrationsDir, baseBranch, step))
+}
+
+func (c *Checker) check(ctx context.Context, migrationsDir, baseBranch string, step *events.Step) error {
+	log := events.FromContext(ctx)
+
 	// Fetch the base branch if in CI
 	if err := c.fetchBaseBranch(ctx, baseBranch); err != nil {
 		// Ignore fetch errors - may already have the branch
@@ -44,10 +52,12 @@ func (c *Checker) Check(ctx context.Context, migrationsDir, baseBranch string) e
 	}
 
 	if len(newMigrations) == 0 {
-		fmt.Println("No new migrations added")
+		log.Info("check", "No new migrations added")
 		return nil
 	}
 
+	step.AddFiles(newMigrations...)
+
 	// The N newest migrations should be exactly the new migrations
 	expectedLatest := allMigrations[:len(newMigrations)]
 
@@ -59,7 +69,7 @@ func (c *Checker) Check(ctx context.Context, migrationsDir, baseBranch string) e
 		return c.formatError(newMigrations, migrationsDir)
 	}
 
-	fmt.Println("New migrations have the latest timestamps, all is good")
+	log.Info("check", "New migrations have the latest timestamps, all is good")
 	return nil
 }
 
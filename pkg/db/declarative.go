@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tmwinc/seedup/pkg/events"
+	"github.com/tmwinc/seedup/pkg/migrate"
+	"github.com/tmwinc/seedup/pkg/schema"
+)
+
+// GeneratedMigration describes the result of GenerateMigration
+type GeneratedMigration struct {
+	Path        string          // Empty if the migrations already produce the desired schema
+	Changes     []schema.Change // Differences from the migrated to the desired schema
+	Unsupported []schema.Change // Changes left for the author to write by hand
+}
+
+// GenerateMigration writes a migration that turns the schema produced by the
+// migrations into the desired schema, read from a SQL file or a directory of
+// SQL files applied in name order. Both schemas are built on scratch
+// databases next to dbURL, which are dropped afterwards. Changes that cannot
+// be expressed as DDL are marked with TODO comments in the migration and
+// returned as unsupported.
+func (m *Manager) GenerateMigration(ctx context.Context, dbURL, adminURL, migrationsDir, desiredPath, name string) (*GeneratedMigration, error) {
+	cfg, err := ParseDatabaseURL(dbURL)
+	if err != nil {
+		return nil, err
+	}
+	if adminURL == "" {
+		adminURL = cfg.AdminURL()
+	}
+
+	files, err := desiredSchemaFiles(desiredPath)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := m.migratedSchema(ctx, cfg, adminURL, migrationsDir, m.inspectSchema)
+	if err != nil {
+		return nil, err
+	}
+	desired, err := m.desiredSchema(ctx, cfg, adminURL, files)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GeneratedMigration{Changes: schema.Diff(desired, current)}
+	if len(result.Changes) == 0 {
+		events.FromContext(ctx).Info("migrate-diff", "Migrations already produce the desired schema, nothing to generate")
+		return result, nil
+	}
+
+	up, unsupported := schema.Plan(current, desired)
+	down, unsupportedDown := schema.Plan(desired, current)
+	result.Unsupported = unsupported
+
+	result.Path, err = m.migrator.CreateSQL(migrationsDir, name, migrationSQL(up, unsupported), migrationSQL(down, unsupportedDown))
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// desiredSchema returns the schema produced by applying the desired-state files to a scratch database
+func (m *Manager) desiredSchema(ctx context.Context, cfg *DBConfig, adminURL string, files []string) (schema.Schema, error) {
+	scratchURL, err := m.createScratch(ctx, cfg, adminURL, "desired")
+	if err != nil {
+		return nil, err
+	}
+	defer m.dropScratch(ctx, scratchURL, adminURL)
+
+	log := events.FromContext(ctx)
+	for _, file := range files {
+		step := log.Start("load-schema", fmt.Sprintf("Loading %s...", filepath.Base(file))).Database(scratchURL)
+		if err := step.End(m.exec.RunSQLFile(ctx, scratchURL, file)); err != nil {
+			return nil, fmt.Errorf("loading %s: %w", file, err)
+		}
+	}
+
+	desired, err := m.inspectSchema(ctx, scratchURL)
+	if err != nil {
+		return nil, fmt.Errorf("reading desired schema: %w", err)
+	}
+	return desired, nil
+}
+
+// inspectSchema reads the schema of the database at dbURL from its catalogs,
+// which give Plan the definitions it needs to write DDL
+func (m *Manager) inspectSchema(ctx context.Context, dbURL string) (schema.Schema, error) {
+	return schema.New(m.exec).Inspect(ctx, dbURL, migrate.BookkeepingTables)
+}
+
+// desiredSchemaFiles returns path if it is a file, or the SQL files in it sorted by name
+func desiredSchemaFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading desired schema: %w", err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(path, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .sql files in %s", path)
+	}
+	return files, nil
+}
+
+// migrationSQL formats statements for a migration section, preceded by TODO
+// comments for the changes that could not be generated
+func migrationSQL(statements []string, unsupported []schema.Change) string {
+	var sql strings.Builder
+	for _, c := range unsupported {
+		fmt.Fprintf(&sql, "-- TODO: %s %s %s is not supported, write it by hand\n", c.Type, c.Kind, c.Name)
+	}
+	if len(unsupported) > 0 && len(statements) > 0 {
+		sql.WriteString("\n")
+	}
+	for i, stmt := range statements {
+		if i > 0 {
+			sql.WriteString("\n\n")
+		}
+		sql.WriteString(strings.TrimSuffix(strings.TrimSpace(stmt), ";"))
+		sql.WriteString(";")
+	}
+	return sql.String()
+}
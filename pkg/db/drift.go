@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tmwinc/seedup/pkg/events"
+	"github.com/tmwinc/seedup/pkg/schema"
+)
+
+// Drift compares the schema the migrations produce with the schema of the
+// database at dbURL. Both schemas are read from pg_dump output, the expected
+// one after applying the migrations to a scratch database next to dbURL,
+// which is dropped afterwards. Changes are reported from the point of view
+// of the database: Missing objects exist only in the migrations, Extra
+// objects only in the database.
+func (m *Manager) Drift(ctx context.Context, dbURL, adminURL, migrationsDir string) ([]schema.Change, error) {
+	cfg, err := ParseDatabaseURL(dbURL)
+	if err != nil {
+		return nil, err
+	}
+	if adminURL == "" {
+		adminURL = cfg.AdminURL()
+	}
+
+	expected, err := m.migratedSchema(ctx, cfg, adminURL, migrationsDir, m.dumpSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	step := events.FromContext(ctx).Start("dump-schema", "Dumping database schema...").Database(dbURL)
+	actual, err := m.dumpSchema(ctx, dbURL)
+	if err := step.End(err); err != nil {
+		return nil, fmt.Errorf("dumping database schema: %w", err)
+	}
+
+	return schema.Diff(expected, actual), nil
+}
+
+// migratedSchema returns the schema produced by applying all migrations to a
+// scratch database, as read by read
+func (m *Manager) migratedSchema(ctx context.Context, cfg *DBConfig, adminURL, migrationsDir string, read func(context.Context, string) (schema.Schema, error)) (schema.Schema, error) {
+	scratchURL, err := m.createScratch(ctx, cfg, adminURL, "migrated")
+	if err != nil {
+		return nil, err
+	}
+	defer m.dropScratch(ctx, scratchURL, adminURL)
+
+	step := events.FromContext(ctx).Start("migrate", "Applying migrations to scratch database...").Database(scratchURL)
+	if err := step.End(m.migrator.Up(ctx, scratchURL, migrationsDir)); err != nil {
+		return nil, fmt.Errorf("applying migrations to scratch database: %w", err)
+	}
+
+	expected, err := read(ctx, scratchURL)
+	if err != nil {
+		return nil, fmt.Errorf("reading migrated schema: %w", err)
+	}
+	return expected, nil
+}
+
+// dumpSchema reads the schema of the database at dbURL from pg_dump output,
+// like flatten writes it
+func (m *Manager) dumpSchema(ctx context.Context, dbURL string) (schema.Schema, error) {
+	dump, err := m.migrator.DumpSchema(ctx, dbURL)
+	if err != nil {
+		return nil, err
+	}
+	return schema.ParseDump(dump), nil
+}
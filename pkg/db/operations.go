@@ -6,6 +6,10 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/tmwinc/seedup/pkg/events"
+	"github.com/tmwinc/seedup/pkg/executor"
 )
 
 // Drop drops the database specified in the DATABASE_URL
@@ -40,13 +44,13 @@ func (m *Manager) Create(ctx context.Context, dbURL, adminURL string) error {
 	}
 
 	// Check if database already exists
-	checkQuery := fmt.Sprintf("SELECT 1 FROM pg_database WHERE datname = '%s'", cfg.Database)
-	result, err := m.exec.RunSQL(ctx, adminURL, checkQuery)
+	checkQuery := fmt.Sprintf("SELECT 1 FROM pg_database WHERE datname = %s", quoteLiteral(cfg.Database))
+	result, err := m.exec.Query(ctx, adminURL, checkQuery)
 	if err != nil {
 		return fmt.Errorf("checking database existence: %w", err)
 	}
 
-	if strings.TrimSpace(result) == "1" {
+	if len(result.Rows) > 0 {
 		return nil // Database already exists
 	}
 
@@ -71,17 +75,17 @@ func (m *Manager) CreateUser(ctx context.Context, dbURL, adminURL string) error
 	}
 
 	// Check if user already exists
-	checkQuery := fmt.Sprintf("SELECT 1 FROM pg_roles WHERE rolname = '%s'", cfg.User)
-	result, err := m.exec.RunSQL(ctx, adminURL, checkQuery)
+	checkQuery := fmt.Sprintf("SELECT 1 FROM pg_roles WHERE rolname = %s", quoteLiteral(cfg.User))
+	result, err := m.exec.Query(ctx, adminURL, checkQuery)
 	if err != nil {
 		return fmt.Errorf("checking user existence: %w", err)
 	}
 
-	if strings.TrimSpace(result) == "1" {
+	if len(result.Rows) > 0 {
 		return nil // User already exists
 	}
 
-	query := fmt.Sprintf("CREATE USER %s WITH PASSWORD '%s'", quoteIdent(cfg.User), cfg.Password)
+	query := fmt.Sprintf("CREATE USER %s WITH PASSWORD %s", quoteIdent(cfg.User), quoteLiteral(cfg.Password))
 	_, err = m.exec.RunSQL(ctx, adminURL, query)
 	if err != nil {
 		return fmt.Errorf("creating user: %w", err)
@@ -118,6 +122,25 @@ func (m *Manager) SetupPermissions(ctx context.Context, dbURL, adminURL string)
 	return nil
 }
 
+// Wait blocks until the database accepts connections or ctx is done, so
+// callers bound it with a deadline. Transient failures (connection refused,
+// server starting up, too many connections) are retried; any other error is
+// returned immediately. The executor should not retry itself.
+func (m *Manager) Wait(ctx context.Context, dbURL string) error {
+	policy := executor.RetryPolicy{
+		InitialBackoff: 250 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+	}
+	err := executor.Retry(ctx, policy, nil, func() error {
+		_, err := m.exec.Query(ctx, dbURL, "SELECT 1")
+		return err
+	})
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("database not ready (%v): %w", context.Cause(ctx), err)
+	}
+	return err
+}
+
 // Setup performs a full database setup: drop, create user, create db, permissions, migrate, seed
 func (m *Manager) Setup(ctx context.Context, opts SetupOptions) error {
 	cfg, err := ParseDatabaseURL(opts.DatabaseURL)
@@ -130,39 +153,57 @@ func (m *Manager) Setup(ctx context.Context, opts SetupOptions) error {
 		adminURL = cfg.AdminURL()
 	}
 
+	// Hold the migration lock throughout, as the admin user since the
+	// application user may not exist yet. Like every migration lock it is
+	// held in the maintenance database, so it also excludes migrate up.
+	ctx, unlock, err := m.migrator.LockFrom(ctx, adminURL, opts.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	log := events.FromContext(ctx)
+
 	// 1. Create user if not exists (do this first so DROP doesn't fail if user doesn't exist)
-	fmt.Printf("Creating user '%s' if not exists...\n", cfg.User)
-	if err := m.CreateUser(ctx, opts.DatabaseURL, adminURL); err != nil {
+	step := log.Start("create-user", fmt.Sprintf("Creating user '%s' if not exists...", cfg.User)).Database(opts.DatabaseURL)
+	if err := step.End(m.CreateUser(ctx, opts.DatabaseURL, adminURL)); err != nil {
 		return fmt.Errorf("creating user: %w", err)
 	}
 
 	// 2. Drop database if exists
-	fmt.Printf("Dropping database '%s' if exists...\n", cfg.Database)
-	if err := m.Drop(ctx, opts.DatabaseURL, adminURL); err != nil {
+	step = log.Start("drop-database", fmt.Sprintf("Dropping database '%s' if exists...", cfg.Database)).Database(opts.DatabaseURL)
+	if err := step.End(m.Drop(ctx, opts.DatabaseURL, adminURL)); err != nil {
 		return fmt.Errorf("dropping database: %w", err)
 	}
 
 	// 3. Create database
-	fmt.Printf("Creating database '%s'...\n", cfg.Database)
-	if err := m.Create(ctx, opts.DatabaseURL, adminURL); err != nil {
+	step = log.Start("create-database", fmt.Sprintf("Creating database '%s'...", cfg.Database)).Database(opts.DatabaseURL)
+	if err := step.End(m.Create(ctx, opts.DatabaseURL, adminURL)); err != nil {
 		return fmt.Errorf("creating database: %w", err)
 	}
 
 	// 4. Setup permissions
-	fmt.Println("Setting up permissions...")
-	if err := m.SetupPermissions(ctx, opts.DatabaseURL, adminURL); err != nil {
+	step = log.Start("setup-permissions", "Setting up permissions...").Database(opts.DatabaseURL)
+	if err := step.End(m.SetupPermissions(ctx, opts.DatabaseURL, adminURL)); err != nil {
 		return fmt.Errorf("setting up permissions: %w", err)
 	}
 
-	// 5. Run migrations (if any exist)
-	migrations, _ := filepath.Glob(filepath.Join(opts.MigrationsDir, "*.sql"))
-	if len(migrations) > 0 {
-		fmt.Println("Running migrations...")
-		if err := m.migrator.Up(ctx, opts.DatabaseURL, opts.MigrationsDir); err != nil {
+	// 5. Run migrations (if any exist), including Go and repeatable migrations
+	migrations, err := m.migrator.Migrations(ctx, opts.MigrationsDir)
+	if err != nil {
+		return fmt.Errorf("reading migrations: %w", err)
+	}
+	repeatables, err := m.migrator.Repeatables(opts.MigrationsDir)
+	if err != nil {
+		return fmt.Errorf("reading repeatable migrations: %w", err)
+	}
+	if len(migrations) > 0 || len(repeatables) > 0 {
+		step = log.Start("migrate", "Running migrations...").Database(opts.DatabaseURL)
+		if err := step.End(m.migrator.Up(ctx, opts.DatabaseURL, opts.MigrationsDir)); err != nil {
 			return fmt.Errorf("running migrations: %w", err)
 		}
 	} else {
-		fmt.Println("No migration files found, skipping migrations")
+		log.Info("migrate", "No migration files found, skipping migrations")
 	}
 
 	// 6. Apply seeds (optional, requires --seed-name)
@@ -171,18 +212,18 @@ func (m *Manager) Setup(ctx context.Context, opts SetupOptions) error {
 		if _, err := os.Stat(seedDir); err == nil {
 			csvFiles, _ := filepath.Glob(filepath.Join(seedDir, "*.csv"))
 			if len(csvFiles) > 0 {
-				fmt.Printf("Applying seeds from '%s'...\n", seedDir)
-				if err := m.seeder.Apply(ctx, opts.DatabaseURL, opts.MigrationsDir, seedDir); err != nil {
+				step = log.Start("seed", fmt.Sprintf("Applying seeds from '%s'...", seedDir)).Database(opts.DatabaseURL)
+				if err := step.End(m.seeder.Apply(ctx, opts.DatabaseURL, opts.MigrationsDir, seedDir)); err != nil {
 					return fmt.Errorf("applying seeds: %w", err)
 				}
 			} else {
-				fmt.Printf("No seed CSV files found in '%s', skipping seeds\n", seedDir)
+				log.Info("seed", fmt.Sprintf("No seed CSV files found in '%s', skipping seeds", seedDir))
 			}
 		} else {
-			fmt.Printf("Seed directory '%s' not found, skipping seeds\n", seedDir)
+			log.Info("seed", fmt.Sprintf("Seed directory '%s' not found, skipping seeds", seedDir))
 		}
 	} else if !opts.SkipSeed && opts.SeedName == "" {
-		fmt.Println("No --seed-name provided, skipping seeds")
+		log.Info("seed", "No --seed-name provided, skipping seeds")
 	}
 
 	return nil
@@ -192,3 +233,8 @@ func (m *Manager) Setup(ctx context.Context, opts SetupOptions) error {
 func quoteIdent(s string) string {
 	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
 }
+
+// quoteLiteral quotes a PostgreSQL string literal to prevent SQL injection
+func quoteLiteral(s string) string {
+	return `'` + strings.ReplaceAll(s, `'`, `''`) + `'`
+}
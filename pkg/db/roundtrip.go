@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/tmwinc/seedup/pkg/events"
+	"github.com/tmwinc/seedup/pkg/migrate"
+)
+
+// TestMigrations verifies that every migration's Down reverts its Up.
+// It creates a scratch database next to dbURL and, for each migration in
+// order, applies it, rolls it back and applies it again, comparing
+// pg_dump --schema-only output along the way. The scratch database is
+// dropped afterwards, even on failure.
+func (m *Manager) TestMigrations(ctx context.Context, dbURL, adminURL, migrationsDir string) error {
+	cfg, err := ParseDatabaseURL(dbURL)
+	if err != nil {
+		return err
+	}
+	if adminURL == "" {
+		adminURL = cfg.AdminURL()
+	}
+
+	migrations, err := m.migrator.Migrations(ctx, migrationsDir)
+	if err != nil {
+		return fmt.Errorf("reading migrations: %w", err)
+	}
+	if len(migrations) == 0 {
+		events.FromContext(ctx).Info("migrate-test", "No migration files found, nothing to test")
+		return nil
+	}
+
+	scratchURL, err := m.createScratch(ctx, cfg, adminURL, "test")
+	if err != nil {
+		return err
+	}
+	defer m.dropScratch(ctx, scratchURL, adminURL)
+
+	before, err := m.migrator.DumpSchema(ctx, scratchURL)
+	if err != nil {
+		return fmt.Errorf("dumping schema: %w", err)
+	}
+
+	log := events.FromContext(ctx)
+	for _, mig := range migrations {
+		step := log.Start("migrate-test", fmt.Sprintf("Testing %s...", mig.File())).Database(scratchURL)
+		after, err := m.roundTrip(ctx, scratchURL, migrationsDir, mig, before)
+		if err := step.End(err); err != nil {
+			return fmt.Errorf("%s: %w", mig.File(), err)
+		}
+		before = after
+	}
+
+	log.Info("migrate-test", fmt.Sprintf("All %d migration(s) round-tripped cleanly", len(migrations)))
+	return nil
+}
+
+// roundTrip applies, rolls back and re-applies a migration on the scratch
+// database, returning the schema after it was applied
+func (m *Manager) roundTrip(ctx context.Context, scratchURL, migrationsDir string, mig *migrate.Migration, before string) (string, error) {
+	if err := m.migrator.UpTo(ctx, scratchURL, migrationsDir, mig.Version); err != nil {
+		return "", fmt.Errorf("applying: %w", err)
+	}
+	applied, err := m.migrator.DumpSchema(ctx, scratchURL)
+	if err != nil {
+		return "", fmt.Errorf("dumping schema: %w", err)
+	}
+
+	if err := m.migrator.Down(ctx, scratchURL, migrationsDir); err != nil {
+		return "", fmt.Errorf("rolling back: %w", err)
+	}
+	reverted, err := m.migrator.DumpSchema(ctx, scratchURL)
+	if err != nil {
+		return "", fmt.Errorf("dumping schema: %w", err)
+	}
+	if reverted != before {
+		return "", fmt.Errorf("Down does not restore the previous schema:\n%s", schemaDiff(before, reverted))
+	}
+
+	if err := m.migrator.UpTo(ctx, scratchURL, migrationsDir, mig.Version); err != nil {
+		return "", fmt.Errorf("re-applying after Down: %w", err)
+	}
+	reapplied, err := m.migrator.DumpSchema(ctx, scratchURL)
+	if err != nil {
+		return "", fmt.Errorf("dumping schema: %w", err)
+	}
+	if reapplied != applied {
+		return "", fmt.Errorf("schema differs after Down and Up again:\n%s", schemaDiff(applied, reapplied))
+	}
+
+	return applied, nil
+}
+
+// schemaDiff lists the lines only present in one of two schema dumps
+func schemaDiff(want, got string) string {
+	count := make(map[string]int)
+	for _, line := range strings.Split(want, "\n") {
+		count[line]++
+	}
+	for _, line := range strings.Split(got, "\n") {
+		count[line]--
+	}
+
+	var diff []string
+	seen := make(map[string]bool)
+	for _, line := range append(strings.Split(want, "\n"), strings.Split(got, "\n")...) {
+		n := count[line]
+		if n == 0 || seen[line] || strings.TrimSpace(line) == "" {
+			continue
+		}
+		seen[line] = true
+		prefix := "- "
+		if n < 0 {
+			prefix = "+ "
+		}
+		diff = append(diff, prefix+line)
+	}
+
+	const maxLines = 40
+	if len(diff) > maxLines {
+		diff = append(diff[:maxLines], fmt.Sprintf("... %d more line(s)", len(diff)-maxLines))
+	}
+	return strings.Join(diff, "\n")
+}
@@ -0,0 +1,38 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tmwinc/seedup/pkg/events"
+)
+
+// createScratch creates an empty database owned by the user of cfg. The
+// purpose is part of its name, so several scratch databases can coexist.
+func (m *Manager) createScratch(ctx context.Context, cfg *DBConfig, adminURL, purpose string) (string, error) {
+	name := fmt.Sprintf("%s_seedup_%s_%d", cfg.Database, purpose, time.Now().Unix())
+	if len(name) > 63 {
+		name = name[len(name)-63:]
+	}
+	scratchURL := cfg.URLWithDatabase(name)
+
+	step := events.FromContext(ctx).Start("create-database", fmt.Sprintf("Creating scratch database '%s'...", name)).Database(scratchURL)
+	if err := step.End(m.Create(ctx, scratchURL, adminURL)); err != nil {
+		return "", fmt.Errorf("creating scratch database: %w", err)
+	}
+	if err := m.SetupPermissions(ctx, scratchURL, adminURL); err != nil {
+		m.dropScratch(ctx, scratchURL, adminURL)
+		return "", fmt.Errorf("setting up scratch database permissions: %w", err)
+	}
+	return scratchURL, nil
+}
+
+// dropScratch drops the scratch database, even if ctx was cancelled
+func (m *Manager) dropScratch(ctx context.Context, scratchURL, adminURL string) {
+	ctx = context.WithoutCancel(ctx)
+	step := events.FromContext(ctx).Start("drop-database", "Dropping scratch database...").Database(scratchURL)
+	if err := step.End(m.Drop(ctx, scratchURL, adminURL)); err != nil {
+		events.FromContext(ctx).Info("drop-database", fmt.Sprintf("Warning: could not drop scratch database: %v", err))
+	}
+}
@@ -0,0 +1,164 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tmwinc/seedup/pkg/executor"
+)
+
+// Format selects how events are written
+type Format string
+
+const (
+	FormatText Format = "text" // Human readable progress messages
+	FormatJSON Format = "json" // One JSON object per line
+)
+
+// Event is a structured record of a single step
+type Event struct {
+	Time       time.Time `json:"time"`
+	Step       string    `json:"step"`
+	Message    string    `json:"message,omitempty"`
+	Database   string    `json:"database,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	Rows       int64     `json:"rows,omitempty"`
+	Files      []string  `json:"files,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Logger reports the progress of operations.
+// In text mode it prints messages as steps start; in JSON mode it emits one
+// event per step once the step has finished.
+type Logger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	format Format
+}
+
+// New creates a new Logger writing to out in the given format
+func New(out io.Writer, format Format) *Logger {
+	return &Logger{out: out, format: format}
+}
+
+type contextKey struct{}
+
+// WithLogger returns a copy of ctx carrying l
+func WithLogger(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the Logger carried by ctx, or a text logger writing to stdout
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+	return New(os.Stdout, FormatText)
+}
+
+// JSON reports whether the logger emits JSON events
+func (l *Logger) JSON() bool {
+	return l.format == FormatJSON
+}
+
+// Info reports a message that is not tied to a timed step, such as a skipped step
+func (l *Logger) Info(step, message string) {
+	if l.format == FormatText {
+		l.print(message)
+		return
+	}
+	l.emit(Event{Time: time.Now().UTC(), Step: step, Message: message})
+}
+
+// Start begins a step. In text mode the message is printed immediately.
+func (l *Logger) Start(step, message string) *Step {
+	if l.format == FormatText && message != "" {
+		l.print(message)
+	}
+	return &Step{
+		logger: l,
+		start:  time.Now(),
+		event:  Event{Step: step, Message: message},
+	}
+}
+
+func (l *Logger) print(message string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintln(l.out, message)
+}
+
+func (l *Logger) emit(e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	l.out.Write(append(data, '\n'))
+}
+
+// Step is a timed operation started with Logger.Start
+type Step struct {
+	logger *Logger
+	start  time.Time
+	event  Event
+}
+
+// Database sets the target database; credentials are stripped from the URL
+func (s *Step) Database(dbURL string) *Step {
+	s.event.Database = StripCredentials(dbURL)
+	return s
+}
+
+// AddRows adds to the number of rows affected by the step
+func (s *Step) AddRows(n int64) {
+	s.event.Rows += n
+}
+
+// AddFiles records files written or removed by the step
+func (s *Step) AddFiles(paths ...string) {
+	s.event.Files = append(s.event.Files, paths...)
+}
+
+// End finishes the step and emits its event in JSON mode. It returns err so
+// callers can write `return step.End(err)`.
+func (s *Step) End(err error) error {
+	if s.logger.format != FormatJSON {
+		return err
+	}
+
+	e := s.event
+	e.Time = s.start.UTC()
+	e.DurationMS = time.Since(s.start).Milliseconds()
+	if err != nil {
+		e.Error = executor.Redact(err.Error())
+	}
+	s.logger.emit(e)
+
+	return err
+}
+
+// StripCredentials removes the password and password query parameter from a database URL
+func StripCredentials(dbURL string) string {
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		return executor.Redact(dbURL)
+	}
+	if u.User != nil {
+		u.User = url.User(u.User.Username())
+	}
+	q := u.Query()
+	if q.Has("password") {
+		q.Del("password")
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
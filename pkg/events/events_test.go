@@ -0,0 +1,93 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTextFormat(t *testing.T) {
+	var out strings.Builder
+	l := New(&out, FormatText)
+
+	l.Info("migrate-up", "No pending migrations")
+	step := l.Start("db-create", "Creating database...")
+	step.AddRows(3)
+	if err := step.End(nil); err != nil {
+		t.Fatal(err)
+	}
+	l.Start("seed-apply", "").End(nil)
+
+	want := "No pending migrations\nCreating database...\n"
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	var out strings.Builder
+	l := New(&out, FormatJSON)
+
+	l.Info("migrate-up", "No pending migrations")
+
+	step := l.Start("seed-apply", "Applying seed data").Database("postgres://app:s3cret@db:5432/app?password=s3cret&sslmode=disable")
+	step.AddRows(2)
+	step.AddRows(3)
+	step.AddFiles("seed/dev/public.users.csv")
+	stepErr := errors.New(`connecting to postgres://app:s3cret@db/app failed`)
+	if err := step.End(stepErr); err != stepErr {
+		t.Errorf("End returned %v, want its argument", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want one event per line:\n%s", len(lines), out.String())
+	}
+
+	// Optional fields are omitted; the duration is always present
+	var info map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &info); err != nil {
+		t.Fatal(err)
+	}
+	if len(info) != 4 || info["step"] != "migrate-up" || info["message"] != "No pending migrations" ||
+		info["duration_ms"] != 0.0 || info["time"] == nil {
+		t.Errorf("info event = %s", lines[0])
+	}
+
+	var e Event
+	if err := json.Unmarshal([]byte(lines[1]), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Step != "seed-apply" || e.Message != "Applying seed data" || e.Rows != 5 ||
+		len(e.Files) != 1 || e.Files[0] != "seed/dev/public.users.csv" {
+		t.Errorf("step event = %s", lines[1])
+	}
+	if e.Database != "postgres://app@db:5432/app?sslmode=disable" {
+		t.Errorf("database = %q, want credentials stripped", e.Database)
+	}
+	if strings.Contains(e.Error, "s3cret") || !strings.Contains(e.Error, "failed") {
+		t.Errorf("error = %q, want the redacted error", e.Error)
+	}
+	if e.Time.IsZero() || e.Time.Location() != time.UTC {
+		t.Errorf("time = %v, want the UTC start time", e.Time)
+	}
+}
+
+func TestStripCredentials(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"postgres://app:s3cret@db:5432/app", "postgres://app@db:5432/app"},
+		{"postgres://app@db/app?password=s3cret", "postgres://app@db/app"},
+		{"postgres://db/app?sslmode=require", "postgres://db/app?sslmode=require"},
+	}
+
+	for _, tt := range tests {
+		if got := StripCredentials(tt.in); got != tt.want {
+			t.Errorf("StripCredentials(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// cancelWaitDelay is how long an interrupted child process may take to exit
+const cancelWaitDelay = 10 * time.Second
+
+// pgCredential is a password removed from a connection URL argument
+type pgCredential struct {
+	host, port, database, user, password string
+}
+
+// command builds an exec.Cmd whose argv contains no passwords. Passwords in
+// PostgreSQL URL or conninfo arguments are handed to the child process through PGPASSWORD,
+// or a temporary pgpass file when several different passwords are involved.
+// When ctx is done the child is interrupted (SIGINT) so tools such as psql can
+// cancel their query and exit cleanly, and killed if it has not exited after
+// cancelWaitDelay. The returned cleanup function must be called once the
+// command has finished.
+func command(ctx context.Context, name string, args ...string) (*exec.Cmd, func(), error) {
+	var creds []pgCredential
+	cleanArgs := make([]string, len(args))
+	for i, arg := range args {
+		cleanArgs[i] = arg
+		if cleanURL, cred, ok := stripPassword(arg); ok {
+			cleanArgs[i] = cleanURL
+			creds = append(creds, cred)
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, name, cleanArgs...)
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = cancelWaitDelay
+	cleanup := func() {}
+
+	switch {
+	case len(creds) == 0:
+	case samePassword(creds):
+		cmd.Env = append(os.Environ(), "PGPASSWORD="+creds[0].password)
+	default:
+		path, err := writePgpass(creds)
+		if err != nil {
+			return nil, nil, err
+		}
+		cmd.Env = append(os.Environ(), "PGPASSFILE="+path)
+		cleanup = func() { os.Remove(path) }
+	}
+
+	return cmd, cleanup, nil
+}
+
+// stripPassword removes the password from a connection string argument: a
+// postgres:// URL, with the password in its user info or a password query
+// parameter, or a key=value conninfo string
+func stripPassword(arg string) (string, pgCredential, bool) {
+	if strings.HasPrefix(arg, "postgres://") || strings.HasPrefix(arg, "postgresql://") {
+		return stripURLPassword(arg)
+	}
+	return stripConninfoPassword(arg)
+}
+
+func stripURLPassword(arg string) (string, pgCredential, bool) {
+	u, err := url.Parse(arg)
+	if err != nil {
+		return "", pgCredential{}, false
+	}
+
+	cred := pgCredential{
+		host:     u.Hostname(),
+		port:     u.Port(),
+		database: strings.TrimPrefix(u.Path, "/"),
+	}
+	var found bool
+	if u.User != nil {
+		cred.user = u.User.Username()
+		if password, ok := u.User.Password(); ok {
+			cred.password, found = password, true
+			u.User = url.User(cred.user)
+		}
+	}
+
+	// Query parameters take precedence over the other parts of the URL
+	query := u.Query()
+	if query.Has("password") {
+		cred.password, found = query.Get("password"), true
+		query.Del("password")
+		u.RawQuery = query.Encode()
+	}
+	if !found {
+		return "", pgCredential{}, false
+	}
+	for key, field := range map[string]*string{
+		"host": &cred.host, "port": &cred.port, "dbname": &cred.database, "user": &cred.user,
+	} {
+		if query.Has(key) {
+			*field = query.Get(key)
+		}
+	}
+
+	return u.String(), cred, true
+}
+
+// conninfoParam is a keyword/value pair of a conninfo string
+type conninfoParam struct {
+	key, value string
+}
+
+func stripConninfoPassword(arg string) (string, pgCredential, bool) {
+	params, ok := parseConninfo(arg)
+	if !ok {
+		return "", pgCredential{}, false
+	}
+
+	var cred pgCredential
+	var found bool
+	var clean []string
+	for _, p := range params {
+		switch p.key {
+		case "password":
+			cred.password, found = p.value, true
+			continue
+		case "host":
+			cred.host = p.value
+		case "port":
+			cred.port = p.value
+		case "dbname":
+			cred.database = p.value
+		case "user":
+			cred.user = p.value
+		}
+		clean = append(clean, p.key+"="+quoteConninfo(p.value))
+	}
+	if !found {
+		return "", pgCredential{}, false
+	}
+
+	return strings.Join(clean, " "), cred, true
+}
+
+// parseConninfo parses a "key=value key='quoted value'" conninfo string. It
+// reports false for anything else, such as SQL passed as another argument.
+func parseConninfo(s string) ([]conninfoParam, bool) {
+	var params []conninfoParam
+	i := 0
+	skipSpace := func() {
+		for i < len(s) && isConninfoSpace(s[i]) {
+			i++
+		}
+	}
+
+	for skipSpace(); i < len(s); skipSpace() {
+		start := i
+		for i < len(s) && (s[i] == '_' || s[i] >= 'a' && s[i] <= 'z') {
+			i++
+		}
+		key := s[start:i]
+		skipSpace()
+		if key == "" || i == len(s) || s[i] != '=' {
+			return nil, false
+		}
+		i++
+		skipSpace()
+
+		var value strings.Builder
+		quoted := i < len(s) && s[i] == '\''
+		if quoted {
+			i++
+		}
+		for ; ; i++ {
+			if i == len(s) {
+				if quoted {
+					return nil, false
+				}
+				break
+			}
+			c := s[i]
+			if quoted && c == '\'' {
+				i++
+				break
+			}
+			if !quoted && isConninfoSpace(c) {
+				break
+			}
+			if c == '\\' && i+1 < len(s) {
+				i++
+				c = s[i]
+			}
+			value.WriteByte(c)
+		}
+		params = append(params, conninfoParam{key: key, value: value.String()})
+	}
+
+	return params, len(params) > 0
+}
+
+func isConninfoSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// quoteConninfo quotes a conninfo value
+func quoteConninfo(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+func samePassword(creds []pgCredential) bool {
+	for _, c := range creds[1:] {
+		if c.password != creds[0].password {
+			return false
+		}
+	}
+	return true
+}
+
+// writePgpass writes a temporary pgpass file readable only by the current user
+func writePgpass(creds []pgCredential) (string, error) {
+	f, err := os.CreateTemp("", "seedup-pgpass-*")
+	if err != nil {
+		return "", fmt.Errorf("creating pgpass file: %w", err)
+	}
+	defer f.Close()
+
+	if err := f.Chmod(0600); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("creating pgpass file: %w", err)
+	}
+
+	for _, c := range creds {
+		fmt.Fprintf(f, "%s:%s:%s:%s:%s\n",
+			pgpassField(c.host), pgpassField(c.port), pgpassField(c.database),
+			pgpassField(c.user), pgpassEscape(c.password))
+	}
+
+	return f.Name(), nil
+}
+
+// pgpassField escapes a pgpass field, matching any value when empty
+func pgpassField(s string) string {
+	if s == "" {
+		return "*"
+	}
+	return pgpassEscape(s)
+}
+
+func pgpassEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `:`, `\:`).Replace(s)
+}
@@ -0,0 +1,100 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestStripPassword(t *testing.T) {
+	tests := []struct {
+		arg      string
+		wantArg  string
+		wantCred pgCredential
+		wantOK   bool
+	}{
+		{
+			arg:      "postgres://app:s3cret@db:5433/app?sslmode=disable",
+			wantArg:  "postgres://app@db:5433/app?sslmode=disable",
+			wantCred: pgCredential{host: "db", port: "5433", database: "app", user: "app", password: "s3cret"},
+			wantOK:   true,
+		},
+		{
+			arg:      "postgresql://app@db/app?password=s3cret&sslmode=disable",
+			wantArg:  "postgresql://app@db/app?sslmode=disable",
+			wantCred: pgCredential{host: "db", database: "app", user: "app", password: "s3cret"},
+			wantOK:   true,
+		},
+		{
+			// Query parameters take precedence, as with libpq
+			arg:      "postgres://app:old@db/app?user=other&password=new&host=replica",
+			wantArg:  "postgres://app@db/app?host=replica&user=other",
+			wantCred: pgCredential{host: "replica", database: "app", user: "other", password: "new"},
+			wantOK:   true,
+		},
+		{
+			arg:      "host=db port=5432 dbname=app user=app password=s3cret",
+			wantArg:  "host='db' port='5432' dbname='app' user='app'",
+			wantCred: pgCredential{host: "db", port: "5432", database: "app", user: "app", password: "s3cret"},
+			wantOK:   true,
+		},
+		{
+			arg:      `host=db password = 'it\'s a secret' application_name='my app'`,
+			wantArg:  `host='db' application_name='my app'`,
+			wantCred: pgCredential{host: "db", password: "it's a secret"},
+			wantOK:   true,
+		},
+		{arg: "postgres://app@db/app"},
+		{arg: "host=db dbname=app"},
+		{arg: "UPDATE users SET password = 'x'"},
+		{arg: "password='unterminated"},
+		{arg: "-c"},
+	}
+
+	for _, tt := range tests {
+		gotArg, gotCred, gotOK := stripPassword(tt.arg)
+		if gotOK != tt.wantOK || gotArg != tt.wantArg || gotCred != tt.wantCred {
+			t.Errorf("stripPassword(%q) = %q, %+v, %v; want %q, %+v, %v",
+				tt.arg, gotArg, gotCred, gotOK, tt.wantArg, tt.wantCred, tt.wantOK)
+		}
+	}
+}
+
+func TestRunSQLKeepsPasswordsOutOfArgv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake psql is a shell script")
+	}
+
+	// A fake psql records its arguments, environment and stdin
+	dir := t.TempDir()
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" > \"$0.args\"\necho \"$PGPASSWORD\" > \"$0.env\"\ncat > \"$0.stdin\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "psql"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	query := "CREATE USER app WITH PASSWORD 'user-s3cret'"
+	if _, err := New().RunSQL(context.Background(), "postgres://admin:admin-s3cret@db/postgres", query); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if args := read("psql.args"); strings.Contains(args, "s3cret") {
+		t.Errorf("psql argv contains a password:\n%s", args)
+	}
+	if env := read("psql.env"); strings.TrimSpace(env) != "admin-s3cret" {
+		t.Errorf("PGPASSWORD = %q, want the connection password", env)
+	}
+	if stdin := read("psql.stdin"); stdin != query {
+		t.Errorf("psql stdin = %q, want %q", stdin, query)
+	}
+}
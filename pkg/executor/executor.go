@@ -3,10 +3,11 @@ package executor
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strings"
 )
 
@@ -24,11 +25,65 @@ type Executor interface {
 	// RunSQL executes a SQL query using psql
 	RunSQL(ctx context.Context, dbURL, query string) (string, error)
 
+	// Query executes a single SELECT query and returns its rows
+	Query(ctx context.Context, dbURL, query string) (*Result, error)
+
 	// RunSQLFile executes a SQL file using psql
 	RunSQLFile(ctx context.Context, dbURL, filePath string) error
+
+	// WriteFile writes data to a file, creating parent directories as needed
+	WriteFile(path string, data []byte) error
+
+	// Remove removes a file
+	Remove(path string) error
+
+	// TryAdvisoryLock takes a session-level advisory lock if it is free.
+	// The lock is held until unlock is called.
+	TryAdvisoryLock(ctx context.Context, dbURL string, key int64) (unlock func() error, acquired bool, err error)
+
+	// RunFunc runs Go code against the database, in a transaction if requested
+	RunFunc(ctx context.Context, dbURL, name string, transaction bool, fn Func) error
+}
+
+// Result holds the rows returned by Query.
+// Values are in PostgreSQL text format; NULL is represented by an invalid NullString.
+type Result struct {
+	Columns []string
+	Rows    [][]sql.NullString
+}
+
+// CommandError is returned by Run and RunWithStdin when a command fails.
+// Its message is that of the underlying error; Stderr holds the tail of the
+// command's error output, which has already been written to the stderr writer.
+type CommandError struct {
+	Err    error
+	Stderr string
+}
+
+func (e *CommandError) Error() string { return e.Err.Error() }
+
+func (e *CommandError) Unwrap() error { return e.Err }
+
+// tailBuffer keeps the last few KB written to it
+type tailBuffer struct {
+	buf []byte
+}
+
+const tailBufferSize = 4096
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > tailBufferSize {
+		t.buf = t.buf[len(t.buf)-tailBufferSize:]
+	}
+	return len(p), nil
 }
 
-// OSExecutor implements Executor using os/exec
+func (t *tailBuffer) String() string { return string(t.buf) }
+
+// OSExecutor implements Executor using os/exec.
+// Passwords in connection URL arguments are passed to child processes through
+// the environment so they are not visible in the process list.
 type OSExecutor struct {
 	verbose bool
 	stdout  io.Writer
@@ -73,29 +128,58 @@ func New(opts ...Option) *OSExecutor {
 
 func (e *OSExecutor) Run(ctx context.Context, name string, args ...string) error {
 	if e.verbose {
-		fmt.Fprintf(e.stderr, "$ %s %s\n", name, strings.Join(args, " "))
+		fmt.Fprintf(e.stderr, "$ %s\n", Redact(formatCommand(name, args)))
 	}
 
-	cmd := exec.CommandContext(ctx, name, args...)
-	cmd.Stdout = e.stdout
-	cmd.Stderr = e.stderr
+	stdout, stderr := newRedactingWriter(e.stdout), newRedactingWriter(e.stderr)
+	defer stdout.Flush()
+	defer stderr.Flush()
 
-	return cmd.Run()
+	cmd, cleanup, err := command(ctx, name, args...)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	tail := &tailBuffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = io.MultiWriter(stderr, tail)
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("%s interrupted: %w", name, context.Cause(ctx))
+		}
+		return &CommandError{Err: err, Stderr: Redact(tail.String())}
+	}
+	return nil
 }
 
 func (e *OSExecutor) RunWithOutput(ctx context.Context, name string, args ...string) (string, error) {
+	return e.runWithInput(ctx, nil, name, args...)
+}
+
+// runWithInput runs a command with stdin and captures its output
+func (e *OSExecutor) runWithInput(ctx context.Context, stdin io.Reader, name string, args ...string) (string, error) {
 	if e.verbose {
-		fmt.Fprintf(e.stderr, "$ %s %s\n", name, strings.Join(args, " "))
+		fmt.Fprintf(e.stderr, "$ %s\n", Redact(formatCommand(name, args)))
+	}
+
+	cmd, cleanup, err := command(ctx, name, args...)
+	if err != nil {
+		return "", err
 	}
+	defer cleanup()
 
-	cmd := exec.CommandContext(ctx, name, args...)
 	var stdout, stderr bytes.Buffer
+	cmd.Stdin = stdin
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	err := cmd.Run()
-	if err != nil {
-		return "", fmt.Errorf("%w: %s", err, stderr.String())
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("%s interrupted: %w", name, context.Cause(ctx))
+		}
+		return "", fmt.Errorf("%w: %s", err, Redact(stderr.String()))
 	}
 
 	return stdout.String(), nil
@@ -103,21 +187,64 @@ func (e *OSExecutor) RunWithOutput(ctx context.Context, name string, args ...str
 
 func (e *OSExecutor) RunWithStdin(ctx context.Context, stdin io.Reader, name string, args ...string) error {
 	if e.verbose {
-		fmt.Fprintf(e.stderr, "$ %s %s\n", name, strings.Join(args, " "))
+		fmt.Fprintf(e.stderr, "$ %s\n", Redact(formatCommand(name, args)))
 	}
 
-	cmd := exec.CommandContext(ctx, name, args...)
-	cmd.Stdin = stdin
-	cmd.Stdout = e.stdout
-	cmd.Stderr = e.stderr
+	stdout, stderr := newRedactingWriter(e.stdout), newRedactingWriter(e.stderr)
+	defer stdout.Flush()
+	defer stderr.Flush()
+
+	cmd, cleanup, err := command(ctx, name, args...)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
 
-	return cmd.Run()
+	tail := &tailBuffer{}
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = io.MultiWriter(stderr, tail)
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("%s interrupted: %w", name, context.Cause(ctx))
+		}
+		return &CommandError{Err: err, Stderr: Redact(tail.String())}
+	}
+	return nil
 }
 
+// RunSQL sends the query on stdin rather than with -c, as it may contain
+// secrets such as a CREATE USER password that must not appear in argv
 func (e *OSExecutor) RunSQL(ctx context.Context, dbURL, query string) (string, error) {
-	return e.RunWithOutput(ctx, "psql", "-X", "-t", "-c", query, dbURL)
+	return e.runWithInput(ctx, strings.NewReader(query), "psql", "-X", "-t", "-v", "ON_ERROR_STOP=on", "-f", "-", dbURL)
+}
+
+func (e *OSExecutor) Query(ctx context.Context, dbURL, query string) (*Result, error) {
+	// COPY ... CSV with FORCE_QUOTE quotes every non-NULL value, so NULL and
+	// empty strings stay distinguishable and values may contain any character
+	query = strings.TrimSuffix(strings.TrimSpace(query), ";")
+	copyQuery := fmt.Sprintf("COPY (%s) TO STDOUT WITH (FORMAT csv, HEADER, FORCE_QUOTE *)", query)
+
+	output, err := e.RunWithOutput(ctx, "psql", "-X", "-q", "-c", copyQuery, dbURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseCSVResult(output)
 }
 
 func (e *OSExecutor) RunSQLFile(ctx context.Context, dbURL, filePath string) error {
 	return e.Run(ctx, "psql", "-X", "-q", "-v", "ON_ERROR_STOP=on", "-f", filePath, dbURL)
 }
+
+func (e *OSExecutor) WriteFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (e *OSExecutor) Remove(path string) error {
+	return os.Remove(path)
+}
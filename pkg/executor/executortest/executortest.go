@@ -0,0 +1,45 @@
+// Package executortest provides executors replaying golden transcripts, for
+// tests of code built on executor.Executor that need no database.
+package executortest
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/tmwinc/seedup/pkg/executor"
+)
+
+var update = flag.Bool("update", false, "re-record the golden transcripts against a PostgreSQL server on localhost:5432")
+
+// Transcript returns an executor replaying the golden transcript at path,
+// failing the test if any recorded call is not replayed. With -update it
+// instead records the calls made to a real server and saves them to path
+// once the test has passed.
+func Transcript(t testing.TB, path string) executor.Executor {
+	t.Helper()
+
+	if *update {
+		recorder := executor.NewRecorder(executor.New())
+		t.Cleanup(func() {
+			if t.Failed() {
+				return
+			}
+			if err := recorder.Save(path); err != nil {
+				t.Errorf("saving transcript: %v", err)
+			}
+		})
+		return recorder
+	}
+
+	transcript, err := executor.LoadTranscript(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayer := executor.NewReplayer(transcript)
+	t.Cleanup(func() {
+		if err := replayer.Done(); err != nil {
+			t.Error(err)
+		}
+	})
+	return replayer
+}
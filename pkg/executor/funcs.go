@@ -0,0 +1,48 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// DB is the database handle passed to Go code run by RunFunc: a transaction,
+// or a plain connection when the code runs outside of one
+type DB interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Func is Go code run against a database by RunFunc
+type Func func(ctx context.Context, db DB) error
+
+// RunFunc calls fn with a dedicated connection opened in-process. With
+// transaction set, fn runs in a transaction that is committed if it returns
+// nil and rolled back otherwise. The name identifies fn in verbose output.
+func (e *OSExecutor) RunFunc(ctx context.Context, dbURL, name string, transaction bool, fn Func) error {
+	if e.verbose {
+		fmt.Fprintf(e.stderr, "=> go %s\n", name)
+	}
+
+	config, err := pgx.ParseConfig(dbURL)
+	if err != nil {
+		return fmt.Errorf("invalid database URL: %w", err)
+	}
+	config.RuntimeParams["application_name"] = "seedup"
+
+	conn, err := pgx.ConnectConfig(ctx, config)
+	if err != nil {
+		return fmt.Errorf("connecting to database: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	if !transaction {
+		return fn(ctx, conn)
+	}
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		return fn(ctx, tx)
+	})
+}
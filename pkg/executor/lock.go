@@ -0,0 +1,45 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// TryAdvisoryLock attempts to take a session-level advisory lock without
+// waiting. The lock is held on a dedicated connection opened in-process,
+// since a psql process cannot keep its session open across commands; unlock
+// closes that connection. When the lock is not acquired no connection is kept.
+func (e *OSExecutor) TryAdvisoryLock(ctx context.Context, dbURL string, key int64) (func() error, bool, error) {
+	query := fmt.Sprintf("SELECT pg_try_advisory_lock(%d)", key)
+	if e.verbose {
+		fmt.Fprintf(e.stderr, "=> %s\n", query)
+	}
+
+	config, err := pgconn.ParseConfig(dbURL)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid database URL: %w", err)
+	}
+	config.RuntimeParams["application_name"] = "seedup"
+
+	conn, err := pgconn.ConnectConfig(ctx, config)
+	if err != nil {
+		return nil, false, fmt.Errorf("connecting to database: %w", err)
+	}
+
+	results, err := conn.Exec(ctx, query).ReadAll()
+	if err != nil {
+		conn.Close(context.Background())
+		return nil, false, err
+	}
+	if len(results) == 0 || len(results[0].Rows) == 0 || string(results[0].Rows[0][0]) != "t" {
+		conn.Close(context.Background())
+		return nil, false, nil
+	}
+
+	unlock := func() error {
+		return conn.Close(context.Background())
+	}
+	return unlock, true, nil
+}
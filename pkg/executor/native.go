@@ -0,0 +1,185 @@
+package executor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// NativeExecutor implements Executor using an in-process PostgreSQL driver.
+// SQL queries, COPY and scripts run over pgx without spawning psql; other
+// commands (pg_dump, git, ...) are delegated to an embedded OSExecutor.
+type NativeExecutor struct {
+	*OSExecutor
+}
+
+// NewNative creates a new NativeExecutor with the given options
+func NewNative(opts ...Option) *NativeExecutor {
+	return &NativeExecutor{OSExecutor: New(opts...)}
+}
+
+// RunSQL executes a SQL query and returns its rows formatted like `psql -t`
+func (e *NativeExecutor) RunSQL(ctx context.Context, dbURL, query string) (string, error) {
+	if e.verbose {
+		fmt.Fprintf(e.stderr, "=> %s\n", Redact(strings.TrimSpace(query)))
+	}
+
+	conn, err := e.connect(ctx, dbURL)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close(context.Background())
+
+	results, err := conn.Exec(ctx, query).ReadAll()
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	for _, result := range results {
+		for _, row := range result.Rows {
+			values := make([]string, len(row))
+			for i, v := range row {
+				values[i] = string(v)
+			}
+			out.WriteString(" " + strings.Join(values, " | ") + "\n")
+		}
+	}
+
+	return out.String(), nil
+}
+
+// Query executes a single SELECT query and returns its rows in text format
+func (e *NativeExecutor) Query(ctx context.Context, dbURL, query string) (*Result, error) {
+	if e.verbose {
+		fmt.Fprintf(e.stderr, "=> %s\n", Redact(strings.TrimSpace(query)))
+	}
+
+	conn, err := e.connect(ctx, dbURL)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(context.Background())
+
+	res := conn.ExecParams(ctx, query, nil, nil, nil, nil).Read()
+	if res.Err != nil {
+		return nil, res.Err
+	}
+
+	result := &Result{}
+	for _, fd := range res.FieldDescriptions {
+		result.Columns = append(result.Columns, fd.Name)
+	}
+	for _, row := range res.Rows {
+		values := make([]sql.NullString, len(row))
+		for i, v := range row {
+			values[i] = sql.NullString{String: string(v), Valid: v != nil}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+
+	return result, nil
+}
+
+// RunSQLFile executes a SQL file in a single session, stopping at the first error.
+// The psql meta-commands \copy and \echo are supported; result rows of
+// statements in the file are discarded.
+func (e *NativeExecutor) RunSQLFile(ctx context.Context, dbURL, filePath string) error {
+	if e.verbose {
+		fmt.Fprintf(e.stderr, "=> \\i %s\n", filePath)
+	}
+
+	script, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("reading SQL file: %w", err)
+	}
+
+	conn, err := e.connect(ctx, dbURL)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	for _, cmd := range SplitScript(string(script)) {
+		if cmd.Meta {
+			err = e.runMetaCommand(ctx, conn, cmd.Text)
+		} else {
+			_, err = conn.Exec(ctx, cmd.Text).ReadAll()
+		}
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", filePath, cmd.Line, err)
+		}
+	}
+
+	return nil
+}
+
+// connect opens a connection that reports server notices on stderr like psql
+func (e *NativeExecutor) connect(ctx context.Context, dbURL string) (*pgconn.PgConn, error) {
+	config, err := pgconn.ParseConfig(dbURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database URL: %w", err)
+	}
+	config.OnNotice = func(_ *pgconn.PgConn, n *pgconn.Notice) {
+		fmt.Fprintf(e.stderr, "%s:  %s\n", n.Severity, Redact(n.Message))
+	}
+
+	conn, err := pgconn.ConnectConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to database: %w", err)
+	}
+	return conn, nil
+}
+
+var copyMetaRe = regexp.MustCompile(`(?is)^\\copy\s+(.+?)\s+(from|to)\s+'((?:[^']|'')*)'\s*(.*?)\s*;?\s*$`)
+
+func (e *NativeExecutor) runMetaCommand(ctx context.Context, conn *pgconn.PgConn, text string) error {
+	name, rest, _ := strings.Cut(text, " ")
+	switch strings.ToLower(name) {
+	case `\echo`:
+		fmt.Fprintln(e.stdout, strings.TrimSpace(rest))
+		return nil
+	case `\set`:
+		// Variables such as ON_ERROR_STOP have no effect: execution always stops on error
+		return nil
+	case `\copy`:
+		return e.runCopy(ctx, conn, text)
+	default:
+		return fmt.Errorf("unsupported psql meta-command %s", name)
+	}
+}
+
+// runCopy translates a client-side \copy into COPY ... FROM STDIN / TO STDOUT
+func (e *NativeExecutor) runCopy(ctx context.Context, conn *pgconn.PgConn, text string) error {
+	m := copyMetaRe.FindStringSubmatch(text)
+	if m == nil {
+		return fmt.Errorf("unsupported \\copy syntax: %s", text)
+	}
+	target, direction, path, options := m[1], strings.ToLower(m[2]), strings.ReplaceAll(m[3], "''", "'"), m[4]
+
+	if direction == "from" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = conn.CopyFrom(ctx, f, fmt.Sprintf("COPY %s FROM STDIN %s", target, options))
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.CopyTo(ctx, f, fmt.Sprintf("COPY %s TO STDOUT %s", target, options)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,153 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Planner implements Executor by printing the ordered list of operations that
+// would be performed instead of performing them. Read-only operations (Query
+// and RunWithOutput) are delegated to the wrapped executor so the plan reflects
+// the current database state; databases the plan drops are treated as empty.
+type Planner struct {
+	exec    Executor
+	out     io.Writer
+	mu      sync.Mutex
+	step    int
+	dropped map[string]bool
+}
+
+// Noter is implemented by executors that describe operations instead of
+// performing them, such as the Planner. Code whose later steps depend on
+// output the plan does not produce notes those steps rather than running them.
+type Noter interface {
+	Note(header string)
+}
+
+// NewPlanner creates a new Planner that prints to out and reads through exec
+func NewPlanner(exec Executor, out io.Writer) *Planner {
+	return &Planner{
+		exec:    exec,
+		out:     out,
+		dropped: make(map[string]bool),
+	}
+}
+
+// print writes a numbered plan entry with an optional indented body
+func (p *Planner) print(header, body string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.step++
+	fmt.Fprintf(p.out, "%d. %s\n", p.step, Redact(header))
+	body = strings.TrimSpace(Redact(body))
+	if body == "" {
+		return
+	}
+	for _, line := range strings.Split(body, "\n") {
+		fmt.Fprintf(p.out, "     %s\n", line)
+	}
+}
+
+func (p *Planner) Run(ctx context.Context, name string, args ...string) error {
+	p.print("exec "+formatCommand(name, args), "")
+	return nil
+}
+
+func (p *Planner) RunWithOutput(ctx context.Context, name string, args ...string) (string, error) {
+	return p.exec.RunWithOutput(ctx, name, args...)
+}
+
+func (p *Planner) RunWithStdin(ctx context.Context, stdin io.Reader, name string, args ...string) error {
+	data, err := io.ReadAll(stdin)
+	if err != nil {
+		return fmt.Errorf("reading stdin: %w", err)
+	}
+	p.print("exec "+formatCommand(name, args)+" (stdin below)", string(data))
+	return nil
+}
+
+var dropDatabaseRe = regexp.MustCompile(`(?i)^\s*DROP\s+DATABASE\s+(?:IF\s+EXISTS\s+)?("(?:[^"]|"")+"|[^\s;]+)`)
+
+func (p *Planner) RunSQL(ctx context.Context, dbURL, query string) (string, error) {
+	if m := dropDatabaseRe.FindStringSubmatch(query); m != nil {
+		name := m[1]
+		if strings.HasPrefix(name, `"`) {
+			name = strings.ReplaceAll(name[1:len(name)-1], `""`, `"`)
+		}
+		p.mu.Lock()
+		p.dropped[name] = true
+		p.mu.Unlock()
+	}
+
+	p.print("sql "+dbURL, query)
+	return "", nil
+}
+
+func (p *Planner) Query(ctx context.Context, dbURL, query string) (*Result, error) {
+	if p.isDropped(dbURL) {
+		return &Result{}, nil
+	}
+	return p.exec.Query(ctx, dbURL, query)
+}
+
+func (p *Planner) RunSQLFile(ctx context.Context, dbURL, filePath string) error {
+	script, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("reading SQL file: %w", err)
+	}
+	p.print("sql "+dbURL+" (script)", string(script))
+	return nil
+}
+
+func (p *Planner) WriteFile(path string, data []byte) error {
+	p.print(fmt.Sprintf("write %s (%d bytes)", path, len(data)), "")
+	return nil
+}
+
+func (p *Planner) Remove(path string) error {
+	p.print("remove "+path, "")
+	return nil
+}
+
+// RunFunc prints the Go code's name without running it
+func (p *Planner) RunFunc(ctx context.Context, dbURL, name string, transaction bool, fn Func) error {
+	p.print("go "+dbURL+" ("+name+")", "")
+	return nil
+}
+
+// Note adds an entry describing an operation whose details are only known
+// once earlier steps have run, such as files produced by a command
+func (p *Planner) Note(header string) {
+	p.print(header, "")
+}
+
+// TryAdvisoryLock prints the lock and reports it as acquired without taking it
+func (p *Planner) TryAdvisoryLock(ctx context.Context, dbURL string, key int64) (func() error, bool, error) {
+	p.print("lock "+dbURL, fmt.Sprintf("SELECT pg_try_advisory_lock(%d)", key))
+	return func() error {
+		p.print("unlock "+dbURL, fmt.Sprintf("SELECT pg_advisory_unlock(%d)", key))
+		return nil
+	}, true, nil
+}
+
+// isDropped reports whether the database of dbURL was dropped earlier in the plan
+func (p *Planner) isDropped(dbURL string) bool {
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dropped[strings.TrimPrefix(u.Path, "/")]
+}
+
+func formatCommand(name string, args []string) string {
+	return strings.TrimSpace(name + " " + strings.Join(args, " "))
+}
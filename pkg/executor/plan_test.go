@@ -0,0 +1,92 @@
+package executor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlannerPrintsWrites(t *testing.T) {
+	ctx := context.Background()
+	dbURL := "postgres://app:s3cret@db/app"
+	script := filepath.Join(t.TempDir(), "script.sql")
+	if err := os.WriteFile(script, []byte("CREATE TABLE t (id int);\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The wrapped executor fails every call, so any write reaching it fails the test
+	var out strings.Builder
+	p := NewPlanner(&stubExecutor{err: errors.New("wrapped executor called")}, &out)
+
+	if err := p.Run(ctx, "createdb", "app"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.RunSQL(ctx, dbURL, "CREATE USER app WITH PASSWORD 's3cret'"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RunSQLFile(ctx, dbURL, script); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.WriteFile("seed/dev/public.t.csv", []byte("id\n1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Remove("migrations/00001_init.sql"); err != nil {
+		t.Fatal(err)
+	}
+	unlock, ok, err := p.TryAdvisoryLock(ctx, dbURL, 42)
+	if err != nil || !ok {
+		t.Fatalf("TryAdvisoryLock = %v, %v", ok, err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	var noter Noter = p
+	noter.Note("replace seed/dev/*.csv with the extracted files")
+
+	want := `1. exec createdb app
+2. sql postgres://app:xxxxx@db/app
+     CREATE USER app WITH PASSWORD 'xxxxx'
+3. sql postgres://app:xxxxx@db/app (script)
+     CREATE TABLE t (id int);
+4. write seed/dev/public.t.csv (5 bytes)
+5. remove migrations/00001_init.sql
+6. lock postgres://app:xxxxx@db/app
+     SELECT pg_try_advisory_lock(42)
+7. unlock postgres://app:xxxxx@db/app
+     SELECT pg_advisory_unlock(42)
+8. replace seed/dev/*.csv with the extracted files
+`
+	if out.String() != want {
+		t.Errorf("plan:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestPlannerReadsThrough(t *testing.T) {
+	ctx := context.Background()
+	result := &Result{Columns: []string{"n"}, Rows: [][]sql.NullString{{{String: "1", Valid: true}}}}
+
+	var out strings.Builder
+	p := NewPlanner(&stubExecutor{output: "dump", result: result}, &out)
+
+	if got, err := p.RunWithOutput(ctx, "pg_dump", "postgres://db/app"); err != nil || got != "dump" {
+		t.Errorf("RunWithOutput = %q, %v, want the wrapped executor's output", got, err)
+	}
+	if got, err := p.Query(ctx, "postgres://db/app", "SELECT 1"); err != nil || len(got.Rows) != 1 {
+		t.Errorf("Query = %v, %v, want the wrapped executor's result", got, err)
+	}
+
+	// Once the plan drops a database, reads from it see an empty database
+	if _, err := p.RunSQL(ctx, "postgres://db/postgres", `DROP DATABASE IF EXISTS "app"`); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := p.Query(ctx, "postgres://db/app", "SELECT 1"); err != nil || len(got.Rows) != 0 {
+		t.Errorf("Query after drop = %v, %v, want no rows", got, err)
+	}
+	if got, err := p.Query(ctx, "postgres://db/other", "SELECT 1"); err != nil || len(got.Rows) != 1 {
+		t.Errorf("Query of another database = %v, %v, want the wrapped executor's result", got, err)
+	}
+}
@@ -0,0 +1,414 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Call is a single executor call captured in a transcript
+type Call struct {
+	Method  string      `json:"method"`
+	Name    string      `json:"name,omitempty"`
+	Args    []string    `json:"args,omitempty"`
+	Stdin   string      `json:"stdin,omitempty"`
+	Data    string      `json:"data,omitempty"` // File contents for WriteFile
+	DBURL   string      `json:"db_url,omitempty"`
+	SQL     string      `json:"sql,omitempty"` // Query text, or file contents for RunSQLFile
+	Output  string      `json:"output,omitempty"`
+	Columns []string    `json:"columns,omitempty"`
+	Rows    [][]*string `json:"rows,omitempty"` // nil elements are NULL
+	Error   string      `json:"error,omitempty"`
+
+	// Files written by a RunSQLFile script through \copy ... TO, by path
+	Files map[string]string `json:"files,omitempty"`
+}
+
+// Transcript is the ordered list of calls made through a Recorder
+type Transcript struct {
+	Calls []Call `json:"calls"`
+}
+
+// LoadTranscript reads a transcript from a JSON file
+func LoadTranscript(path string) (*Transcript, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading transcript: %w", err)
+	}
+
+	var t Transcript
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("parsing transcript %s: %w", path, err)
+	}
+	return &t, nil
+}
+
+// Save writes the transcript to a JSON file
+func (t *Transcript) Save(path string) error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating transcript directory: %w", err)
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Recorder wraps an Executor and captures every call into a Transcript
+type Recorder struct {
+	exec       Executor
+	mu         sync.Mutex
+	transcript Transcript
+}
+
+// NewRecorder creates a new Recorder that delegates to exec
+func NewRecorder(exec Executor) *Recorder {
+	return &Recorder{exec: exec}
+}
+
+// Transcript returns a copy of the calls recorded so far
+func (r *Recorder) Transcript() *Transcript {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Transcript{Calls: append([]Call(nil), r.transcript.Calls...)}
+}
+
+// Save writes the recorded transcript to a JSON file
+func (r *Recorder) Save(path string) error {
+	return r.Transcript().Save(path)
+}
+
+func (r *Recorder) record(call Call, err error) {
+	if err != nil {
+		call.Error = Redact(err.Error())
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transcript.Calls = append(r.transcript.Calls, normalizeCall(call))
+}
+
+func (r *Recorder) Run(ctx context.Context, name string, args ...string) error {
+	err := r.exec.Run(ctx, name, args...)
+	r.record(Call{Method: "Run", Name: name, Args: args}, err)
+	return err
+}
+
+func (r *Recorder) RunWithOutput(ctx context.Context, name string, args ...string) (string, error) {
+	output, err := r.exec.RunWithOutput(ctx, name, args...)
+	r.record(Call{Method: "RunWithOutput", Name: name, Args: args, Output: output}, err)
+	return output, err
+}
+
+func (r *Recorder) RunWithStdin(ctx context.Context, stdin io.Reader, name string, args ...string) error {
+	data, err := io.ReadAll(stdin)
+	if err != nil {
+		return fmt.Errorf("reading stdin: %w", err)
+	}
+	err = r.exec.RunWithStdin(ctx, bytes.NewReader(data), name, args...)
+	r.record(Call{Method: "RunWithStdin", Name: name, Args: args, Stdin: string(data)}, err)
+	return err
+}
+
+func (r *Recorder) RunSQL(ctx context.Context, dbURL, query string) (string, error) {
+	output, err := r.exec.RunSQL(ctx, dbURL, query)
+	r.record(Call{Method: "RunSQL", DBURL: dbURL, SQL: query, Output: output}, err)
+	return output, err
+}
+
+func (r *Recorder) Query(ctx context.Context, dbURL, query string) (*Result, error) {
+	result, err := r.exec.Query(ctx, dbURL, query)
+	call := Call{Method: "Query", DBURL: dbURL, SQL: query}
+	if result != nil {
+		call.Columns, call.Rows = encodeRows(result)
+	}
+	r.record(call, err)
+	return result, err
+}
+
+func (r *Recorder) RunSQLFile(ctx context.Context, dbURL, filePath string) error {
+	script, readErr := os.ReadFile(filePath)
+	err := r.exec.RunSQLFile(ctx, dbURL, filePath)
+	call := Call{Method: "RunSQLFile", DBURL: dbURL, Args: []string{filePath}}
+	if readErr == nil {
+		call.SQL = string(script)
+		if err == nil {
+			call.Files = readCopyTargets(call.SQL)
+		}
+	}
+	r.record(call, err)
+	return err
+}
+
+func (r *Recorder) WriteFile(path string, data []byte) error {
+	err := r.exec.WriteFile(path, data)
+	r.record(Call{Method: "WriteFile", Args: []string{path}, Data: string(data)}, err)
+	return err
+}
+
+func (r *Recorder) Remove(path string) error {
+	err := r.exec.Remove(path)
+	r.record(Call{Method: "Remove", Args: []string{path}}, err)
+	return err
+}
+
+func (r *Recorder) RunFunc(ctx context.Context, dbURL, name string, transaction bool, fn Func) error {
+	err := r.exec.RunFunc(ctx, dbURL, name, transaction, fn)
+	r.record(Call{Method: "RunFunc", DBURL: dbURL, Name: name}, err)
+	return err
+}
+
+func (r *Recorder) TryAdvisoryLock(ctx context.Context, dbURL string, key int64) (func() error, bool, error) {
+	unlock, acquired, err := r.exec.TryAdvisoryLock(ctx, dbURL, key)
+	r.record(Call{Method: "TryAdvisoryLock", DBURL: dbURL, SQL: fmt.Sprint(key), Output: fmt.Sprint(acquired)}, err)
+	if !acquired {
+		return unlock, acquired, err
+	}
+	return func() error {
+		err := unlock()
+		r.record(Call{Method: "AdvisoryUnlock", DBURL: dbURL, SQL: fmt.Sprint(key)}, err)
+		return err
+	}, true, nil
+}
+
+// Replayer implements Executor by serving the outputs of a recorded Transcript.
+// Calls must arrive in the recorded order; any other call fails.
+// File writes and removals are matched but not performed; files written by
+// the \copy commands of a SQL file are recreated, as the caller may read them.
+type Replayer struct {
+	mu         sync.Mutex
+	transcript *Transcript
+	next       int
+}
+
+// NewReplayer creates a new Replayer for the given transcript
+func NewReplayer(t *Transcript) *Replayer {
+	return &Replayer{transcript: t}
+}
+
+// Done returns an error if any recorded calls were not replayed
+func (r *Replayer) Done() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if remaining := len(r.transcript.Calls) - r.next; remaining > 0 {
+		return fmt.Errorf("%d recorded call(s) not replayed, next: %s", remaining, describeCall(r.transcript.Calls[r.next]))
+	}
+	return nil
+}
+
+// replay matches call against the next recorded call and returns it
+func (r *Replayer) replay(call Call) (Call, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	call = normalizeCall(call)
+	if r.next >= len(r.transcript.Calls) {
+		return Call{}, fmt.Errorf("unexpected call %s: transcript exhausted", describeCall(call))
+	}
+
+	want := r.transcript.Calls[r.next]
+	got := want
+	got.Method, got.Name, got.Args, got.Stdin, got.Data, got.DBURL, got.SQL =
+		call.Method, call.Name, call.Args, call.Stdin, call.Data, call.DBURL, call.SQL
+	if !reflect.DeepEqual(got, want) {
+		return Call{}, fmt.Errorf("unexpected call %s: expected %s", describeCall(call), describeCall(want))
+	}
+	r.next++
+
+	if want.Error != "" {
+		return want, errors.New(want.Error)
+	}
+	return want, nil
+}
+
+func (r *Replayer) Run(ctx context.Context, name string, args ...string) error {
+	_, err := r.replay(Call{Method: "Run", Name: name, Args: args})
+	return err
+}
+
+func (r *Replayer) RunWithOutput(ctx context.Context, name string, args ...string) (string, error) {
+	call, err := r.replay(Call{Method: "RunWithOutput", Name: name, Args: args})
+	if err != nil {
+		return "", err
+	}
+	return call.Output, nil
+}
+
+func (r *Replayer) RunWithStdin(ctx context.Context, stdin io.Reader, name string, args ...string) error {
+	data, err := io.ReadAll(stdin)
+	if err != nil {
+		return fmt.Errorf("reading stdin: %w", err)
+	}
+	_, err = r.replay(Call{Method: "RunWithStdin", Name: name, Args: args, Stdin: string(data)})
+	return err
+}
+
+func (r *Replayer) RunSQL(ctx context.Context, dbURL, query string) (string, error) {
+	call, err := r.replay(Call{Method: "RunSQL", DBURL: dbURL, SQL: query})
+	if err != nil {
+		return "", err
+	}
+	return call.Output, nil
+}
+
+func (r *Replayer) Query(ctx context.Context, dbURL, query string) (*Result, error) {
+	call, err := r.replay(Call{Method: "Query", DBURL: dbURL, SQL: query})
+	if err != nil {
+		return nil, err
+	}
+	return decodeRows(call.Columns, call.Rows), nil
+}
+
+func (r *Replayer) RunSQLFile(ctx context.Context, dbURL, filePath string) error {
+	script, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("reading SQL file: %w", err)
+	}
+	call, err := r.replay(Call{Method: "RunSQLFile", DBURL: dbURL, Args: []string{filePath}, SQL: string(script)})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range copyTargets(string(script)) {
+		data, ok := call.Files[normalize(path)]
+		if !ok {
+			return fmt.Errorf("replaying %s: no recorded contents for %s", filePath, path)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			return fmt.Errorf("replaying %s: %w", filePath, err)
+		}
+	}
+	return nil
+}
+
+func (r *Replayer) WriteFile(path string, data []byte) error {
+	_, err := r.replay(Call{Method: "WriteFile", Args: []string{path}, Data: string(data)})
+	return err
+}
+
+func (r *Replayer) Remove(path string) error {
+	_, err := r.replay(Call{Method: "Remove", Args: []string{path}})
+	return err
+}
+
+// RunFunc matches the call without running the Go code
+func (r *Replayer) RunFunc(ctx context.Context, dbURL, name string, transaction bool, fn Func) error {
+	_, err := r.replay(Call{Method: "RunFunc", DBURL: dbURL, Name: name})
+	return err
+}
+
+func (r *Replayer) TryAdvisoryLock(ctx context.Context, dbURL string, key int64) (func() error, bool, error) {
+	call, err := r.replay(Call{Method: "TryAdvisoryLock", DBURL: dbURL, SQL: fmt.Sprint(key)})
+	if err != nil || call.Output != "true" {
+		return nil, false, err
+	}
+	return func() error {
+		_, err := r.replay(Call{Method: "AdvisoryUnlock", DBURL: dbURL, SQL: fmt.Sprint(key)})
+		return err
+	}, true, nil
+}
+
+// tempPathRe matches paths created by os.CreateTemp/os.MkdirTemp, whose
+// random numeric suffix would otherwise make transcripts non-deterministic
+var tempPathRe = regexp.MustCompile(regexp.QuoteMeta(os.TempDir()) + `/([^/\s'"]*?)\d+`)
+
+// normalize makes s deterministic and free of credentials
+func normalize(s string) string {
+	return Redact(tempPathRe.ReplaceAllString(s, "$$TMPDIR/${1}*"))
+}
+
+func normalizeCall(call Call) Call {
+	if len(call.Args) == 0 {
+		call.Args = nil
+	} else {
+		args := make([]string, len(call.Args))
+		for i, arg := range call.Args {
+			args[i] = normalize(arg)
+		}
+		call.Args = args
+	}
+	call.DBURL = normalize(call.DBURL)
+	call.Stdin = normalize(call.Stdin)
+	call.Data = normalize(call.Data)
+	call.SQL = normalize(call.SQL)
+	return call
+}
+
+// copyTargets returns the files a psql script writes through \copy ... TO
+func copyTargets(script string) []string {
+	var paths []string
+	for _, cmd := range SplitScript(script) {
+		if !cmd.Meta {
+			continue
+		}
+		if m := copyMetaRe.FindStringSubmatch(cmd.Text); m != nil && strings.EqualFold(m[2], "to") {
+			paths = append(paths, strings.ReplaceAll(m[3], "''", "'"))
+		}
+	}
+	return paths
+}
+
+// readCopyTargets reads the files a psql script wrote through \copy ... TO
+func readCopyTargets(script string) map[string]string {
+	var files map[string]string
+	for _, path := range copyTargets(script) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if files == nil {
+			files = make(map[string]string)
+		}
+		files[normalize(path)] = normalize(string(data))
+	}
+	return files
+}
+
+func describeCall(call Call) string {
+	switch {
+	case call.Name != "":
+		return fmt.Sprintf("%s(%s %s)", call.Method, call.Name, strings.Join(call.Args, " "))
+	case call.SQL != "":
+		return fmt.Sprintf("%s(%q)", call.Method, strings.TrimSpace(call.SQL))
+	default:
+		return fmt.Sprintf("%s(%s)", call.Method, strings.Join(call.Args, " "))
+	}
+}
+
+func encodeRows(result *Result) ([]string, [][]*string) {
+	rows := make([][]*string, len(result.Rows))
+	for i, row := range result.Rows {
+		rows[i] = make([]*string, len(row))
+		for j, v := range row {
+			if v.Valid {
+				s := v.String
+				rows[i][j] = &s
+			}
+		}
+	}
+	return result.Columns, rows
+}
+
+func decodeRows(columns []string, rows [][]*string) *Result {
+	result := &Result{Columns: columns}
+	for _, row := range rows {
+		values := make([]sql.NullString, len(row))
+		for i, v := range row {
+			if v != nil {
+				values[i] = sql.NullString{String: *v, Valid: true}
+			}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	return result
+}
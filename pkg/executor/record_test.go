@@ -0,0 +1,251 @@
+package executor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// stubExecutor answers every call with the same canned values
+type stubExecutor struct {
+	output string
+	result *Result
+	err    error
+}
+
+func (s *stubExecutor) Run(ctx context.Context, name string, args ...string) error { return s.err }
+func (s *stubExecutor) RunWithOutput(ctx context.Context, name string, args ...string) (string, error) {
+	return s.output, s.err
+}
+func (s *stubExecutor) RunWithStdin(ctx context.Context, stdin io.Reader, name string, args ...string) error {
+	return s.err
+}
+func (s *stubExecutor) RunSQL(ctx context.Context, dbURL, query string) (string, error) {
+	return s.output, s.err
+}
+func (s *stubExecutor) Query(ctx context.Context, dbURL, query string) (*Result, error) {
+	return s.result, s.err
+}
+func (s *stubExecutor) RunSQLFile(ctx context.Context, dbURL, filePath string) error { return s.err }
+func (s *stubExecutor) WriteFile(path string, data []byte) error                     { return s.err }
+func (s *stubExecutor) Remove(path string) error                                     { return s.err }
+func (s *stubExecutor) TryAdvisoryLock(ctx context.Context, dbURL string, key int64) (func() error, bool, error) {
+	return func() error { return nil }, s.err == nil, s.err
+}
+func (s *stubExecutor) RunFunc(ctx context.Context, dbURL, name string, transaction bool, fn Func) error {
+	return s.err
+}
+
+func TestNormalize(t *testing.T) {
+	tmp := os.TempDir()
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{filepath.Join(tmp, "migration-123456.sql"), "$TMPDIR/migration-*.sql"},
+		{filepath.Join(tmp, "dbkit-seed-42", "public.users.csv"), "$TMPDIR/dbkit-seed-*/public.users.csv"},
+		{filepath.Join(tmp, "TestCreate987", "001", "seed"), "$TMPDIR/TestCreate*/001/seed"},
+		{"\\copy t TO '" + filepath.Join(tmp, "x7", "t.csv") + "' CSV", "\\copy t TO '$TMPDIR/x*/t.csv' CSV"},
+		{"/srv/migrations/00001_init.sql", "/srv/migrations/00001_init.sql"},
+		{"postgres://app:s3cret@db/app", "postgres://app:xxxxx@db/app"},
+	}
+
+	for _, tt := range tests {
+		if got := normalize(tt.in); got != tt.want {
+			t.Errorf("normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	ctx := context.Background()
+	dbURL := "postgres://app:s3cret@db/app"
+	result := &Result{
+		Columns: []string{"id", "name"},
+		Rows:    [][]sql.NullString{{{String: "1", Valid: true}, {}}},
+	}
+
+	recorder := NewRecorder(&stubExecutor{output: "dump", result: result})
+	if _, err := recorder.RunWithOutput(ctx, "pg_dump", dbURL, "--schema-only"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := recorder.Query(ctx, dbURL, "SELECT id, name FROM t"); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.RunWithStdin(ctx, strings.NewReader("input"), "dbml", "-"); err != nil {
+		t.Fatal(err)
+	}
+	unlock, acquired, err := recorder.TryAdvisoryLock(ctx, dbURL, 42)
+	if err != nil || !acquired {
+		t.Fatalf("TryAdvisoryLock: %v, %v", acquired, err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "transcript.json")
+	if err := recorder.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "s3cret") {
+		t.Errorf("transcript contains the password:\n%s", data)
+	}
+
+	transcript, err := LoadTranscript(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayer := NewReplayer(transcript)
+
+	output, err := replayer.RunWithOutput(ctx, "pg_dump", dbURL, "--schema-only")
+	if err != nil || output != "dump" {
+		t.Errorf("RunWithOutput = %q, %v; want %q", output, err, "dump")
+	}
+	got, err := replayer.Query(ctx, dbURL, "SELECT id, name FROM t")
+	if err != nil || !reflect.DeepEqual(got, result) {
+		t.Errorf("Query = %+v, %v; want %+v", got, err, result)
+	}
+	if err := replayer.RunWithStdin(ctx, strings.NewReader("input"), "dbml", "-"); err != nil {
+		t.Errorf("RunWithStdin: %v", err)
+	}
+	unlock, acquired, err = replayer.TryAdvisoryLock(ctx, dbURL, 42)
+	if err != nil || !acquired {
+		t.Fatalf("TryAdvisoryLock = %v, %v", acquired, err)
+	}
+	if err := unlock(); err != nil {
+		t.Errorf("unlock: %v", err)
+	}
+	if err := replayer.Done(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReplayRecordedError(t *testing.T) {
+	ctx := context.Background()
+	recorder := NewRecorder(&stubExecutor{err: errors.New("connection to postgres://app:s3cret@db/app refused")})
+	if _, err := recorder.RunSQL(ctx, "postgres://app@db/app", "SELECT 1"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	replayer := NewReplayer(recorder.Transcript())
+	_, err := replayer.RunSQL(ctx, "postgres://app@db/app", "SELECT 1")
+	if err == nil || err.Error() != "connection to postgres://app:xxxxx@db/app refused" {
+		t.Errorf("RunSQL error = %v, want the recorded, redacted error", err)
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	ctx := context.Background()
+	transcript := &Transcript{Calls: []Call{
+		{Method: "RunSQL", DBURL: "postgres://db/app", SQL: "SELECT 1"},
+		{Method: "Run", Name: "psql", Args: []string{"-c", "SELECT 2"}},
+	}}
+
+	tests := []struct {
+		name string
+		call func(r *Replayer) error
+		want string
+	}{
+		{
+			name: "different method",
+			call: func(r *Replayer) error {
+				_, err := r.Query(ctx, "postgres://db/app", "SELECT 1")
+				return err
+			},
+			want: `unexpected call Query("SELECT 1"): expected RunSQL("SELECT 1")`,
+		},
+		{
+			name: "different SQL",
+			call: func(r *Replayer) error {
+				_, err := r.RunSQL(ctx, "postgres://db/app", "SELECT 3")
+				return err
+			},
+			want: `unexpected call RunSQL("SELECT 3"): expected RunSQL("SELECT 1")`,
+		},
+		{
+			name: "different database",
+			call: func(r *Replayer) error {
+				_, err := r.RunSQL(ctx, "postgres://db/other", "SELECT 1")
+				return err
+			},
+			want: `unexpected call RunSQL("SELECT 1"): expected RunSQL("SELECT 1")`,
+		},
+		{
+			name: "out of order",
+			call: func(r *Replayer) error {
+				return r.Run(ctx, "psql", "-c", "SELECT 2")
+			},
+			want: `unexpected call Run(psql -c SELECT 2): expected RunSQL("SELECT 1")`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replayer := NewReplayer(transcript)
+			err := tt.call(replayer)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+			// A mismatched call is not consumed
+			if err := replayer.Done(); err == nil || !strings.Contains(err.Error(), "2 recorded call(s) not replayed") {
+				t.Errorf("Done() = %v, want 2 calls not replayed", err)
+			}
+		})
+	}
+
+	t.Run("exhausted", func(t *testing.T) {
+		replayer := NewReplayer(&Transcript{})
+		err := replayer.Remove("/tmp/x")
+		if err == nil || err.Error() != "unexpected call Remove(/tmp/x): transcript exhausted" {
+			t.Errorf("got error %v, want transcript exhausted", err)
+		}
+		if err := replayer.Done(); err != nil {
+			t.Errorf("Done() = %v", err)
+		}
+	})
+}
+
+func TestReplayCopyTargets(t *testing.T) {
+	dir := t.TempDir()
+	csv := filepath.Join(dir, "users.csv")
+	script := filepath.Join(dir, "export.sql")
+	content := "\\copy users TO '" + csv + "' CSV HEADER\n\\copy posts FROM 'posts.csv' CSV\n"
+	if err := os.WriteFile(script, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// psql would write the CSV while running the script
+	if err := os.WriteFile(csv, []byte("id\n1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	recorder := NewRecorder(&stubExecutor{})
+	if err := recorder.RunSQLFile(context.Background(), "postgres://db/app", script); err != nil {
+		t.Fatal(err)
+	}
+	call := recorder.Transcript().Calls[0]
+	if want := map[string]string{normalize(csv): "id\n1\n"}; !reflect.DeepEqual(call.Files, want) {
+		t.Errorf("recorded files = %v, want %v", call.Files, want)
+	}
+
+	if err := os.Remove(csv); err != nil {
+		t.Fatal(err)
+	}
+	replayer := NewReplayer(recorder.Transcript())
+	if err := replayer.RunSQLFile(context.Background(), "postgres://db/app", script); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(csv)
+	if err != nil || string(data) != "id\n1\n" {
+		t.Errorf("replayed file = %q, %v; want the recorded contents", data, err)
+	}
+}
@@ -0,0 +1,50 @@
+package executor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"postgres://app:s3cret@db:5432/app", "postgres://app:xxxxx@db:5432/app"},
+		{"postgresql://app@db/app", "postgresql://app@db/app"},
+		{"connecting to postgres://a:b@h/d and postgres://c:d@h/e", "connecting to postgres://a:xxxxx@h/d and postgres://c:xxxxx@h/e"},
+		{"postgres://app@db/app?sslmode=disable&password=s3cret", "postgres://app@db/app?sslmode=disable&password=xxxxx"},
+		{"host=db user=app password=s3cret dbname=app", "host=db user=app password=xxxxx dbname=app"},
+		{"host=db password = 'with space\\'s' dbname=app", "host=db password = xxxxx dbname=app"},
+		{"PGPASSWORD=s3cret psql", "PGPASSWORD=xxxxx psql"},
+		{"CREATE USER app WITH PASSWORD 's3cret'", "CREATE USER app WITH PASSWORD 'xxxxx'"},
+		{"ALTER ROLE app PASSWORD 'it''s'", "ALTER ROLE app PASSWORD 'xxxxx'"},
+		{"SELECT 1", "SELECT 1"},
+	}
+
+	for _, tt := range tests {
+		if got := Redact(tt.in); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactingWriter(t *testing.T) {
+	var out strings.Builder
+	w := newRedactingWriter(&out)
+
+	// A secret split across writes is still redacted
+	w.Write([]byte("url: postgres://app:s3"))
+	w.Write([]byte("cret@db/app\npartial password="))
+	if got, want := out.String(), "url: postgres://app:xxxxx@db/app\n"; got != want {
+		t.Errorf("before Flush: got %q, want %q", got, want)
+	}
+
+	w.Write([]byte("s3cret"))
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "url: postgres://app:xxxxx@db/app\npartial password=xxxxx"; got != want {
+		t.Errorf("after Flush: got %q, want %q", got, want)
+	}
+}
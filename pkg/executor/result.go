@@ -0,0 +1,102 @@
+package executor
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// parseCSVResult parses COPY ... TO STDOUT (FORMAT csv, HEADER) output.
+// Quoted fields are values (possibly empty); unquoted empty fields are NULL.
+func parseCSVResult(data string) (*Result, error) {
+	records, err := parseCSV(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return &Result{}, nil
+	}
+
+	result := &Result{Rows: records[1:]}
+	for _, field := range records[0] {
+		result.Columns = append(result.Columns, field.String)
+	}
+
+	// A single NULL column is written as an empty line
+	for i, row := range result.Rows {
+		if len(row) == 0 {
+			result.Rows[i] = []sql.NullString{{}}
+		}
+	}
+
+	return result, nil
+}
+
+func parseCSV(data string) ([][]sql.NullString, error) {
+	var (
+		records [][]sql.NullString
+		record  []sql.NullString
+		i       int
+	)
+
+	for i < len(data) {
+		var field sql.NullString
+
+		if data[i] == '"' {
+			var value strings.Builder
+			i++
+			for {
+				if i >= len(data) {
+					return nil, errors.New("unterminated quoted field in query result")
+				}
+				if data[i] == '"' {
+					if i+1 < len(data) && data[i+1] == '"' {
+						value.WriteByte('"')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				value.WriteByte(data[i])
+				i++
+			}
+			field = sql.NullString{String: value.String(), Valid: true}
+		} else {
+			end := strings.IndexAny(data[i:], ",\n")
+			if end < 0 {
+				end = len(data) - i
+			}
+			value := strings.TrimSuffix(data[i:i+end], "\r")
+			field = sql.NullString{String: value, Valid: value != ""}
+			i += end
+		}
+
+		if i < len(data) && data[i] == '\r' {
+			i++
+		}
+
+		switch {
+		case i >= len(data) || data[i] == '\n':
+			// An empty line is a record with no fields
+			if len(record) > 0 || field.Valid {
+				record = append(record, field)
+			}
+			records = append(records, record)
+			record = nil
+			i++
+		case data[i] == ',':
+			record = append(record, field)
+			i++
+		default:
+			return nil, errors.New("malformed field in query result")
+		}
+	}
+
+	// Input ending in a separator leaves a final NULL field
+	if record != nil {
+		records = append(records, append(record, sql.NullString{}))
+	}
+
+	return records, nil
+}
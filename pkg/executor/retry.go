@@ -0,0 +1,191 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// RetryPolicy configures how transient connection failures are retried
+type RetryPolicy struct {
+	Attempts       int           // Total attempts including the first; 0 retries until the context is done
+	InitialBackoff time.Duration // Delay before the first retry, doubled after each attempt
+	MaxBackoff     time.Duration // Upper bound for the delay between attempts
+}
+
+// DefaultRetryPolicy rides out a database that is still starting up
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:       5,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+}
+
+// transientMessages are failures that occur while establishing a connection,
+// before any statement has been sent to the server
+var transientMessages = []string{
+	"connection refused",
+	"the database system is starting up",
+	"the database system is not yet accepting connections",
+	"too many connections",
+	"too many clients already",
+	"remaining connection slots are reserved",
+	"could not translate host name",
+	"no such host",
+}
+
+// IsTransient reports whether err is a connection failure worth retrying.
+// Only failures to establish a connection are considered transient, so a
+// statement is never re-sent after the server may have executed it.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "57P03", "53300": // cannot_connect_now, too_many_connections
+			return true
+		}
+	}
+
+	msg := strings.ToLower(err.Error())
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		msg += "\n" + strings.ToLower(cmdErr.Stderr)
+	}
+	for _, m := range transientMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// Retry calls fn until it succeeds, fails with a non-transient error, the
+// policy's attempts are exhausted or ctx is done. onRetry, if not nil, is
+// called before each wait.
+func Retry(ctx context.Context, policy RetryPolicy, onRetry func(err error, attempt int, wait time.Duration), fn func() error) error {
+	backoff := policy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !IsTransient(err) || (policy.Attempts > 0 && attempt >= policy.Attempts) {
+			return err
+		}
+
+		if onRetry != nil {
+			onRetry(err, attempt, backoff)
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
+
+// RetryingExecutor wraps an Executor and retries calls that fail because a
+// connection could not be established. Only calls that send a single query or
+// take a lock are retried: Run, RunWithStdin and RunSQLFile run arbitrary
+// commands and scripts that may fail on a later connection after earlier
+// statements ran, and file operations cannot fail to connect.
+type RetryingExecutor struct {
+	Executor
+	policy RetryPolicy
+	out    io.Writer
+}
+
+// NewRetrying creates a new RetryingExecutor that reports retries to out
+func NewRetrying(exec Executor, policy RetryPolicy, out io.Writer) *RetryingExecutor {
+	return &RetryingExecutor{Executor: exec, policy: policy, out: out}
+}
+
+func (r *RetryingExecutor) retry(ctx context.Context, fn func() error) error {
+	return Retry(ctx, r.policy, func(err error, attempt int, wait time.Duration) {
+		fmt.Fprintf(r.out, "Database not ready (%s), retrying in %s (attempt %d", lastLine(Redact(err.Error())), wait, attempt+1)
+		if r.policy.Attempts > 0 {
+			fmt.Fprintf(r.out, "/%d", r.policy.Attempts)
+		}
+		fmt.Fprintln(r.out, ")...")
+	}, fn)
+}
+
+func (r *RetryingExecutor) RunWithOutput(ctx context.Context, name string, args ...string) (string, error) {
+	var output string
+	err := r.retry(ctx, func() error {
+		var err error
+		output, err = r.Executor.RunWithOutput(ctx, name, args...)
+		return err
+	})
+	return output, err
+}
+
+// RunWithStdin is not retried since stdin can only be consumed once and the
+// command may have had effects before failing
+func (r *RetryingExecutor) RunWithStdin(ctx context.Context, stdin io.Reader, name string, args ...string) error {
+	return r.Executor.RunWithStdin(ctx, stdin, name, args...)
+}
+
+func (r *RetryingExecutor) RunSQL(ctx context.Context, dbURL, query string) (string, error) {
+	var output string
+	err := r.retry(ctx, func() error {
+		var err error
+		output, err = r.Executor.RunSQL(ctx, dbURL, query)
+		return err
+	})
+	return output, err
+}
+
+func (r *RetryingExecutor) Query(ctx context.Context, dbURL, query string) (*Result, error) {
+	var result *Result
+	err := r.retry(ctx, func() error {
+		var err error
+		result, err = r.Executor.Query(ctx, dbURL, query)
+		return err
+	})
+	return result, err
+}
+
+// RunFunc retries only transactional code: errors from fn itself may look
+// transient, and code run outside a transaction may have had effects
+func (r *RetryingExecutor) RunFunc(ctx context.Context, dbURL, name string, transaction bool, fn Func) error {
+	if !transaction {
+		return r.Executor.RunFunc(ctx, dbURL, name, transaction, fn)
+	}
+	return r.retry(ctx, func() error {
+		return r.Executor.RunFunc(ctx, dbURL, name, transaction, fn)
+	})
+}
+
+func (r *RetryingExecutor) TryAdvisoryLock(ctx context.Context, dbURL string, key int64) (func() error, bool, error) {
+	var (
+		unlock   func() error
+		acquired bool
+	)
+	err := r.retry(ctx, func() error {
+		var err error
+		unlock, acquired, err = r.Executor.TryAdvisoryLock(ctx, dbURL, key)
+		return err
+	})
+	return unlock, acquired, err
+}
+
+// lastLine returns the most specific line of a multi-line error message
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return strings.TrimSpace(s[i+1:])
+	}
+	return s
+}
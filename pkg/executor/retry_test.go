@@ -0,0 +1,170 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"connection refused", errors.New(`psql: error: connection to server at "db" (10.0.0.2), port 5432 failed: Connection refused`), true},
+		{"starting up", fmt.Errorf("exit status 2: %s", "FATAL:  the database system is starting up"), true},
+		{"too many clients", errors.New("FATAL: sorry, too many clients already"), true},
+		{"unknown host", errors.New(`could not translate host name "db" to address`), true},
+		{"cannot connect now", fmt.Errorf("connecting: %w", &pgconn.PgError{Code: "57P03"}), true},
+		{"too many connections", &pgconn.PgError{Code: "53300"}, true},
+		{"message in stderr", &CommandError{Err: errors.New("exit status 2"), Stderr: "FATAL:  the database system is not yet accepting connections"}, true},
+		{"syntax error", &pgconn.PgError{Code: "42601", Message: "syntax error at or near \"SELEC\""}, false},
+		{"failed statement", &CommandError{Err: errors.New("exit status 3"), Stderr: `ERROR:  relation "users" does not exist`}, false},
+		{"authentication", errors.New(`FATAL: password authentication failed for user "app"`), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransient(tt.err); got != tt.want {
+				t.Errorf("IsTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+var errRefused = errors.New("connection refused")
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	policy := RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond}
+
+	tests := []struct {
+		name      string
+		errs      []error // returned by successive calls, then nil
+		wantCalls int
+		wantErr   error
+	}{
+		{"success", nil, 1, nil},
+		{"recovers", []error{errRefused, errRefused}, 3, nil},
+		{"attempts exhausted", []error{errRefused, errRefused, errRefused, errRefused}, 3, errRefused},
+		{"not transient", []error{io.ErrUnexpectedEOF}, 1, io.ErrUnexpectedEOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls, retries := 0, 0
+			err := Retry(ctx, policy, func(error, int, time.Duration) { retries++ }, func() error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+			if err != tt.wantErr {
+				t.Errorf("Retry = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls || retries != tt.wantCalls-1 {
+				t.Errorf("calls = %d, retries = %d, want %d calls", calls, retries, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryStopsWhenContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := Retry(ctx, RetryPolicy{InitialBackoff: time.Hour}, nil, func() error {
+		calls++
+		cancel()
+		return errRefused
+	})
+	if !errors.Is(err, errRefused) || calls != 1 {
+		t.Errorf("Retry = %v after %d calls, want the last error after 1 call", err, calls)
+	}
+}
+
+// failingExecutor answers like its stubExecutor and counts the calls
+type failingExecutor struct {
+	stubExecutor
+	calls int
+}
+
+func (f *failingExecutor) Run(ctx context.Context, name string, args ...string) error {
+	f.calls++
+	return f.stubExecutor.Run(ctx, name, args...)
+}
+func (f *failingExecutor) RunWithOutput(ctx context.Context, name string, args ...string) (string, error) {
+	f.calls++
+	return f.stubExecutor.RunWithOutput(ctx, name, args...)
+}
+func (f *failingExecutor) RunWithStdin(ctx context.Context, stdin io.Reader, name string, args ...string) error {
+	f.calls++
+	return f.stubExecutor.RunWithStdin(ctx, stdin, name, args...)
+}
+func (f *failingExecutor) RunSQL(ctx context.Context, dbURL, query string) (string, error) {
+	f.calls++
+	return f.stubExecutor.RunSQL(ctx, dbURL, query)
+}
+func (f *failingExecutor) Query(ctx context.Context, dbURL, query string) (*Result, error) {
+	f.calls++
+	return f.stubExecutor.Query(ctx, dbURL, query)
+}
+func (f *failingExecutor) RunSQLFile(ctx context.Context, dbURL, filePath string) error {
+	f.calls++
+	return f.stubExecutor.RunSQLFile(ctx, dbURL, filePath)
+}
+func (f *failingExecutor) TryAdvisoryLock(ctx context.Context, dbURL string, key int64) (func() error, bool, error) {
+	f.calls++
+	return f.stubExecutor.TryAdvisoryLock(ctx, dbURL, key)
+}
+func (f *failingExecutor) RunFunc(ctx context.Context, dbURL, name string, transaction bool, fn Func) error {
+	f.calls++
+	return f.stubExecutor.RunFunc(ctx, dbURL, name, transaction, fn)
+}
+
+func TestRetryingExecutor(t *testing.T) {
+	ctx := context.Background()
+	dbURL := "postgres://db/app"
+
+	tests := []struct {
+		name      string
+		call      func(Executor) error
+		wantCalls int
+	}{
+		{"Query", func(e Executor) error { _, err := e.Query(ctx, dbURL, "SELECT 1"); return err }, 3},
+		{"RunSQL", func(e Executor) error { _, err := e.RunSQL(ctx, dbURL, "SELECT 1"); return err }, 3},
+		{"RunWithOutput", func(e Executor) error { _, err := e.RunWithOutput(ctx, "pg_dump", dbURL); return err }, 3},
+		{"TryAdvisoryLock", func(e Executor) error { _, _, err := e.TryAdvisoryLock(ctx, dbURL, 1); return err }, 3},
+		{"RunFunc in transaction", func(e Executor) error { return e.RunFunc(ctx, dbURL, "f", true, nil) }, 3},
+		{"RunFunc without transaction", func(e Executor) error { return e.RunFunc(ctx, dbURL, "f", false, nil) }, 1},
+		{"Run", func(e Executor) error { return e.Run(ctx, "psql", "-f", "restore.sql", dbURL) }, 1},
+		{"RunWithStdin", func(e Executor) error { return e.RunWithStdin(ctx, strings.NewReader(""), "psql", dbURL) }, 1},
+		{"RunSQLFile", func(e Executor) error { return e.RunSQLFile(ctx, dbURL, "seed.sql") }, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &failingExecutor{stubExecutor: stubExecutor{err: errRefused}}
+			var out strings.Builder
+			exec := NewRetrying(inner, RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond}, &out)
+
+			if err := tt.call(exec); !errors.Is(err, errRefused) {
+				t.Errorf("err = %v, want %v", err, errRefused)
+			}
+			if inner.calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", inner.calls, tt.wantCalls)
+			}
+			if retried := strings.Count(out.String(), "retrying"); retried != tt.wantCalls-1 {
+				t.Errorf("reported %d retries, want %d:\n%s", retried, tt.wantCalls-1, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package executor
+
+import (
+	"strings"
+)
+
+// ScriptCommand is a single unit of a psql script: either a SQL statement
+// or a backslash meta-command
+type ScriptCommand struct {
+	Line int    // 1-based line number where the command starts
+	Text string // Statement text (including the terminating semicolon) or meta-command line
+	Meta bool   // True if Text is a backslash meta-command
+}
+
+// SplitScript splits a psql script into statements and meta-commands.
+// Statements are terminated by semicolons outside of quotes, comments and
+// dollar-quoted bodies, which mirrors how psql sends statements to the server.
+func SplitScript(script string) []ScriptCommand {
+	var (
+		commands   []ScriptCommand
+		buf        strings.Builder
+		startLine  = 1
+		line       = 1
+		atLineHead = true
+		blank      = true
+
+		inSingle     bool
+		escapeString bool
+		inDouble     bool
+		inLine       bool
+		blockDepth   int
+		dollarTag    string
+	)
+
+	flush := func() {
+		text := strings.TrimSpace(buf.String())
+		if text != "" && !isCommentOnly(text) {
+			commands = append(commands, ScriptCommand{Line: startLine, Text: text})
+		}
+		buf.Reset()
+		blank = true
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+
+		// Meta-commands are only recognized at the start of a line, outside
+		// of any statement in progress
+		if atLineHead && c == '\\' && !inSingle && !inDouble && blockDepth == 0 && dollarTag == "" &&
+			isCommentOnly(buf.String()) {
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script) - i
+			}
+			commands = append(commands, ScriptCommand{
+				Line: line,
+				Text: strings.TrimSpace(script[i : i+end]),
+				Meta: true,
+			})
+			buf.Reset()
+			blank = true
+			i += end - 1
+			continue
+		}
+
+		if c == '\n' {
+			line++
+			atLineHead = true
+			inLine = false
+			buf.WriteByte(c)
+			continue
+		}
+		if c != ' ' && c != '\t' && c != '\r' {
+			atLineHead = false
+			if blank {
+				blank = false
+				startLine = line
+			}
+		}
+
+		buf.WriteByte(c)
+
+		switch {
+		case inLine:
+		case inSingle:
+			if escapeString && c == '\\' && i+1 < len(script) {
+				i++
+				buf.WriteByte(script[i])
+			} else if c == '\'' {
+				inSingle = false
+			}
+		case inDouble:
+			if c == '"' {
+				inDouble = false
+			}
+		case blockDepth > 0:
+			if c == '*' && i+1 < len(script) && script[i+1] == '/' {
+				i++
+				buf.WriteByte('/')
+				blockDepth--
+			} else if c == '/' && i+1 < len(script) && script[i+1] == '*' {
+				i++
+				buf.WriteByte('*')
+				blockDepth++
+			}
+		case dollarTag != "":
+			if c == '$' && strings.HasPrefix(script[i:], dollarTag) {
+				buf.WriteString(dollarTag[1:])
+				i += len(dollarTag) - 1
+				dollarTag = ""
+			}
+		case c == '\'':
+			inSingle = true
+			escapeString = i > 0 && (script[i-1] == 'E' || script[i-1] == 'e') &&
+				(i == 1 || !isIdentChar(script[i-2]))
+		case c == '"':
+			inDouble = true
+		case c == '-' && i+1 < len(script) && script[i+1] == '-':
+			inLine = true
+		case c == '/' && i+1 < len(script) && script[i+1] == '*':
+			i++
+			buf.WriteByte('*')
+			blockDepth = 1
+		case c == '$' && (i == 0 || !isIdentChar(script[i-1])):
+			if tag := dollarQuoteTag(script[i:]); tag != "" {
+				buf.WriteString(tag[1:])
+				i += len(tag) - 1
+				dollarTag = tag
+			}
+		case c == ';':
+			flush()
+		}
+	}
+	flush()
+
+	return commands
+}
+
+// dollarQuoteTag returns the dollar-quote opening tag (e.g. "$$" or "$body$")
+// at the start of s, or "" if s does not start with one
+func dollarQuoteTag(s string) string {
+	for j := 1; j < len(s); j++ {
+		c := s[j]
+		if c == '$' {
+			return s[:j+1]
+		}
+		if !isIdentChar(c) || (j == 1 && c >= '0' && c <= '9') {
+			return ""
+		}
+	}
+	return ""
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c >= 0x80
+}
+
+// isCommentOnly reports whether text consists only of SQL line comments
+func isCommentOnly(text string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+package executor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []ScriptCommand
+	}{
+		{
+			name:   "statements",
+			script: "SELECT 1;\nSELECT 2;\n",
+			want: []ScriptCommand{
+				{Line: 1, Text: "SELECT 1;"},
+				{Line: 2, Text: "SELECT 2;"},
+			},
+		},
+		{
+			name:   "multi-line statement",
+			script: "\n\nCREATE TABLE t (\n    id int\n);",
+			want:   []ScriptCommand{{Line: 3, Text: "CREATE TABLE t (\n    id int\n);"}},
+		},
+		{
+			name:   "missing final semicolon",
+			script: "SELECT 1;\nSELECT 2\n",
+			want: []ScriptCommand{
+				{Line: 1, Text: "SELECT 1;"},
+				{Line: 2, Text: "SELECT 2"},
+			},
+		},
+		{
+			name:   "semicolons in quotes",
+			script: `SELECT 'a;b', "c;d", E'e\';f';`,
+			want:   []ScriptCommand{{Line: 1, Text: `SELECT 'a;b', "c;d", E'e\';f';`}},
+		},
+		{
+			name:   "backslash in standard string",
+			script: `SELECT 'a\'; SELECT 2;`,
+			want: []ScriptCommand{
+				{Line: 1, Text: `SELECT 'a\';`},
+				{Line: 1, Text: "SELECT 2;"},
+			},
+		},
+		{
+			name:   "semicolons in comments",
+			script: "SELECT 1 -- a; b\n/* c; /* d; */ e; */ + 1;",
+			want:   []ScriptCommand{{Line: 1, Text: "SELECT 1 -- a; b\n/* c; /* d; */ e; */ + 1;"}},
+		},
+		{
+			name:   "dollar-quoted body",
+			script: "CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $$ $body$ LANGUAGE sql;\nSELECT $1;",
+			want: []ScriptCommand{
+				{Line: 1, Text: "CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $$ $body$ LANGUAGE sql;"},
+				{Line: 2, Text: "SELECT $1;"},
+			},
+		},
+		{
+			name:   "meta-commands",
+			script: "\\set ON_ERROR_STOP on\nSELECT 1;\n  \\copy t FROM 'a;b.csv' CSV\n\\echo done",
+			want: []ScriptCommand{
+				{Line: 1, Text: "\\set ON_ERROR_STOP on", Meta: true},
+				{Line: 2, Text: "SELECT 1;"},
+				{Line: 3, Text: "\\copy t FROM 'a;b.csv' CSV", Meta: true},
+				{Line: 4, Text: "\\echo done", Meta: true},
+			},
+		},
+		{
+			name:   "backslash inside statement",
+			script: "SELECT 1\n\\ 2;",
+			want:   []ScriptCommand{{Line: 1, Text: "SELECT 1\n\\ 2;"}},
+		},
+		{
+			name:   "comments between statements",
+			script: "-- header\nSELECT 1;\n-- trailing comment\n",
+			want:   []ScriptCommand{{Line: 1, Text: "-- header\nSELECT 1;"}},
+		},
+		{
+			name:   "empty",
+			script: " \n-- nothing\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SplitScript(tt.script)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitScript(%q)\n got: %#v\nwant: %#v", tt.script, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/tmwinc/seedup/pkg/events"
+)
+
+// Baseline brings a database that predates seedup under its management: it
+// dumps the live schema into an initial migration and records that migration
+// as applied without running it. It refuses if the database already has
+// applied migrations or the migrations directory already has migrations,
+// and returns the path of the new migration.
+func (m *Migrator) Baseline(ctx context.Context, dbURL, migrationsDir string) (string, error) {
+	ctx, unlock, err := m.Lock(ctx, dbURL)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	step := events.FromContext(ctx).Start("baseline", "Baselining database...").Database(dbURL)
+	path, err := m.baseline(ctx, dbURL, migrationsDir, step)
+	return path, step.End(err)
+}
+
+func (m *Migrator) baseline(ctx context.Context, dbURL, migrationsDir string, step *events.Step) (string, error) {
+	exists, err := m.hasTable(ctx, dbURL, versionTable)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		applied, err := m.appliedVersions(ctx, dbURL)
+		if err != nil {
+			return "", err
+		}
+		if len(applied) > 0 {
+			return "", fmt.Errorf("database already has %d applied migration(s), latest %d: baseline is only for databases not yet managed by migrations",
+				len(applied), applied[len(applied)-1].Version)
+		}
+	}
+
+	migrations, err := collectAll(ctx, migrationsDir)
+	if err != nil {
+		return "", err
+	}
+	if len(migrations) > 0 {
+		return "", fmt.Errorf("%s already contains %d migration(s): baseline must create the first one", migrationsDir, len(migrations))
+	}
+
+	version, err := nextVersion(migrationsDir, false)
+	if err != nil {
+		return "", err
+	}
+
+	schema, err := dumpSchema(ctx, m.exec, dbURL)
+	if err != nil {
+		return "", fmt.Errorf("dumping schema: %w", err)
+	}
+
+	// Stop here if interrupted, before changing any file or table
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	content := initialMigration(schema)
+	path := filepath.Join(migrationsDir, version.prefix+"_initial.sql")
+	if err := m.exec.WriteFile(path, content); err != nil {
+		return "", fmt.Errorf("writing initial migration: %w", err)
+	}
+	step.AddFiles(path)
+
+	if err := m.ensureVersionTable(ctx, dbURL); err != nil {
+		return "", err
+	}
+	if err := m.ensureChecksumTable(ctx, dbURL); err != nil {
+		return "", err
+	}
+
+	// Record the version with the checksum of the file, so it is not
+	// reported as modified
+	record := fmt.Sprintf(`INSERT INTO %s (version_id, is_applied) VALUES (%d, true);
+INSERT INTO %s (version_id, checksum) VALUES (%[2]d, '%[4]s')
+    ON CONFLICT (version_id) DO UPDATE SET checksum = EXCLUDED.checksum, recorded_at = now();`,
+		versionTable, version.value, checksumTable, checksum(content))
+	if err := m.runScript(ctx, dbURL, migrationScript("", record, SessionSettings{}, false)); err != nil {
+		return "", fmt.Errorf("recording baseline version %d: %w", version.value, err)
+	}
+
+	events.FromContext(ctx).Info("baseline", fmt.Sprintf("Baselined database at version %d", version.value))
+	return path, nil
+}
@@ -0,0 +1,84 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const baselineDump = "CREATE TABLE public.users (\n    id bigint NOT NULL\n);\n"
+
+func TestBaseline(t *testing.T) {
+	dir := t.TempDir()
+	exec := &fakeExecutor{dump: baselineDump}
+	exec.tables()
+
+	path, err := New(exec).Baseline(testContext(), testDatabaseURL, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !regexp.MustCompile(`^\d{14}_initial\.sql$`).MatchString(filepath.Base(path)) || filepath.Dir(path) != dir {
+		t.Errorf("path = %s, want a timestamped initial migration in %s", path, dir)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != string(initialMigration(baselineDump)) {
+		t.Errorf("initial migration =\n%s", content)
+	}
+
+	// The version is recorded with the checksum of the file, without running it
+	version := strings.TrimSuffix(filepath.Base(path), "_initial.sql")
+	if got := exec.executed("CREATE TABLE public.users"); len(got) != 0 {
+		t.Errorf("baseline ran the initial migration: %q", got)
+	}
+	record := exec.executed("INSERT INTO " + checksumTable)
+	if len(record) != 1 || !strings.Contains(record[0], "VALUES ("+version+", true)") ||
+		!strings.Contains(record[0], "'"+checksum(content)+"'") {
+		t.Errorf("scripts recording the version: %q, want one recording %s with its checksum", record, version)
+	}
+	if len(exec.executed("CREATE TABLE IF NOT EXISTS "+versionTable)) != 1 ||
+		len(exec.executed("CREATE TABLE IF NOT EXISTS "+checksumTable)) != 1 {
+		t.Errorf("bookkeeping tables not created: %q", exec.sql)
+	}
+}
+
+func TestBaselineRefuses(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		applied bool
+		want    string
+	}{
+		{"applied migrations", nil, true, "database already has 1 applied migration(s), latest 20260101000000"},
+		{"existing migrations", []string{"20260101000000_create_users.sql"}, false, "already contains 1 migration(s)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeMigrations(t, tt.files...)
+			exec := &fakeExecutor{dump: baselineDump}
+			if tt.applied {
+				exec.tables(versionTable)
+				exec.applied([2]int64{2, 20260101000000})
+			} else {
+				exec.tables()
+			}
+
+			_, err := New(exec).Baseline(testContext(), testDatabaseURL, dir)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Baseline = %v, want %q", err, tt.want)
+			}
+			if len(exec.sql) != 0 {
+				t.Errorf("Baseline modified the database: %q", exec.sql)
+			}
+			if files, _ := filepath.Glob(filepath.Join(dir, "*_initial.sql")); len(files) != 0 {
+				t.Errorf("Baseline wrote %q", files)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// templatesDir is the subdirectory of the migrations directory holding
+// project templates for new migrations
+const templatesDir = "templates"
+
+// CreateOptions configures a new migration
+type CreateOptions struct {
+	Template   string            // Template name; empty for a blank migration
+	Vars       map[string]string // Template variables, e.g. "table"
+	Sequential bool              // Number the migration after the highest version instead of by timestamp
+	Go         bool              // Create a Go migration
+}
+
+// builtinTemplates are used when the project has no template of the same name.
+// Besides the given variables, templates can use {{.name}} and {{.version}}.
+var builtinTemplates = map[string]string{
+	"create_table": `-- +goose Up
+CREATE TABLE {{.table}} (
+    id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE {{.table}};
+`,
+	"add_column": `-- +goose Up
+ALTER TABLE {{.table}} ADD COLUMN {{.column}} {{.type}};
+
+-- +goose Down
+ALTER TABLE {{.table}} DROP COLUMN {{.column}};
+`,
+	"add_index_concurrently": `-- +goose Up
+-- seedup:no-transaction
+CREATE INDEX CONCURRENTLY IF NOT EXISTS {{.index}} ON {{.table}} ({{.columns}});
+
+-- +goose Down
+-- seedup:no-transaction
+DROP INDEX CONCURRENTLY IF EXISTS {{.index}};
+`,
+}
+
+// Create creates a new blank migration file with the given name
+func (m *Migrator) Create(migrationsDir, name string) (string, error) {
+	return m.CreateWith(migrationsDir, name, CreateOptions{})
+}
+
+// CreateWith creates a new migration file with the given name, rendered from
+// a template if one is given. Templates are looked up in the templates
+// subdirectory of the migrations directory as <template>.sql, falling back to
+// the built-in ones.
+func (m *Migrator) CreateWith(migrationsDir, name string, opts CreateOptions) (string, error) {
+	version, err := nextVersion(migrationsDir, opts.Sequential)
+	if err != nil {
+		return "", err
+	}
+
+	if opts.Go {
+		if opts.Template != "" {
+			return "", fmt.Errorf("templates are only supported for SQL migrations")
+		}
+		return m.createGo(migrationsDir, name, version)
+	}
+
+	if opts.Template == "" {
+		return m.writeSQL(migrationsDir, name, version, "", "")
+	}
+
+	content, err := renderTemplate(migrationsDir, opts.Template, name, version, opts.Vars)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(migrationsDir, version.prefix+"_"+name+".sql")
+	if err := m.exec.WriteFile(path, content); err != nil {
+		return "", fmt.Errorf("writing migration file: %w", err)
+	}
+	return path, nil
+}
+
+// CreateSQL creates a new migration file with the given name and Up and Down SQL
+func (m *Migrator) CreateSQL(migrationsDir, name, up, down string) (string, error) {
+	version, err := nextVersion(migrationsDir, false)
+	if err != nil {
+		return "", err
+	}
+	return m.writeSQL(migrationsDir, name, version, up, down)
+}
+
+func (m *Migrator) writeSQL(migrationsDir, name string, version migrationVersion, up, down string) (string, error) {
+	filepath := filepath.Join(migrationsDir, version.prefix+"_"+name+".sql")
+
+	content := fmt.Sprintf(`-- +goose Up
+-- +goose StatementBegin
+%s
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+%s
+-- +goose StatementEnd
+`, strings.TrimSpace(up), strings.TrimSpace(down))
+
+	if err := m.exec.WriteFile(filepath, []byte(content)); err != nil {
+		return "", fmt.Errorf("writing migration file: %w", err)
+	}
+
+	return filepath, nil
+}
+
+// templateNames returns the names of the available templates: the project's and the built-in ones
+func templateNames(migrationsDir string) []string {
+	files, _ := filepath.Glob(filepath.Join(migrationsDir, templatesDir, "*.sql"))
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, path := range files {
+		name := strings.TrimSuffix(filepath.Base(path), ".sql")
+		seen[name] = true
+		names = append(names, name)
+	}
+	for name := range builtinTemplates {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// renderTemplate renders the named template with the variables, failing if
+// the template uses one that is not set
+func renderTemplate(migrationsDir, name, migration string, version migrationVersion, vars map[string]string) ([]byte, error) {
+	text, ok := builtinTemplates[name]
+	content, err := os.ReadFile(filepath.Join(migrationsDir, templatesDir, name+".sql"))
+	switch {
+	case err == nil:
+		text = string(content)
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, fmt.Errorf("reading template %s: %w", name, err)
+	case !ok:
+		return nil, fmt.Errorf("unknown template %q (available: %s)", name, strings.Join(templateNames(migrationsDir), ", "))
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing template %s: %w", name, err)
+	}
+
+	data := map[string]string{"name": migration, "version": version.prefix}
+	for k, v := range vars {
+		data[k] = v
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("rendering template %s: %w (set variables with --var key=value)", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// migrationVersion is the version of a new migration and its file name prefix
+type migrationVersion struct {
+	value  int64
+	prefix string
+}
+
+// nextVersion returns the version for a new migration: the current UTC time
+// as YYYYMMDDHHMMSS, or with sequential one more than the highest version in
+// the directory, zero-padded to five digits like goose does
+func nextVersion(migrationsDir string, sequential bool) (migrationVersion, error) {
+	if !sequential {
+		timestamp := time.Now().UTC().Format("20060102150405")
+		value, err := strconv.ParseInt(timestamp, 10, 64)
+		return migrationVersion{value: value, prefix: timestamp}, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(migrationsDir, "*"))
+	if err != nil {
+		return migrationVersion{}, err
+	}
+	var highest int64
+	for _, path := range files {
+		ext := filepath.Ext(path)
+		if ext != ".sql" && ext != ".go" {
+			continue
+		}
+		if version, _, ok := parseFilename(filepath.Base(path)); ok {
+			highest = max(highest, version)
+		}
+	}
+	return migrationVersion{value: highest + 1, prefix: fmt.Sprintf("%05d", highest+1)}, nil
+}
+
+// createGo writes a Go migration stub, and the file declaring the package's
+// Registry if the directory has none yet
+func (m *Migrator) createGo(migrationsDir, name string, version migrationVersion) (string, error) {
+	pkg := goPackageName(migrationsDir)
+
+	registryPath := filepath.Join(migrationsDir, "registry.go")
+	if _, err := os.Stat(registryPath); errors.Is(err, fs.ErrNotExist) {
+		content := fmt.Sprintf(`// Package %[1]s holds the project's Go migrations. Build a binary that
+// runs seedup with them:
+//
+//	func main() {
+//		seedup.Main(%[1]s.Registry)
+//	}
+package %[1]s
+
+import "github.com/tmwinc/seedup/pkg/migrate"
+
+// Registry holds the Go migrations of this package
+var Registry = migrate.NewRegistry()
+`, pkg)
+		if err := m.exec.WriteFile(registryPath, []byte(content)); err != nil {
+			return "", fmt.Errorf("writing registry file: %w", err)
+		}
+	}
+
+	content := fmt.Sprintf(`package %[1]s
+
+import (
+	"context"
+
+	"github.com/tmwinc/seedup/pkg/executor"
+)
+
+func init() {
+	Registry.Add(%[2]d, %[3]q, up%[4]s, down%[4]s)
+}
+
+func up%[4]s(ctx context.Context, db executor.DB) error {
+	return nil
+}
+
+func down%[4]s(ctx context.Context, db executor.DB) error {
+	return nil
+}
+`, pkg, version.value, name, goIdentifier(name))
+
+	path := filepath.Join(migrationsDir, version.prefix+"_"+name+".go")
+	if err := m.exec.WriteFile(path, []byte(content)); err != nil {
+		return "", fmt.Errorf("writing migration file: %w", err)
+	}
+	return path, nil
+}
+
+var nonIdentRe = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// goPackageName derives a Go package name from the migrations directory name
+func goPackageName(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	name := nonIdentRe.ReplaceAllString(strings.ToLower(filepath.Base(abs)), "")
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		return "migrations"
+	}
+	return name
+}
+
+// goIdentifier turns a migration name such as "backfill_users" into "BackfillUsers"
+func goIdentifier(name string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
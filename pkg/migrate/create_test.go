@@ -0,0 +1,144 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNextVersionSequential(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  migrationVersion
+	}{
+		{"empty", nil, migrationVersion{value: 1, prefix: "00001"}},
+		{"sql and go", []string{"00003_a.sql", "00010_b.go", "00007_c.sql"}, migrationVersion{value: 11, prefix: "00011"}},
+		{
+			name:  "other files ignored",
+			files: []string{"00002_a.sql", "00099_notes.md", "registry.go", "templates/00050_t.sql", "data/00060_d.sql"},
+			want:  migrationVersion{value: 3, prefix: "00003"},
+		},
+		{"beyond five digits", []string{"123456_a.sql"}, migrationVersion{value: 123457, prefix: "123457"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := make(map[string]string)
+			for _, f := range tt.files {
+				files[f] = ""
+			}
+			writeFiles(t, dir, files)
+
+			got, err := nextVersion(dir, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("nextVersion = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextVersionTimestamp(t *testing.T) {
+	before := time.Now().UTC().Truncate(time.Second)
+	got, err := nextVersion(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now().UTC()
+
+	created, err := time.Parse("20060102150405", got.prefix)
+	if err != nil {
+		t.Fatalf("prefix %q is not a timestamp: %v", got.prefix, err)
+	}
+	if created.Before(before) || created.After(after) {
+		t.Errorf("timestamp %s not between %s and %s", created, before, after)
+	}
+	if strconv.FormatInt(got.value, 10) != got.prefix {
+		t.Errorf("value %d does not match prefix %q", got.value, got.prefix)
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"templates/add_column.sql": "-- +goose Up\n-- {{.version}} {{.name}}\nALTER TABLE {{.table}} ADD COLUMN {{.column}} text;\n",
+		"templates/broken.sql":     "-- +goose Up\n{{.table\n",
+	})
+	version := migrationVersion{value: 7, prefix: "00007"}
+
+	tests := []struct {
+		name     string
+		template string
+		vars     map[string]string
+		want     string
+		wantErr  string
+	}{
+		{
+			name:     "built-in",
+			template: "create_table",
+			vars:     map[string]string{"table": "users"},
+			want: "-- +goose Up\nCREATE TABLE users (\n    id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,\n" +
+				"    created_at timestamptz NOT NULL DEFAULT now()\n);\n\n-- +goose Down\nDROP TABLE users;\n",
+		},
+		{
+			name:     "project template overrides built-in",
+			template: "add_column",
+			vars:     map[string]string{"table": "users", "column": "email"},
+			want:     "-- +goose Up\n-- 00007 add_email\nALTER TABLE users ADD COLUMN email text;\n",
+		},
+		{
+			name:     "missing variable",
+			template: "add_index_concurrently",
+			vars:     map[string]string{"table": "users"},
+			wantErr:  "rendering template add_index_concurrently: ",
+		},
+		{
+			name:     "unknown template",
+			template: "drop_everything",
+			wantErr:  `unknown template "drop_everything" (available: add_column, add_index_concurrently, broken, create_table)`,
+		},
+		{
+			name:     "invalid template",
+			template: "broken",
+			wantErr:  "parsing template broken: ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderTemplate(dir, tt.template, "add_email", version, tt.vars)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Errorf("renderTemplate error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("renderTemplate: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("renderTemplate =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,526 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tmwinc/seedup/pkg/events"
+	"github.com/tmwinc/seedup/pkg/executor"
+)
+
+// dataDir is the subdirectory of the migrations directory holding data migrations
+const dataDir = "data"
+
+// Defaults for data migrations that don't set their own
+const (
+	defaultBatchSize   = 1000
+	defaultCursorStart = "0"
+)
+
+// progressInterval is how often progress is reported while a data migration runs
+const progressInterval = 5 * time.Second
+
+// DataMigration is a batched data migration in the data subdirectory of the
+// migrations directory, named <version>_<name>.sql like schema migrations.
+// Its version is the schema version it needs: it only runs once that
+// version has been applied.
+type DataMigration struct {
+	Version int64
+	Name    string
+	Path    string
+}
+
+// File returns the data migration's file name
+func (d *DataMigration) File() string {
+	return filepath.Base(d.Path)
+}
+
+// DataState describes how far a data migration has run
+type DataState string
+
+const (
+	DataPending    DataState = "pending"     // Not started
+	DataInProgress DataState = "in-progress" // Started, resumes from its cursor
+	DataCompleted  DataState = "completed"   // Ran out of rows to process
+)
+
+// DataMigrationStatus represents the progress of a single data migration
+type DataMigrationStatus struct {
+	Version     string     `json:"version"`
+	Name        string     `json:"name"`
+	State       DataState  `json:"state"`
+	Rows        int64      `json:"rows"`             // Rows processed so far
+	Cursor      string     `json:"cursor,omitempty"` // Key of the last row processed
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// DataOptions overrides the batching settings of data migrations; zero
+// values keep each migration's own settings
+type DataOptions struct {
+	BatchSize int
+	Sleep     time.Duration
+}
+
+// parsedDataMigration holds the queries and settings of a data migration file
+type parsedDataMigration struct {
+	Batch       string // Query processing one batch, returning the key of each row
+	Count       string // Optional query counting the rows left to process
+	BatchSize   int
+	Sleep       time.Duration
+	CursorStart string
+	Settings    SessionSettings
+}
+
+// parseDataMigration parses a data migration. The file holds a batch query,
+// introduced by "-- seedup:batch", and optionally a count query introduced by
+// "-- seedup:count". The batch query processes the next :batch_size rows
+// with a key greater than :cursor and returns their keys as its only column;
+// it is run until it returns no rows. It may start with a WITH clause, whose
+// CTEs can modify data, but must not define a CTE named batch or progress.
+// Settings are given as directives: batch_size, sleep (a Go duration),
+// cursor_start, lock_timeout and statement_timeout.
+func parseDataMigration(content string) (*parsedDataMigration, error) {
+	parsed := parsedDataMigration{BatchSize: defaultBatchSize, CursorStart: defaultCursorStart}
+	var (
+		batch, count strings.Builder
+		section      *strings.Builder
+	)
+
+	for i, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, directivePrefix) {
+			if section != nil {
+				section.WriteString(line)
+				section.WriteString("\n")
+			} else if trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+				return nil, fmt.Errorf("line %d: statement before '-- seedup:batch' or '-- seedup:count'", i+1)
+			}
+			continue
+		}
+
+		directive := strings.TrimSpace(strings.TrimPrefix(trimmed, directivePrefix))
+		key, value, _ := strings.Cut(directive, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		var err error
+		switch key {
+		case "batch":
+			section = &batch
+		case "count":
+			section = &count
+		case "batch_size":
+			parsed.BatchSize, err = strconv.Atoi(value)
+			if err == nil && parsed.BatchSize < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "sleep":
+			parsed.Sleep, err = time.ParseDuration(value)
+		case "cursor_start":
+			parsed.CursorStart = value
+		default:
+			var settings parsedMigration
+			err = parseDirective(&settings, trimmed)
+			parsed.Settings = parsed.Settings.merge(settings.Settings)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", i+1, key, err)
+		}
+	}
+
+	parsed.Batch = strings.TrimSuffix(strings.TrimSpace(batch.String()), ";")
+	parsed.Count = strings.TrimSuffix(strings.TrimSpace(count.String()), ";")
+	if parsed.Batch == "" {
+		return nil, fmt.Errorf("missing '-- seedup:batch' query")
+	}
+	if !strings.Contains(parsed.Batch, ":cursor") {
+		return nil, fmt.Errorf("batch query must use the :cursor placeholder to resume where it left off")
+	}
+	return &parsed, nil
+}
+
+var (
+	cursorPlaceholderRe    = regexp.MustCompile(`(^|[^:]):cursor\b`)
+	batchSizePlaceholderRe = regexp.MustCompile(`(^|[^:]):batch_size\b`)
+	leadingWithRe          = regexp.MustCompile(`(?is)^WITH\s+(?:RECURSIVE\s+)?`)
+	cteAliasRe             = regexp.MustCompile(`(?is)^AS[\s(]`)
+)
+
+// batchQuery substitutes the placeholders of a batch query and wraps it so a
+// single statement processes the batch and records the progress. The cursor
+// is the key of the last row in key order, taken with ORDER BY rather than
+// max() so keys of any ordered type work, uuid included.
+func batchQuery(query, cursor string, batchSize int, version int64) string {
+	query = cursorPlaceholderRe.ReplaceAllString(query, "${1}'"+strings.ReplaceAll(cursor, "'", "''")+"'")
+	query = batchSizePlaceholderRe.ReplaceAllString(query, "${1}"+strconv.Itoa(batchSize))
+
+	// Data-modifying CTEs are only allowed at the top level, so those of
+	// the query become siblings of the batch CTE
+	with := "WITH "
+	if ctes, body := splitWith(query); ctes != "" {
+		with, query = ctes+",\n", body
+	}
+
+	return fmt.Sprintf(`%sbatch(key) AS (
+%s
+), progress AS (
+    UPDATE %s SET
+        last_key = coalesce((SELECT key::text FROM batch ORDER BY key DESC LIMIT 1), last_key),
+        rows_processed = rows_processed + (SELECT count(*) FROM batch),
+        updated_at = now()
+    WHERE version_id = %d
+    RETURNING last_key, rows_processed
+)
+SELECT (SELECT count(*) FROM batch), last_key, rows_processed FROM progress`, with, query, dataTable, version)
+}
+
+// splitWith splits a query starting with a WITH clause into the clause, up
+// to its last common table expression, and the statement that follows.
+// Comments are removed. A query without a WITH clause is returned as body.
+func splitWith(query string) (ctes, body string) {
+	stripped := stripComments(query)
+	prefix := leadingWithRe.FindString(stripped)
+	if prefix == "" {
+		return "", query
+	}
+
+	var (
+		depth int
+		quote byte
+	)
+	for i := len(prefix); i < len(stripped); i++ {
+		c := stripped[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth != 0 {
+				continue
+			}
+			// A CTE's column list is followed by AS, its body by a comma
+			// or the statement
+			rest := strings.TrimLeft(stripped[i+1:], " \t\r\n")
+			if strings.HasPrefix(rest, ",") || cteAliasRe.MatchString(rest) {
+				continue
+			}
+			return stripped[:i+1], rest
+		}
+	}
+	return "", query
+}
+
+// collectDataMigrations returns the data migrations in the data
+// subdirectory of the migrations directory, sorted by version
+func collectDataMigrations(migrationsDir string) ([]*DataMigration, error) {
+	migrations, err := collectMigrations(filepath.Join(migrationsDir, dataDir))
+	if err != nil {
+		return nil, err
+	}
+	data := make([]*DataMigration, len(migrations))
+	for i, mig := range migrations {
+		data[i] = &DataMigration{Version: mig.Version, Name: mig.Name, Path: mig.Path}
+	}
+	return data, nil
+}
+
+// dataProgress is a data migration's row in the progress table
+type dataProgress struct {
+	Cursor      string
+	Rows        int64
+	StartedAt   *time.Time
+	CompletedAt *time.Time
+}
+
+// ensureDataTable creates the data migration progress table if it doesn't exist
+func (m *Migrator) ensureDataTable(ctx context.Context, dbURL string) error {
+	exists, err := m.hasTable(ctx, dbURL, dataTable)
+	if err != nil || exists {
+		return err
+	}
+
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+    version_id bigint PRIMARY KEY,
+    name text NOT NULL,
+    last_key text NOT NULL,
+    rows_processed bigint NOT NULL DEFAULT 0,
+    started_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now(),
+    completed_at timestamptz
+)`, dataTable)
+	if _, err := m.exec.RunSQL(ctx, dbURL, query); err != nil {
+		return fmt.Errorf("creating data migrations table: %w", err)
+	}
+	return nil
+}
+
+// dataProgresses returns the recorded progress of data migrations by version
+func (m *Migrator) dataProgresses(ctx context.Context, dbURL string) (map[int64]dataProgress, error) {
+	progress := make(map[int64]dataProgress)
+	exists, err := m.hasTable(ctx, dbURL, dataTable)
+	if err != nil || !exists {
+		return progress, err
+	}
+
+	result, err := m.exec.Query(ctx, dbURL, fmt.Sprintf(`SELECT version_id, last_key, rows_processed,
+    to_char(started_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS'),
+    to_char(completed_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS')
+FROM %s`, dataTable))
+	if err != nil {
+		return nil, fmt.Errorf("reading data migration progress: %w", err)
+	}
+
+	for _, row := range result.Rows {
+		version, err := strconv.ParseInt(row[0].String, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q: %w", row[0].String, err)
+		}
+		p := dataProgress{Cursor: row[1].String}
+		p.Rows, _ = strconv.ParseInt(row[2].String, 10, 64)
+		for i, t := range []**time.Time{&p.StartedAt, &p.CompletedAt} {
+			if v := row[3+i]; v.Valid {
+				if parsed, err := time.Parse("2006-01-02T15:04:05", v.String); err == nil {
+					*t = &parsed
+				}
+			}
+		}
+		progress[version] = p
+	}
+	return progress, nil
+}
+
+// DataStatus returns the progress of every data migration, sorted by
+// version. It does not modify the database.
+func (m *Migrator) DataStatus(ctx context.Context, dbURL, migrationsDir string) ([]DataMigrationStatus, error) {
+	migrations, err := collectDataMigrations(migrationsDir)
+	if err != nil {
+		return nil, fmt.Errorf("reading data migrations: %w", err)
+	}
+	progress, err := m.dataProgresses(ctx, dbURL)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]DataMigrationStatus, len(migrations))
+	for i, dm := range migrations {
+		st := DataMigrationStatus{Version: fmt.Sprint(dm.Version), Name: dm.Name, State: DataPending}
+		if p, ok := progress[dm.Version]; ok {
+			st.State, st.Rows, st.Cursor = DataInProgress, p.Rows, p.Cursor
+			st.StartedAt, st.CompletedAt = p.StartedAt, p.CompletedAt
+			if p.CompletedAt != nil {
+				st.State = DataCompleted
+			}
+		}
+		statuses[i] = st
+	}
+	return statuses, nil
+}
+
+// RunData runs the data migrations that have not completed, in version
+// order, resuming those that were interrupted. It stops at the first data
+// migration whose schema version has not been applied yet. Each data
+// migration runs under its own lock rather than the migration lock, so
+// deploys can apply schema migrations while a backfill is in progress.
+func (m *Migrator) RunData(ctx context.Context, dbURL, migrationsDir string, opts DataOptions) error {
+	migrations, err := collectDataMigrations(migrationsDir)
+	if err != nil {
+		return fmt.Errorf("reading data migrations: %w", err)
+	}
+	log := events.FromContext(ctx)
+	if len(migrations) == 0 {
+		log.Info("data-migrate", "No data migrations found")
+		return nil
+	}
+
+	if err := m.ensureDataTable(ctx, dbURL); err != nil {
+		return err
+	}
+	progress, err := m.dataProgresses(ctx, dbURL)
+	if err != nil {
+		return err
+	}
+	current, err := m.Version(ctx, dbURL)
+	if err != nil {
+		return err
+	}
+
+	var ran int
+	for _, dm := range migrations {
+		if p, ok := progress[dm.Version]; ok && p.CompletedAt != nil {
+			continue
+		}
+		if dm.Version > current {
+			log.Info("data-migrate", fmt.Sprintf("Stopping at %s: it needs schema version %d, current version is %d",
+				dm.File(), dm.Version, current))
+			break
+		}
+
+		completed, err := m.runDataLocked(ctx, dbURL, dm, opts)
+		if err != nil {
+			return err
+		}
+		if completed {
+			ran++
+		}
+	}
+
+	if ran == 0 {
+		log.Info("data-migrate", "No data migrations to run")
+	}
+	return nil
+}
+
+// runDataLocked runs a data migration holding its lock. It reports whether
+// it ran the migration, which another runner may have completed meanwhile.
+func (m *Migrator) runDataLocked(ctx context.Context, dbURL string, dm *DataMigration, opts DataOptions) (bool, error) {
+	ctx, unlock, err := m.lockData(ctx, dbURL, dm.Version)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	progress, err := m.dataProgresses(ctx, dbURL)
+	if err != nil {
+		return false, err
+	}
+	if p, ok := progress[dm.Version]; ok && p.CompletedAt != nil {
+		return false, nil
+	}
+
+	step := events.FromContext(ctx).Start("data-migrate", fmt.Sprintf("Running %s...", dm.File())).Database(dbURL)
+	step.AddFiles(dm.Path)
+	rows, err := m.runData(ctx, dbURL, dm, opts)
+	step.AddRows(rows)
+	if err := step.End(err); err != nil {
+		return false, fmt.Errorf("running %s: %w", dm.File(), err)
+	}
+	return true, nil
+}
+
+// runData runs a data migration batch by batch until a batch processes no
+// rows. Each batch commits together with its progress, so an interrupted
+// run resumes after the last committed batch. It returns the rows processed.
+func (m *Migrator) runData(ctx context.Context, dbURL string, dm *DataMigration, opts DataOptions) (int64, error) {
+	content, err := os.ReadFile(dm.Path)
+	if err != nil {
+		return 0, err
+	}
+	parsed, err := parseDataMigration(string(content))
+	if err != nil {
+		return 0, fmt.Errorf("parsing %s: %w", dm.File(), err)
+	}
+	if opts.BatchSize > 0 {
+		parsed.BatchSize = opts.BatchSize
+	}
+	if opts.Sleep > 0 {
+		parsed.Sleep = opts.Sleep
+	}
+
+	start := fmt.Sprintf("INSERT INTO %s (version_id, name, last_key) VALUES (%d, '%s', '%s') ON CONFLICT (version_id) DO NOTHING",
+		dataTable, dm.Version, strings.ReplaceAll(dm.Name, "'", "''"), strings.ReplaceAll(parsed.CursorStart, "'", "''"))
+	if _, err := m.exec.RunSQL(ctx, dbURL, start); err != nil {
+		return 0, fmt.Errorf("recording start: %w", err)
+	}
+	progress, err := m.dataProgresses(ctx, dbURL)
+	if err != nil {
+		return 0, err
+	}
+	cursor, done := progress[dm.Version].Cursor, progress[dm.Version].Rows
+
+	// The count query estimates the total, for the ETA
+	total := int64(-1)
+	if parsed.Count != "" {
+		result, err := m.exec.Query(ctx, dbURL, parsed.Count)
+		if err != nil {
+			return 0, fmt.Errorf("counting rows: %w", err)
+		}
+		if len(result.Rows) > 0 && len(result.Rows[0]) > 0 {
+			if remaining, err := strconv.ParseInt(result.Rows[0][0].String, 10, 64); err == nil {
+				total = done + remaining
+			}
+		}
+	}
+
+	log := events.FromContext(ctx)
+	settings := sessionDefaults(ctx).merge(parsed.Settings).sql()
+	began, reported := time.Now(), time.Now()
+	var processed int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return processed, err
+		}
+
+		var n int64
+		query := batchQuery(parsed.Batch, cursor, parsed.BatchSize, dm.Version)
+		err := m.exec.RunFunc(ctx, dbURL, dm.File(), true, func(ctx context.Context, db executor.DB) error {
+			if settings != "" {
+				if _, err := db.Exec(ctx, settings); err != nil {
+					return err
+				}
+			}
+			return db.QueryRow(ctx, query).Scan(&n, &cursor, &done)
+		})
+		if err != nil {
+			return processed, fmt.Errorf("batch after key %s: %w", cursor, err)
+		}
+		if n == 0 {
+			break
+		}
+		processed += n
+
+		if time.Since(reported) >= progressInterval {
+			log.Info("data-migrate", dataProgressMessage(dm, done, total, processed, time.Since(began)))
+			reported = time.Now()
+		}
+
+		if parsed.Sleep > 0 {
+			select {
+			case <-ctx.Done():
+				return processed, context.Cause(ctx)
+			case <-time.After(parsed.Sleep):
+			}
+		}
+	}
+
+	// In plan mode the first batch only printed itself and processed nothing
+	noter, planning := m.exec.(executor.Noter)
+	if planning {
+		noter.Note(fmt.Sprintf("repeat the batch of %s until it processes no rows", dm.File()))
+	}
+
+	complete := fmt.Sprintf("UPDATE %s SET completed_at = now(), updated_at = now() WHERE version_id = %d", dataTable, dm.Version)
+	if _, err := m.exec.RunSQL(ctx, dbURL, complete); err != nil {
+		return processed, fmt.Errorf("recording completion: %w", err)
+	}
+	if planning {
+		log.Info("data-migrate", fmt.Sprintf("%s: batches skipped in plan mode", dm.File()))
+	} else {
+		log.Info("data-migrate", fmt.Sprintf("%s: completed, %d row(s) in total", dm.File(), done))
+	}
+	return processed, nil
+}
+
+// dataProgressMessage reports rows processed and, when the total is known,
+// the percentage and estimated time left at the rate of the current run
+func dataProgressMessage(dm *DataMigration, done, total, processed int64, elapsed time.Duration) string {
+	if total <= 0 {
+		return fmt.Sprintf("%s: %d row(s) processed", dm.File(), done)
+	}
+	msg := fmt.Sprintf("%s: %d/%d row(s) (%d%%)", dm.File(), done, total, min(done*100/total, 100))
+	if remaining := total - done; remaining > 0 && processed > 0 {
+		eta := time.Duration(float64(elapsed) / float64(processed) * float64(remaining))
+		msg += fmt.Sprintf(", ETA %s", eta.Round(time.Second))
+	}
+	return msg
+}
@@ -0,0 +1,200 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmwinc/seedup/pkg/events"
+	"github.com/tmwinc/seedup/pkg/executor"
+)
+
+func TestParseDataMigration(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *parsedDataMigration
+	}{
+		{
+			name:    "defaults",
+			content: "-- seedup:batch\nUPDATE users SET active = true WHERE id > :cursor::bigint RETURNING id;\n",
+			want: &parsedDataMigration{
+				Batch:       "UPDATE users SET active = true WHERE id > :cursor::bigint RETURNING id",
+				BatchSize:   defaultBatchSize,
+				CursorStart: defaultCursorStart,
+			},
+		},
+		{
+			name: "settings and count",
+			content: "-- Backfill emails\n-- seedup:batch_size=500\n-- seedup:sleep=250ms\n-- seedup:cursor_start=''\n" +
+				"-- seedup:lock_timeout=2s\n" +
+				"-- seedup:count\nSELECT count(*) FROM users WHERE email IS NULL;\n\n" +
+				"-- seedup:batch\nUPDATE users SET email = lower(name)\nWHERE id IN (\n    SELECT id FROM users WHERE id > :cursor\n" +
+				"    ORDER BY id LIMIT :batch_size\n)\nRETURNING id\n",
+			want: &parsedDataMigration{
+				Batch: "UPDATE users SET email = lower(name)\nWHERE id IN (\n    SELECT id FROM users WHERE id > :cursor\n" +
+					"    ORDER BY id LIMIT :batch_size\n)\nRETURNING id",
+				Count:       "SELECT count(*) FROM users WHERE email IS NULL",
+				BatchSize:   500,
+				Sleep:       250 * time.Millisecond,
+				CursorStart: "''",
+				Settings:    SessionSettings{LockTimeout: "2s"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDataMigration(tt.content)
+			if err != nil {
+				t.Fatalf("parseDataMigration: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseDataMigration\n got: %#v\nwant: %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDataMigrationErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"missing batch", "-- seedup:count\nSELECT 1;\n", "missing '-- seedup:batch' query"},
+		{"no cursor", "-- seedup:batch\nUPDATE users SET a = 1 RETURNING id;\n", "batch query must use the :cursor placeholder"},
+		{"statement first", "UPDATE users SET a = 1;\n-- seedup:batch\n", "line 1: statement before '-- seedup:batch'"},
+		{"invalid batch size", "-- seedup:batch_size=0\n-- seedup:batch\nSELECT :cursor;\n", "line 1: batch_size: must be positive"},
+		{"invalid sleep", "-- seedup:sleep=soon\n-- seedup:batch\nSELECT :cursor;\n", "line 1: sleep: "},
+		{"unknown directive", "-- seedup:fast\n-- seedup:batch\nSELECT :cursor;\n", "line 1: fast: unknown directive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseDataMigration(tt.content)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("parseDataMigration error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		cursor string
+		want   string
+	}{
+		{
+			name:   "placeholders",
+			query:  "SELECT id FROM users WHERE id > :cursor::bigint ORDER BY id LIMIT :batch_size",
+			cursor: "41",
+			want:   "SELECT id FROM users WHERE id > '41'::bigint ORDER BY id LIMIT 100",
+		},
+		{
+			name:   "quoted cursor",
+			query:  "SELECT name FROM users WHERE name > :cursor LIMIT :batch_size",
+			cursor: "o'brien",
+			want:   "SELECT name FROM users WHERE name > 'o''brien' LIMIT 100",
+		},
+		{
+			name:   "casts and longer names are kept",
+			query:  ":cursor, x::cursor, :cursors, :batch_size_max",
+			cursor: "0",
+			want:   "'0', x::cursor, :cursors, :batch_size_max",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := batchQuery(tt.query, tt.cursor, 100, 20260101000000)
+			if !strings.HasPrefix(got, "WITH batch(key) AS (\n"+tt.want+"\n), progress AS (") {
+				t.Errorf("batchQuery =\n%s\nwant batch query %q", got, tt.want)
+			}
+			if !strings.Contains(got, "WHERE version_id = 20260101000000") {
+				t.Errorf("batchQuery does not record progress for the version:\n%s", got)
+			}
+		})
+	}
+}
+
+func TestBatchQueryWith(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		ctes  string
+		body  string
+	}{
+		{
+			name: "data-modifying CTE",
+			query: "-- Deactivate in batches\nWITH next AS (\n    SELECT id FROM users WHERE id > :cursor ORDER BY id LIMIT :batch_size\n), " +
+				"done AS (\n    UPDATE users SET active = false FROM next WHERE users.id = next.id RETURNING users.id\n)\nSELECT id FROM done",
+			ctes: "WITH next AS (\n    SELECT id FROM users WHERE id > '7' ORDER BY id LIMIT 100\n), " +
+				"done AS (\n    UPDATE users SET active = false FROM next WHERE users.id = next.id RETURNING users.id\n)",
+			body: "SELECT id FROM done",
+		},
+		{
+			name:  "column list and quoted parenthesis",
+			query: "with recursive moved(id) as (DELETE FROM queue WHERE id > :cursor AND note <> ')' RETURNING id) SELECT id FROM moved",
+			ctes:  "with recursive moved(id) as (DELETE FROM queue WHERE id > '7' AND note <> ')' RETURNING id)",
+			body:  "SELECT id FROM moved",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := batchQuery(tt.query, "7", 100, 20260101000000)
+			if want := tt.ctes + ",\nbatch(key) AS (\n" + tt.body + "\n), progress AS ("; !strings.HasPrefix(got, want) {
+				t.Errorf("batchQuery =\n%s\nwant it to start with:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestBatchQueryCursor(t *testing.T) {
+	// max() is not defined for every key type, uuid among them
+	got := batchQuery("SELECT id FROM users WHERE id > :cursor::uuid LIMIT :batch_size", "", 100, 1)
+	if !strings.Contains(got, "last_key = coalesce((SELECT key::text FROM batch ORDER BY key DESC LIMIT 1), last_key)") ||
+		strings.Contains(got, "max(") {
+		t.Errorf("batchQuery does not record the last key in key order:\n%s", got)
+	}
+}
+
+func TestRunDataPlan(t *testing.T) {
+	dir := t.TempDir()
+	dataPath := filepath.Join(dir, dataDir, "00002_backfill.sql")
+	if err := os.MkdirAll(filepath.Dir(dataPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	content := "-- seedup:batch\nUPDATE users SET active = true WHERE id > :cursor::bigint RETURNING id;\n"
+	if err := os.WriteFile(dataPath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	exec := &fakeExecutor{}
+	exec.tables(versionTable)
+	exec.applied([2]int64{2, 2})
+	var plan, log strings.Builder
+	ctx := events.WithLogger(testContext(), events.New(&log, events.FormatText))
+
+	if err := New(executor.NewPlanner(exec, &plan)).RunData(ctx, testDatabaseURL, dir, DataOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(exec.sql) != 0 || len(exec.funcs) != 0 {
+		t.Errorf("plan mode modified the database: %q %q", exec.sql, exec.funcs)
+	}
+	for _, want := range []string{"(00002_backfill.sql)", "repeat the batch of 00002_backfill.sql until it processes no rows", "completed_at = now()"} {
+		if !strings.Contains(plan.String(), want) {
+			t.Errorf("plan does not contain %q:\n%s", want, plan.String())
+		}
+	}
+	if !strings.Contains(log.String(), "00002_backfill.sql: batches skipped in plan mode") || strings.Contains(log.String(), "completed,") {
+		t.Errorf("output does not report the batches as skipped:\n%s", log.String())
+	}
+}
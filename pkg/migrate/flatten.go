@@ -4,10 +4,11 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/tmwinc/seedup/pkg/events"
 	"github.com/tmwinc/seedup/pkg/executor"
 )
 
@@ -22,8 +23,13 @@ func NewFlattener(exec executor.Executor) *Flattener {
 }
 
 // Flatten consolidates all applied migrations into a single initial migration
-// It dumps the current schema and replaces all migration files with a single initial file
+// It dumps the current schema and replaces all versioned migration files with a single initial file
 func (f *Flattener) Flatten(ctx context.Context, dbURL, migrationsDir string) error {
+	step := events.FromContext(ctx).Start("flatten", "").Database(dbURL)
+	return step.End(f.flatten(ctx, dbURL, migrationsDir, step))
+}
+
+func (f *Flattener) flatten(ctx context.Context, dbURL, migrationsDir string, step *events.Step) error {
 	// Get all applied migration versions
 	versions, err := f.getAppliedVersions(ctx, dbURL)
 	if err != nil {
@@ -31,7 +37,7 @@ func (f *Flattener) Flatten(ctx context.Context, dbURL, migrationsDir string) er
 	}
 
 	if len(versions) == 0 {
-		fmt.Println("No applied migrations found, skipping flatten")
+		events.FromContext(ctx).Info("flatten", "No applied migrations found, skipping flatten")
 		return nil
 	}
 
@@ -39,28 +45,71 @@ func (f *Flattener) Flatten(ctx context.Context, dbURL, migrationsDir string) er
 	latestVersion := versions[len(versions)-1]
 
 	// Dump the current schema
-	schema, err := f.dumpSchema(ctx, dbURL)
+	schema, err := dumpSchema(ctx, f.exec, dbURL)
 	if err != nil {
 		return fmt.Errorf("dumping schema: %w", err)
 	}
 
-	// Delete all existing migration files
+	// The dump contains the objects of the repeatable migrations but not
+	// their bookkeeping table, so the initial migration records them as
+	// applied; otherwise a fresh database would re-apply them on top of it
+	applied, err := New(f.exec).appliedRepeatables(ctx, dbURL)
+	if err != nil {
+		return err
+	}
+
+	// Stop here if interrupted; the file changes below are applied as a unit
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Create the new initial migration before removing anything, so a failure
+	// never leaves the directory without the schema
+	initialPath := filepath.Join(migrationsDir, latestVersion+"_initial.sql")
+	content := append(initialMigration(schema), recordRepeatables(applied)...)
+	if err := f.exec.WriteFile(initialPath, content); err != nil {
+		return fmt.Errorf("writing initial migration: %w", err)
+	}
+	step.AddFiles(initialPath)
+
+	// Delete all other existing migration files. Repeatable migrations are
+	// kept and only re-applied once they change. Go migrations are removed
+	// too; their code is compiled into a project binary that must be rebuilt
+	// afterwards.
 	for _, version := range versions {
-		pattern := filepath.Join(migrationsDir, version+"_*.sql")
-		matches, _ := filepath.Glob(pattern)
-		for _, match := range matches {
-			if err := os.Remove(match); err != nil {
+		sqlFiles, _ := filepath.Glob(filepath.Join(migrationsDir, version+"_*.sql"))
+		goFiles, _ := filepath.Glob(filepath.Join(migrationsDir, version+"_*.go"))
+		for _, match := range append(sqlFiles, goFiles...) {
+			if match == initialPath {
+				continue
+			}
+			if err := f.exec.Remove(match); err != nil {
 				return fmt.Errorf("removing migration file %s: %w", match, err)
 			}
+			step.AddFiles(match)
 		}
 	}
 
-	// Create the new initial migration
-	initialPath := filepath.Join(migrationsDir, latestVersion+"_initial.sql")
-	if err := f.writeInitialMigration(initialPath, schema); err != nil {
-		return fmt.Errorf("writing initial migration: %w", err)
+	// The database recorded the checksum of the file the initial migration
+	// replaces; record the new one so verify does not report it as modified.
+	// Like the file changes, this is not cut short by an interrupt.
+	return f.recordChecksum(context.WithoutCancel(ctx), dbURL, latestVersion, checksum(content))
+}
+
+// recordChecksum records the checksum of a migration file for an applied
+// version, unless the database predates checksums
+func (f *Flattener) recordChecksum(ctx context.Context, dbURL, version, sum string) error {
+	exists, err := New(f.exec).hasTable(ctx, dbURL, checksumTable)
+	if err != nil || !exists {
+		return err
 	}
 
+	query := fmt.Sprintf(`INSERT INTO %s (version_id, checksum) VALUES (%s, '%s')
+    ON CONFLICT (version_id) DO UPDATE SET checksum = EXCLUDED.checksum, recorded_at = now()`,
+		checksumTable, version, sum)
+	if _, err := f.exec.RunSQL(ctx, dbURL, query); err != nil {
+		return fmt.Errorf("recording checksum of initial migration: %w", err)
+	}
 	return nil
 }
 
@@ -71,62 +120,31 @@ func (f *Flattener) getAppliedVersions(ctx context.Context, dbURL string) ([]str
 		WHERE table_schema = 'public'
 		AND table_name = 'goose_db_version'
 	)`
-	exists, err := f.exec.RunSQL(ctx, dbURL, checkQuery)
+	exists, err := f.exec.Query(ctx, dbURL, checkQuery)
 	if err != nil {
 		return nil, err
 	}
-	if strings.TrimSpace(exists) != "t" {
+	if len(exists.Rows) == 0 || exists.Rows[0][0].String != "t" {
 		// Table doesn't exist, no migrations have been run
 		return nil, nil
 	}
 
-	output, err := f.exec.RunSQL(ctx, dbURL,
+	result, err := f.exec.Query(ctx, dbURL,
 		"SELECT version_id FROM goose_db_version WHERE is_applied ORDER BY version_id")
 	if err != nil {
 		return nil, err
 	}
 
 	var versions []string
-	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
-		line = strings.TrimSpace(line)
-		if line != "" {
-			versions = append(versions, line)
-		}
+	for _, row := range result.Rows {
+		versions = append(versions, row[0].String)
 	}
 
 	return versions, nil
 }
 
-func (f *Flattener) dumpSchema(ctx context.Context, dbURL string) (string, error) {
-	output, err := f.exec.RunWithOutput(ctx, "pg_dump", dbURL,
-		"--schema-only",
-		"--no-owner",
-		"--exclude-table=public.goose_db_version",
-		"--exclude-table=public.goose_db_version_id_seq",
-		"--no-privileges",
-	)
-	if err != nil {
-		return "", err
-	}
-
-	// Clean up the schema dump
-	// Remove search_path config that can cause issues
-	// Remove CloudSQL specific commands
-	var cleanedLines []string
-	for _, line := range strings.Split(output, "\n") {
-		if strings.Contains(line, "set_config") && strings.Contains(line, "search_path") {
-			continue
-		}
-		if strings.HasPrefix(line, "\\restrict") || strings.HasPrefix(line, "\\unrestrict") {
-			continue
-		}
-		cleanedLines = append(cleanedLines, line)
-	}
-
-	return strings.Join(cleanedLines, "\n"), nil
-}
-
-func (f *Flattener) writeInitialMigration(path, schema string) error {
+// initialMigration returns the content of a migration creating a dumped schema
+func initialMigration(schema string) []byte {
 	var buf bytes.Buffer
 
 	buf.WriteString("-- +goose Up\n")
@@ -134,5 +152,33 @@ func (f *Flattener) writeInitialMigration(path, schema string) error {
 	buf.WriteString(schema)
 	buf.WriteString("\n-- +goose StatementEnd\n")
 
-	return os.WriteFile(path, buf.Bytes(), 0644)
+	return buf.Bytes()
+}
+
+// recordRepeatables returns the Up statements recording repeatable migrations
+// as applied with the given checksums, or nothing if there are none
+func recordRepeatables(applied map[string]string) []byte {
+	if len(applied) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(applied))
+	for name := range applied {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.WriteString("\n")
+	buf.WriteString(createRepeatableTable())
+	buf.WriteString(";\n\n")
+	fmt.Fprintf(&buf, "INSERT INTO %s (name, checksum) VALUES\n", repeatableTable)
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteString(",\n")
+		}
+		fmt.Fprintf(&buf, "    ('%s', '%s')", strings.ReplaceAll(name, "'", "''"), applied[name])
+	}
+	buf.WriteString("\nON CONFLICT (name) DO NOTHING;\n")
+	return buf.Bytes()
 }
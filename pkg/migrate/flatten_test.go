@@ -0,0 +1,40 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRecordRepeatables(t *testing.T) {
+	if got := recordRepeatables(nil); got != nil {
+		t.Errorf("recordRepeatables(nil) = %q, want nothing", got)
+	}
+
+	got := string(recordRepeatables(map[string]string{
+		"R__views.sql":     "b2",
+		"R__author's.sql":  "c3",
+		"R__functions.sql": "a1",
+	}))
+
+	if !strings.HasPrefix(got, "\n"+createRepeatableTable()+";\n\n") {
+		t.Errorf("statements do not start by creating the table:\n%s", got)
+	}
+	want := `INSERT INTO seedup_repeatable_migrations (name, checksum) VALUES
+    ('R__author''s.sql', 'c3'),
+    ('R__functions.sql', 'a1'),
+    ('R__views.sql', 'b2')
+ON CONFLICT (name) DO NOTHING;
+`
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("statements =\n%s\nwant them to end with:\n%s", got, want)
+	}
+
+	// The statements run as part of the initial migration's Up section
+	parsed, err := parseMigration(string(initialMigration("CREATE TABLE t ();")) + got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(parsed.Up, "ON CONFLICT (name) DO NOTHING") {
+		t.Errorf("Up section does not record the repeatable migrations:\n%s", parsed.Up)
+	}
+}
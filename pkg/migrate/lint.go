@@ -0,0 +1,454 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tmwinc/seedup/pkg/executor"
+)
+
+// Severity is how a lint finding is reported
+type Severity string
+
+const (
+	SeverityError   Severity = "error"   // Fails the lint run
+	SeverityWarning Severity = "warning" // Reported but doesn't fail
+	SeverityOff     Severity = "off"     // Rule disabled
+)
+
+// LintRule is a check applied to migration files
+type LintRule struct {
+	ID          string
+	Description string
+	Severity    Severity // Default severity
+}
+
+// LintRules lists the available rules with their default severity
+var LintRules = []LintRule{
+	{"create-index-concurrently", "CREATE INDEX on an existing table without CONCURRENTLY blocks writes", SeverityError},
+	{"concurrently-in-transaction", "CONCURRENTLY cannot run inside the migration's transaction", SeverityError},
+	{"not-null-without-default", "adding a NOT NULL column without a default fails on non-empty tables", SeverityError},
+	{"column-type-change", "changing a column type rewrites the table under an exclusive lock", SeverityWarning},
+	{"drop-column", "dropping a column still read by deployed code, unless deprecated in an earlier migration", SeverityError},
+	{"drop-table", "dropping a table still read by deployed code, unless deprecated in an earlier migration", SeverityError},
+	{"missing-down", "migration has no Down section", SeverityWarning},
+	{"statement-block", "unbalanced StatementBegin/StatementEnd annotations", SeverityError},
+}
+
+// LintOptions configures Lint
+type LintOptions struct {
+	Severities map[string]Severity // Overrides of the default severity by rule ID
+}
+
+// LintFinding is a rule violation in a migration file
+type LintFinding struct {
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+func (f LintFinding) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s [%s]", f.File, f.Line, f.Severity, f.Message, f.Rule)
+}
+
+// ParseSeverities parses comma-separated rule=severity pairs, e.g.
+// "drop-column=warning,missing-down=off"
+func ParseSeverities(spec string) (map[string]Severity, error) {
+	severities := make(map[string]Severity)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		rule, level, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid severity %q: expected rule=error|warning|off", pair)
+		}
+		rule, level = strings.TrimSpace(rule), strings.TrimSpace(level)
+		if !isLintRule(rule) {
+			return nil, fmt.Errorf("unknown lint rule %q", rule)
+		}
+		switch Severity(level) {
+		case SeverityError, SeverityWarning, SeverityOff:
+			severities[rule] = Severity(level)
+		default:
+			return nil, fmt.Errorf("invalid severity %q for %s: expected error, warning or off", level, rule)
+		}
+	}
+	return severities, nil
+}
+
+func isLintRule(id string) bool {
+	for _, rule := range LintRules {
+		if rule.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Lint checks every migration in the directory for risky operations.
+//
+// A finding on a statement is suppressed by a "-- seedup:lint-ignore <rule>[,<rule>...]"
+// comment in or directly above the statement, or after it on the line of its
+// terminating semicolon; file-level findings (missing-down,
+// statement-block) by such a comment anywhere in the file. "all" suppresses every rule.
+// Operations on tables created in the same migration are not flagged.
+func (m *Migrator) Lint(migrationsDir string, opts LintOptions) ([]LintFinding, error) {
+	migrations, err := collectMigrations(migrationsDir)
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations: %w", err)
+	}
+
+	l := &linter{opts: opts, deprecated: make(map[string]bool)}
+	for _, mig := range migrations {
+		content, err := os.ReadFile(mig.Path)
+		if err != nil {
+			return nil, err
+		}
+		l.lintFile(mig.File(), string(content))
+	}
+
+	sort.SliceStable(l.findings, func(i, j int) bool {
+		if l.findings[i].File != l.findings[j].File {
+			return l.findings[i].File < l.findings[j].File
+		}
+		return l.findings[i].Line < l.findings[j].Line
+	})
+	return l.findings, nil
+}
+
+// linter carries state across the files of a migrations directory
+type linter struct {
+	opts       LintOptions
+	deprecated map[string]bool // Tables and table.column names marked deprecated so far
+	findings   []LintFinding
+}
+
+var (
+	identPattern = `(?:"(?:[^"]|"")+"|[\w$]+)`
+	namePattern  = identPattern + `(?:\s*\.\s*` + identPattern + `){0,2}`
+
+	lintIgnoreRe   = regexp.MustCompile(`(?i)--\s*seedup:lint-ignore[ \t]+([\w,\t -]+)`)
+	createTableRe  = regexp.MustCompile(`(?is)^CREATE\s+(?:(?:GLOBAL|LOCAL)\s+)?(?:(?:TEMP|TEMPORARY|UNLOGGED)\s+)?TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?(` + namePattern + `)`)
+	createIndexRe  = regexp.MustCompile(`(?is)^CREATE\s+(?:UNIQUE\s+)?INDEX\s+(CONCURRENTLY\s+)?(?:IF\s+NOT\s+EXISTS\s+)?(?:` + identPattern + `\s+)?ON\s+(?:ONLY\s+)?(` + namePattern + `)`)
+	concurrentlyRe = regexp.MustCompile(`(?is)^(?:CREATE\s+(?:UNIQUE\s+)?INDEX|DROP\s+INDEX|REINDEX\s+\w+)\s+CONCURRENTLY\b`)
+	alterTableRe   = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?(` + namePattern + `)\s+(.*)$`)
+	addColumnRe    = regexp.MustCompile(`(?is)^ADD\s+(?:COLUMN\s+)?(?:IF\s+NOT\s+EXISTS\s+)?(` + identPattern + `)\s+(.*)$`)
+	alterTypeRe    = regexp.MustCompile(`(?is)^ALTER\s+(?:COLUMN\s+)?(` + identPattern + `)\s+(?:SET\s+DATA\s+)?TYPE\b`)
+	dropColumnRe   = regexp.MustCompile(`(?is)^DROP\s+(?:COLUMN\s+)?(?:IF\s+EXISTS\s+)?(` + identPattern + `)`)
+	dropTableRe    = regexp.MustCompile(`(?is)^DROP\s+TABLE\s+(?:IF\s+EXISTS\s+)?(` + namePattern + `(?:\s*,\s*` + namePattern + `)*)`)
+	commentOnRe    = regexp.MustCompile(`(?is)^COMMENT\s+ON\s+(TABLE|COLUMN)\s+(` + namePattern + `)\s+IS\s+'((?:[^']|'')*)'`)
+	notNullRe      = regexp.MustCompile(`(?i)\bNOT\s+NULL\b`)
+	defaultRe      = regexp.MustCompile(`(?i)\b(?:DEFAULT|GENERATED)\b`)
+	constraintRe   = regexp.MustCompile(`(?i)^ADD\s+(?:CONSTRAINT|PRIMARY|UNIQUE|FOREIGN|CHECK|EXCLUDE)\b`)
+	nameDotRe      = regexp.MustCompile(`\s*\.\s*`)
+)
+
+// report records a finding unless its rule is disabled or suppressed
+func (l *linter) report(file string, line int, rule, message string, ignored map[string]bool) {
+	if ignored[rule] || ignored["all"] {
+		return
+	}
+	severity := l.severity(rule)
+	if severity == SeverityOff {
+		return
+	}
+	l.findings = append(l.findings, LintFinding{File: file, Line: line, Rule: rule, Severity: severity, Message: message})
+}
+
+func (l *linter) severity(rule string) Severity {
+	if s, ok := l.opts.Severities[rule]; ok {
+		return s
+	}
+	for _, r := range LintRules {
+		if r.ID == rule {
+			return r.Severity
+		}
+	}
+	return SeverityError
+}
+
+func (l *linter) lintFile(file, content string) {
+	fileIgnored := lintIgnores(content)
+
+	if line, msg := checkStatementBlocks(content); msg != "" {
+		l.report(file, line, "statement-block", msg, fileIgnored)
+		return
+	}
+
+	parsed, err := parseMigration(content)
+	if err != nil {
+		l.findings = append(l.findings, LintFinding{File: file, Line: 1, Rule: "parse", Severity: SeverityError, Message: err.Error()})
+		return
+	}
+
+	if !parsed.HasDown || isBlank(parsed.Down) {
+		l.report(file, 1, "missing-down", "migration has no Down section", fileIgnored)
+	}
+
+	created := make(map[string]bool)
+	lines := strings.Split(parsed.Up, "\n")
+	commands := executor.SplitScript(parsed.Up)
+	for i, cmd := range commands {
+		if cmd.Meta {
+			continue
+		}
+		start, end := statementStart(commands, i), statementEnd(cmd)
+		line := parsed.UpLine + firstCodeLine(lines, start, end) - 1
+		ignored := lintIgnores(strings.Join(lines[start-1:end], "\n"))
+		l.lintStatement(file, line, stripComments(cmd.Text), parsed.NoTransaction, created, ignored)
+	}
+}
+
+// statementStart returns the first line whose lint-ignore comments apply to
+// the i-th command. A command's text starts right after the previous
+// semicolon, so a comment trailing the previous statement on its last line
+// belongs to that statement instead.
+func statementStart(commands []executor.ScriptCommand, i int) int {
+	cmd := commands[i]
+	if i == 0 || cmd.Line != statementEnd(commands[i-1]) {
+		return cmd.Line
+	}
+	first, _, _ := strings.Cut(cmd.Text, "\n")
+	if strings.HasPrefix(strings.TrimSpace(first), "--") {
+		return cmd.Line + 1
+	}
+	return cmd.Line
+}
+
+// statementEnd returns the line a command ends on: the line of its
+// terminating semicolon, where a trailing comment applies to it
+func statementEnd(cmd executor.ScriptCommand) int {
+	return cmd.Line + strings.Count(cmd.Text, "\n")
+}
+
+// firstCodeLine returns the first line from start to end that is not blank
+// or a comment, where findings on the statement are reported
+func firstCodeLine(lines []string, start, end int) int {
+	for line := start; line <= end; line++ {
+		if trimmed := strings.TrimSpace(lines[line-1]); trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+			return line
+		}
+	}
+	return start
+}
+
+func (l *linter) lintStatement(file string, line int, stmt string, noTransaction bool, created, ignored map[string]bool) {
+	stmt = strings.TrimSuffix(strings.TrimSpace(stmt), ";")
+
+	if concurrentlyRe.MatchString(stmt) && !noTransaction {
+		l.report(file, line, "concurrently-in-transaction",
+			"CONCURRENTLY requires the migration to be marked '-- +goose NO TRANSACTION' or '-- seedup:no-transaction'", ignored)
+	}
+
+	if m := createTableRe.FindStringSubmatch(stmt); m != nil {
+		created[normalizeName(m[1])] = true
+		return
+	}
+
+	if m := createIndexRe.FindStringSubmatch(stmt); m != nil {
+		table := normalizeName(m[2])
+		if m[1] == "" && !created[table] {
+			l.report(file, line, "create-index-concurrently",
+				fmt.Sprintf("CREATE INDEX on %s without CONCURRENTLY blocks writes while the index builds", table), ignored)
+		}
+		return
+	}
+
+	if m := commentOnRe.FindStringSubmatch(stmt); m != nil {
+		if strings.Contains(strings.ToLower(m[3]), "deprecated") {
+			l.deprecated[normalizeName(m[2])] = true
+		}
+		return
+	}
+
+	if m := dropTableRe.FindStringSubmatch(stmt); m != nil {
+		for _, name := range splitTopLevel(m[1]) {
+			table := normalizeName(name)
+			if !created[table] && !l.deprecated[table] {
+				l.report(file, line, "drop-table",
+					fmt.Sprintf("DROP TABLE %s without deprecating it first (COMMENT ON TABLE ... IS 'deprecated' in an earlier migration)", table), ignored)
+			}
+		}
+		return
+	}
+
+	m := alterTableRe.FindStringSubmatch(stmt)
+	if m == nil {
+		return
+	}
+	table := normalizeName(m[1])
+	if created[table] {
+		return
+	}
+	for _, action := range splitTopLevel(m[2]) {
+		switch {
+		case constraintRe.MatchString(action):
+			// ADD CONSTRAINT / PRIMARY KEY / ...: not a column
+		case addColumnRe.MatchString(action):
+			c := addColumnRe.FindStringSubmatch(action)
+			if notNullRe.MatchString(c[2]) && !defaultRe.MatchString(c[2]) {
+				l.report(file, line, "not-null-without-default",
+					fmt.Sprintf("adding NOT NULL column %s.%s without a DEFAULT fails if the table has rows", table, normalizeName(c[1])), ignored)
+			}
+		case alterTypeRe.MatchString(action):
+			c := alterTypeRe.FindStringSubmatch(action)
+			l.report(file, line, "column-type-change",
+				fmt.Sprintf("changing the type of %s.%s may rewrite the table under an exclusive lock", table, normalizeName(c[1])), ignored)
+		case dropColumnRe.MatchString(action):
+			c := dropColumnRe.FindStringSubmatch(action)
+			column := normalizeName(c[1])
+			if strings.EqualFold(column, "constraint") {
+				continue
+			}
+			if !l.deprecated[table+"."+column] {
+				l.report(file, line, "drop-column",
+					fmt.Sprintf("DROP COLUMN %s.%s without deprecating it first (COMMENT ON COLUMN ... IS 'deprecated' in an earlier migration)", table, column), ignored)
+			}
+		}
+	}
+}
+
+// checkStatementBlocks returns the line and description of the first
+// unbalanced StatementBegin/StatementEnd annotation
+func checkStatementBlocks(content string) (int, string) {
+	open := 0
+	for i, line := range strings.Split(content, "\n") {
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "-- +goose statementbegin":
+			if open > 0 {
+				return i + 1, "StatementBegin inside another StatementBegin block"
+			}
+			open = i + 1
+		case "-- +goose statementend":
+			if open == 0 {
+				return i + 1, "StatementEnd without StatementBegin"
+			}
+			open = 0
+		case "-- +goose up", "-- +goose down":
+			if open > 0 {
+				return open, "StatementBegin not closed before the next section"
+			}
+		}
+	}
+	if open > 0 {
+		return open, "StatementBegin without matching StatementEnd"
+	}
+	return 0, ""
+}
+
+// lintIgnores returns the rules suppressed by lint-ignore comments in text
+func lintIgnores(text string) map[string]bool {
+	ignored := make(map[string]bool)
+	for _, m := range lintIgnoreRe.FindAllStringSubmatch(text, -1) {
+		for _, rule := range strings.FieldsFunc(m[1], func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			ignored[strings.ToLower(rule)] = true
+		}
+	}
+	return ignored
+}
+
+// stripComments removes SQL comments outside of quoted strings and identifiers
+func stripComments(sql string) string {
+	var out strings.Builder
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := i + 1
+			for end < len(sql) {
+				if sql[end] == c {
+					if end+1 < len(sql) && sql[end+1] == c {
+						end += 2
+						continue
+					}
+					break
+				}
+				end++
+			}
+			out.WriteString(sql[i:min(end+1, len(sql))])
+			i = end
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+			out.WriteByte('\n')
+		case c == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			depth := 0
+			for ; i < len(sql); i++ {
+				if sql[i] == '/' && i+1 < len(sql) && sql[i+1] == '*' {
+					depth++
+					i++
+				} else if sql[i] == '*' && i+1 < len(sql) && sql[i+1] == '/' {
+					depth--
+					i++
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			out.WriteByte(' ')
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return strings.TrimSpace(out.String())
+}
+
+// splitTopLevel splits s on commas outside parentheses and quotes
+func splitTopLevel(s string) []string {
+	var (
+		parts []string
+		depth int
+		quote byte
+		start int
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, strings.TrimSpace(s[start:]))
+}
+
+// normalizeName lower-cases unquoted identifiers, removes quotes and the
+// public schema, so "public"."Users" and Users compare as written by PostgreSQL
+func normalizeName(name string) string {
+	var parts []string
+	for _, part := range nameDotRe.Split(strings.TrimSpace(name), -1) {
+		if strings.HasPrefix(part, `"`) && strings.HasSuffix(part, `"`) && len(part) > 1 {
+			part = strings.ReplaceAll(part[1:len(part)-1], `""`, `"`)
+		} else {
+			part = strings.ToLower(part)
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) > 1 && parts[0] == "public" {
+		parts = parts[1:]
+	}
+	return strings.Join(parts, ".")
+}
+
+// isBlank reports whether a section contains only whitespace and comments
+func isBlank(section string) bool {
+	return stripComments(section) == ""
+}
@@ -0,0 +1,215 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// lintFindings lints a single migration and returns its findings as "line rule"
+func lintFindings(content string, opts LintOptions) []string {
+	l := &linter{opts: opts, deprecated: make(map[string]bool)}
+	l.lintFile("00001_test.sql", content)
+	var findings []string
+	for _, f := range l.findings {
+		findings = append(findings, fmt.Sprintf("%d %s", f.Line, f.Rule))
+	}
+	return findings
+}
+
+func TestLint(t *testing.T) {
+	const down = "\n-- +goose Down\nSELECT 1;\n"
+
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "index without concurrently",
+			content: "-- +goose Up\nCREATE INDEX users_email_idx ON users (email);" + down,
+			want:    []string{"2 create-index-concurrently"},
+		},
+		{
+			name:    "index on a table created in the migration",
+			content: "-- +goose Up\nCREATE TABLE users (email text);\nCREATE INDEX users_email_idx ON public.users (email);" + down,
+		},
+		{
+			name:    "concurrently in a transaction",
+			content: "-- +goose Up\nCREATE INDEX CONCURRENTLY users_email_idx ON users (email);" + down,
+			want:    []string{"2 concurrently-in-transaction"},
+		},
+		{
+			name:    "concurrently without a transaction",
+			content: "-- +goose Up\n-- seedup:no-transaction\nCREATE INDEX CONCURRENTLY users_email_idx ON users (email);" + down,
+		},
+		{
+			name: "columns",
+			content: "-- +goose Up\nALTER TABLE users ADD COLUMN a text NOT NULL;\n" +
+				"ALTER TABLE users ADD COLUMN b text NOT NULL DEFAULT '', ADD COLUMN c int;\n" +
+				"ALTER TABLE users ALTER COLUMN d TYPE bigint;\n" +
+				"ALTER TABLE users DROP COLUMN e, DROP CONSTRAINT users_f_check;" + down,
+			want: []string{"2 not-null-without-default", "4 column-type-change", "5 drop-column"},
+		},
+		{
+			name:    "drop table",
+			content: "-- +goose Up\nDROP TABLE IF EXISTS users, posts;" + down,
+			want:    []string{"2 drop-table", "2 drop-table"},
+		},
+		{
+			name:    "missing down",
+			content: "-- +goose Up\nSELECT 1;\n",
+			want:    []string{"1 missing-down"},
+		},
+		{
+			name:    "empty down",
+			content: "-- +goose Up\nSELECT 1;\n-- +goose Down\n\n",
+			want:    []string{"1 missing-down"},
+		},
+		{
+			name:    "unbalanced statement block",
+			content: "-- +goose Up\n-- +goose StatementBegin\nSELECT 1;\n-- +goose Down\nSELECT 1;\n",
+			want:    []string{"2 statement-block"},
+		},
+		{
+			name:    "ignore on the line above",
+			content: "-- +goose Up\n-- seedup:lint-ignore create-index-concurrently\nCREATE INDEX i ON users (email);" + down,
+		},
+		{
+			name: "ignore trailing the statement",
+			content: "-- +goose Up\nCREATE INDEX i ON users (email); -- seedup:lint-ignore create-index-concurrently\n" +
+				"CREATE INDEX j ON users (name);" + down,
+			want: []string{"3 create-index-concurrently"},
+		},
+		{
+			name: "ignore trailing a multi-line statement",
+			content: "-- +goose Up\nALTER TABLE users\n    DROP COLUMN e; -- seedup:lint-ignore drop-column\n" +
+				"ALTER TABLE users DROP COLUMN f;" + down,
+			want: []string{"4 drop-column"},
+		},
+		{
+			name:    "ignore trailing the last statement",
+			content: "-- +goose Up\nSELECT 1;\nDROP TABLE users; -- seedup:lint-ignore drop-table\n" + down,
+		},
+		{
+			name:    "ignore another rule",
+			content: "-- +goose Up\n-- seedup:lint-ignore drop-table\nCREATE INDEX i ON users (email);" + down,
+			want:    []string{"3 create-index-concurrently"},
+		},
+		{
+			name:    "ignore several rules",
+			content: "-- +goose Up\nALTER TABLE users ALTER COLUMN a TYPE int, DROP COLUMN b; -- seedup:lint-ignore column-type-change, drop-column" + down,
+		},
+		{
+			name:    "ignore all",
+			content: "-- +goose Up\n-- seedup:lint-ignore all\nDROP TABLE users;" + down,
+		},
+		{
+			name:    "file-level ignore anywhere",
+			content: "-- +goose Up\nSELECT 1;\n-- seedup:lint-ignore missing-down\n",
+		},
+		{
+			name:    "parse error",
+			content: "CREATE TABLE t (id int);\n",
+			want:    []string{"1 parse"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lintFindings(tt.content, LintOptions{})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findings = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLintSeverities(t *testing.T) {
+	content := "-- +goose Up\nDROP TABLE users;\nALTER TABLE posts ALTER COLUMN a TYPE int;\n"
+	l := &linter{opts: LintOptions{Severities: map[string]Severity{
+		"drop-table":         SeverityWarning,
+		"column-type-change": SeverityError,
+		"missing-down":       SeverityOff,
+	}}, deprecated: make(map[string]bool)}
+	l.lintFile("00001_test.sql", content)
+
+	var got []string
+	for _, f := range l.findings {
+		got = append(got, fmt.Sprintf("%s %s", f.Rule, f.Severity))
+	}
+	want := []string{"drop-table warning", "column-type-change error"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findings = %q, want %q", got, want)
+	}
+}
+
+func TestLintDeprecated(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"00001_deprecate.sql": "-- +goose Up\nCOMMENT ON COLUMN users.legacy IS 'deprecated: use email';\n" +
+			"COMMENT ON TABLE public.old_users IS 'Deprecated since v2';\n-- +goose Down\nSELECT 1;\n",
+		"00002_drop.sql": "-- +goose Up\nALTER TABLE users DROP COLUMN legacy, DROP COLUMN name;\nDROP TABLE old_users;\n" +
+			"-- +goose Down\nSELECT 1;\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	findings, err := New(nil).Lint(dir, LintOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []LintFinding{{
+		File:     "00002_drop.sql",
+		Line:     2,
+		Rule:     "drop-column",
+		Severity: SeverityError,
+		Message:  "DROP COLUMN users.name without deprecating it first (COMMENT ON COLUMN ... IS 'deprecated' in an earlier migration)",
+	}}
+	if !reflect.DeepEqual(findings, want) {
+		t.Errorf("findings = %v, want %v", findings, want)
+	}
+}
+
+func TestLintIgnores(t *testing.T) {
+	tests := []struct {
+		text string
+		want map[string]bool
+	}{
+		{"SELECT 1;", map[string]bool{}},
+		{"-- seedup:lint-ignore drop-table", map[string]bool{"drop-table": true}},
+		{"--seedup:lint-ignore Drop-Table,drop-column", map[string]bool{"drop-table": true, "drop-column": true}},
+		{"DROP TABLE t; -- seedup:lint-ignore drop-table, missing-down\n-- seedup:lint-ignore all",
+			map[string]bool{"drop-table": true, "missing-down": true, "all": true}},
+		{"-- seedup:lint-ignore drop-table: deprecated in v2", map[string]bool{"drop-table": true}},
+		{"-- seedup:lint-ignore", map[string]bool{}},
+	}
+
+	for _, tt := range tests {
+		if got := lintIgnores(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lintIgnores(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseSeverities(t *testing.T) {
+	got, err := ParseSeverities(" drop-column=warning, missing-down = off,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Severity{"drop-column": SeverityWarning, "missing-down": SeverityOff}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseSeverities = %v, want %v", got, want)
+	}
+
+	for _, spec := range []string{"drop-column", "no-such-rule=error", "drop-column=fatal"} {
+		if _, err := ParseSeverities(spec); err == nil {
+			t.Errorf("ParseSeverities(%q): expected an error", spec)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tmwinc/seedup/pkg/events"
+)
+
+// lockPollInterval is how often a busy migration lock is retried
+const lockPollInterval = 500 * time.Millisecond
+
+// lockDatabase is the database the migration lock is held in. Advisory locks
+// are per database, and db setup cannot hold its lock in the database it
+// drops, so every migration lock is held in the maintenance database, which
+// every server has.
+const lockDatabase = "postgres"
+
+type (
+	lockTimeoutKey struct{}
+	heldLocksKey   struct{}
+)
+
+// WithLockTimeout returns a copy of ctx that limits how long operations wait
+// for the migration lock. Zero, the default, waits until the lock is free.
+func WithLockTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, lockTimeoutKey{}, timeout)
+}
+
+func lockTimeout(ctx context.Context) time.Duration {
+	timeout, _ := ctx.Value(lockTimeoutKey{}).(time.Duration)
+	return timeout
+}
+
+// Lock takes the migration lock for the database, so concurrent deploys
+// apply migrations one at a time. The lock is held through a connection to
+// the maintenance database with the same credentials. It returns a context
+// marking the lock as held, so operations run with it don't wait on their own
+// lock, and a function releasing the lock.
+func (m *Migrator) Lock(ctx context.Context, dbURL string) (context.Context, func() error, error) {
+	return m.LockFrom(ctx, dbURL, dbURL)
+}
+
+// LockFrom is like Lock but connects with the credentials of connURL, for
+// operations such as db setup that run as the admin user
+func (m *Migrator) LockFrom(ctx context.Context, connURL, dbURL string) (context.Context, func() error, error) {
+	return m.lock(ctx, lockURL(connURL), lockKey(dbURL), "migration lock")
+}
+
+// lockData takes the lock of a single data migration. It is separate from
+// the migration lock, so a long backfill doesn't hold up schema migrations,
+// while two runners never process the same data migration at once.
+func (m *Migrator) lockData(ctx context.Context, dbURL string, version int64) (context.Context, func() error, error) {
+	return m.lock(ctx, dbURL, dataLockKey(dbURL, version), fmt.Sprintf("lock of data migration %d", version))
+}
+
+// lock takes the advisory lock with the given key through connURL, waiting
+// for it until the lock timeout. name describes the lock in messages.
+func (m *Migrator) lock(ctx context.Context, connURL string, key int64, name string) (context.Context, func() error, error) {
+	id := fmt.Sprintf("%s/%d", databaseName(connURL), key)
+
+	held, _ := ctx.Value(heldLocksKey{}).(map[string]bool)
+	if held[id] {
+		return ctx, func() error { return nil }, nil
+	}
+
+	timeout := lockTimeout(ctx)
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	log := events.FromContext(ctx)
+	waiting := false
+	for {
+		unlock, acquired, err := m.exec.TryAdvisoryLock(ctx, connURL, key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("acquiring %s: %w", name, err)
+		}
+		if acquired {
+			if waiting {
+				log.Info("lock", "Acquired "+name)
+			}
+			locks := map[string]bool{id: true}
+			for other := range held {
+				locks[other] = true
+			}
+			return context.WithValue(ctx, heldLocksKey{}, locks), unlock, nil
+		}
+
+		if !waiting {
+			log.Info("lock", fmt.Sprintf("Waiting for %s held by %s...", name, m.lockHolder(ctx, connURL, key)))
+			waiting = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, fmt.Errorf("waiting for %s: %w", name, context.Cause(ctx))
+		case <-deadline:
+			return nil, nil, fmt.Errorf("timed out after %s waiting for %s held by %s",
+				timeout, name, m.lockHolder(ctx, connURL, key))
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// lockHolder describes the session holding the advisory lock
+func (m *Migrator) lockHolder(ctx context.Context, connURL string, key int64) string {
+	// A bigint advisory lock key is split across classid (high 32 bits) and objid (low 32 bits)
+	query := fmt.Sprintf(`SELECT a.pid, a.usename, a.application_name, host(a.client_addr),
+    to_char(a.backend_start, 'YYYY-MM-DD HH24:MI:SS TZ')
+FROM pg_locks l JOIN pg_stat_activity a ON a.pid = l.pid
+WHERE l.locktype = 'advisory' AND l.granted AND l.objsubid = 1
+    AND l.database = (SELECT oid FROM pg_database WHERE datname = current_database())
+    AND l.classid = %d AND l.objid = %d`, uint32(uint64(key)>>32), uint32(key))
+
+	result, err := m.exec.Query(ctx, connURL, query)
+	if err != nil || len(result.Rows) == 0 {
+		return "another session"
+	}
+
+	row := result.Rows[0]
+	desc := fmt.Sprintf("pid %s (user %s", row[0].String, row[1].String)
+	if row[3].Valid {
+		desc += " from " + row[3].String
+	}
+	if row[2].String != "" {
+		desc += fmt.Sprintf(", application %q", row[2].String)
+	}
+	return desc + ", connected since " + row[4].String + ")"
+}
+
+// lockKey derives the advisory lock key from the database name. The
+// migrations directory is left out: replicas may reach the same migrations
+// through different paths, e.g. ./migrations and /app/migrations.
+func lockKey(dbURL string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("seedup:" + databaseName(dbURL)))
+	return int64(h.Sum64())
+}
+
+// dataLockKey derives the advisory lock key of a data migration
+func dataLockKey(dbURL string, version int64) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(fmt.Sprintf("seedup:data:%s:%d", databaseName(dbURL), version)))
+	return int64(h.Sum64())
+}
+
+// lockURL returns connURL connecting to the lock database instead
+func lockURL(connURL string) string {
+	u, err := url.Parse(connURL)
+	if err != nil {
+		return connURL
+	}
+	u.Path, u.RawPath = "/"+lockDatabase, ""
+	if q := u.Query(); q.Has("dbname") {
+		q.Set("dbname", lockDatabase)
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+// databaseName returns the database name of a connection URL
+func databaseName(dbURL string) string {
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		return dbURL
+	}
+	return strings.TrimPrefix(u.Path, "/")
+}
@@ -2,24 +2,49 @@ package migrate
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/tmwinc/seedup/pkg/events"
 	"github.com/tmwinc/seedup/pkg/executor"
 )
 
+var (
+	// ErrNoNextVersion is returned by UpByOne when there is no pending migration
+	ErrNoNextVersion = errors.New("no next version found")
+
+	// ErrNoCurrentVersion is returned by Down when no migration has been applied
+	ErrNoCurrentVersion = errors.New("no current version found")
+)
+
+// MigrationState describes where a migration stands relative to the database
+type MigrationState string
+
+const (
+	StateApplied           MigrationState = "applied"              // Applied in version order
+	StatePending           MigrationState = "pending"              // On disk but not applied
+	StateMissing           MigrationState = "missing"              // Applied but no longer on disk
+	StateAppliedOutOfOrder MigrationState = "applied-out-of-order" // Applied after a newer version
+)
+
 // MigrationStatus represents the status of a single migration
 type MigrationStatus struct {
-	Version   string
-	Name      string
-	Applied   bool
-	AppliedAt *time.Time
+	Version       string         `json:"version"`
+	Name          string         `json:"name,omitempty"`
+	State         MigrationState `json:"state"`
+	Applied       bool           `json:"applied"`
+	AppliedAt     *time.Time     `json:"applied_at,omitempty"`
+	Modified      bool           `json:"modified,omitempty"`       // File changed since it was applied
+	BehindCurrent bool           `json:"behind_current,omitempty"` // Pending but older than the current version
 }
 
-// Migrator handles database migrations using goose
+// Migrator applies goose-format SQL migrations and records them in the
+// goose_db_version table, so existing goose projects keep working unchanged
 type Migrator struct {
 	exec executor.Executor
 }
@@ -29,64 +54,533 @@ func New(exec executor.Executor) *Migrator {
 	return &Migrator{exec: exec}
 }
 
-// Up runs all pending migrations
+// state is the migrations on disk together with the versions applied to a database
+type state struct {
+	migrations []*Migration
+	applied    map[int64]appliedMigration
+	versions   []int64 // Applied versions in ascending order
+	current    int64   // Highest applied version, 0 if none
+}
+
+// load reads the migrations directory and the applied versions, creating
+// the version table if needed
+func (m *Migrator) load(ctx context.Context, dbURL, migrationsDir string) (*state, error) {
+	migrations, err := collectAll(ctx, migrationsDir)
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations: %w", err)
+	}
+
+	// Check for the version table before creating it: in plan mode the
+	// creation is only printed, so a new database has nothing to query
+	exists, err := m.hasTable(ctx, dbURL, versionTable)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.ensureVersionTable(ctx, dbURL); err != nil {
+		return nil, err
+	}
+	if err := m.ensureChecksumTable(ctx, dbURL); err != nil {
+		return nil, err
+	}
+
+	var applied []appliedMigration
+	if exists {
+		if applied, err = m.appliedVersions(ctx, dbURL); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &state{migrations: migrations, applied: make(map[int64]appliedMigration, len(applied))}
+	for _, a := range applied {
+		s.applied[a.Version] = a
+		s.versions = append(s.versions, a.Version)
+		s.current = max(s.current, a.Version)
+	}
+	return s, nil
+}
+
+// pending returns the unapplied migrations in version order. Those older
+// than the current version are behind it and handled per the policy on
+// ctx: by default they fail the migration.
+func (s *state) pending(ctx context.Context) ([]*Migration, error) {
+	var pending, outOfOrder []*Migration
+	for _, mig := range s.migrations {
+		if _, ok := s.applied[mig.Version]; ok {
+			continue
+		}
+		if mig.Version < s.current {
+			outOfOrder = append(outOfOrder, mig)
+		}
+		pending = append(pending, mig)
+	}
+	if len(outOfOrder) == 0 {
+		return pending, nil
+	}
+
+	files := make([]string, len(outOfOrder))
+	for i, mig := range outOfOrder {
+		files[i] = mig.File()
+	}
+
+	switch policy := outOfOrderPolicy(ctx); policy {
+	case OutOfOrderAllow:
+	case OutOfOrderWarn:
+		events.FromContext(ctx).Info("migrate", fmt.Sprintf("Warning: applying %d migration(s) older than current version %d: %s",
+			len(outOfOrder), s.current, strings.Join(files, ", ")))
+	default:
+		return nil, fmt.Errorf("found %d pending migration(s) behind current version %d: %s (set --out-of-order or SEEDUP_OUT_OF_ORDER to allow to apply them)",
+			len(outOfOrder), s.current, strings.Join(files, ", "))
+	}
+	return pending, nil
+}
+
+// last returns the most recently applied version, which down rolls back as
+// with goose, or 0 if none has been applied. After out-of-order migrations
+// it may be older than the current version.
+func (s *state) last() int64 {
+	var last appliedMigration
+	for _, a := range s.applied {
+		if a.ID > last.ID {
+			last = a
+		}
+	}
+	return last.Version
+}
+
+// rollbacks returns the applied versions newer than version, most recently
+// applied first
+func (s *state) rollbacks(version int64) []appliedMigration {
+	var rollbacks []appliedMigration
+	for _, a := range s.applied {
+		if a.Version > version {
+			rollbacks = append(rollbacks, a)
+		}
+	}
+	sort.Slice(rollbacks, func(i, j int) bool {
+		return rollbacks[i].ID > rollbacks[j].ID
+	})
+	return rollbacks
+}
+
+// find returns the migration with the given version
+func (s *state) find(version int64) (*Migration, error) {
+	for _, mig := range s.migrations {
+		if mig.Version == version {
+			return mig, nil
+		}
+	}
+	return nil, fmt.Errorf("migration file for version %d not found", version)
+}
+
+// Migrations returns the migrations in the directory, together with the Go
+// migrations registered on ctx, sorted by version
+func (m *Migrator) Migrations(ctx context.Context, migrationsDir string) ([]*Migration, error) {
+	return collectAll(ctx, migrationsDir)
+}
+
+// Up runs all pending migrations, then the repeatable migrations that are
+// new or changed since they were last applied
 func (m *Migrator) Up(ctx context.Context, dbURL, migrationsDir string) error {
-	return m.exec.Run(ctx, "goose", "postgres", dbURL, "-dir", migrationsDir, "up", "sql")
+	return m.up(ctx, dbURL, migrationsDir, math.MaxInt64, true)
+}
+
+// UpTo runs pending migrations up to and including the given version.
+// Repeatable migrations are not applied, as they may depend on later versions.
+func (m *Migrator) UpTo(ctx context.Context, dbURL, migrationsDir string, version int64) error {
+	return m.up(ctx, dbURL, migrationsDir, version, false)
+}
+
+func (m *Migrator) up(ctx context.Context, dbURL, migrationsDir string, version int64, repeatables bool) error {
+	ctx, unlock, err := m.Lock(ctx, dbURL)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s, err := m.load(ctx, dbURL, migrationsDir)
+	if err != nil {
+		return err
+	}
+
+	pending, err := s.pending(ctx)
+	if err != nil {
+		return err
+	}
+	for i, mig := range pending {
+		if mig.Version > version {
+			pending = pending[:i]
+			break
+		}
+	}
+
+	log := events.FromContext(ctx)
+	if len(pending) == 0 {
+		log.Info("migrate", fmt.Sprintf("No migrations to run, current version: %d", s.current))
+	} else {
+		for _, mig := range pending {
+			if err := m.apply(ctx, dbURL, mig); err != nil {
+				return err
+			}
+		}
+		log.Info("migrate", fmt.Sprintf("Migrated database to version %d", max(s.current, pending[len(pending)-1].Version)))
+	}
+
+	if repeatables {
+		return m.applyRepeatables(ctx, dbURL, migrationsDir)
+	}
+	return nil
 }
 
 // UpByOne runs a single pending migration
 func (m *Migrator) UpByOne(ctx context.Context, dbURL, migrationsDir string) error {
-	return m.exec.Run(ctx, "goose", "postgres", dbURL, "-dir", migrationsDir, "up-by-one", "sql")
+	ctx, unlock, err := m.Lock(ctx, dbURL)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s, err := m.load(ctx, dbURL, migrationsDir)
+	if err != nil {
+		return err
+	}
+
+	pending, err := s.pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return ErrNoNextVersion
+	}
+
+	return m.apply(ctx, dbURL, pending[0])
 }
 
 // UpByOneAllowNoop runs a single pending migration, but doesn't fail if no migrations are pending
 func (m *Migrator) UpByOneAllowNoop(ctx context.Context, dbURL, migrationsDir string) error {
-	err := m.exec.Run(ctx, "goose", "postgres", dbURL, "-dir", migrationsDir, "up-by-one", "sql")
+	err := m.UpByOne(ctx, dbURL, migrationsDir)
+	if errors.Is(err, ErrNoNextVersion) {
+		return nil
+	}
+	return err
+}
+
+// Down rolls back the most recently applied migration
+func (m *Migrator) Down(ctx context.Context, dbURL, migrationsDir string) error {
+	ctx, unlock, err := m.Lock(ctx, dbURL)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s, err := m.load(ctx, dbURL, migrationsDir)
+	if err != nil {
+		return err
+	}
+	last := s.last()
+	if last == 0 {
+		return ErrNoCurrentVersion
+	}
+
+	mig, err := s.find(last)
+	if err != nil {
+		return err
+	}
+	return m.rollback(ctx, dbURL, mig)
+}
+
+// DownTo rolls back applied migrations newer than the given version, most
+// recently applied first
+func (m *Migrator) DownTo(ctx context.Context, dbURL, migrationsDir string, version int64) error {
+	ctx, unlock, err := m.Lock(ctx, dbURL)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s, err := m.load(ctx, dbURL, migrationsDir)
 	if err != nil {
-		// Check if the error is just "no next version found" which means migrations are already applied
-		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
-			// This is expected when no migrations are pending - not an error for our purposes
-			return nil
-		}
 		return err
 	}
+
+	// Resolve every file before rolling anything back
+	var rollbacks []*Migration
+	for _, a := range s.rollbacks(version) {
+		mig, err := s.find(a.Version)
+		if err != nil {
+			return err
+		}
+		rollbacks = append(rollbacks, mig)
+	}
+	remaining := int64(0)
+	for _, v := range s.versions {
+		if v <= version {
+			remaining = v
+		}
+	}
+
+	log := events.FromContext(ctx)
+	if len(rollbacks) == 0 {
+		log.Info("migrate", fmt.Sprintf("No migrations to roll back, current version: %d", s.current))
+		return nil
+	}
+
+	for _, mig := range rollbacks {
+		if err := m.rollback(ctx, dbURL, mig); err != nil {
+			return err
+		}
+	}
+
+	log.Info("migrate", fmt.Sprintf("Rolled back database to version %d", remaining))
 	return nil
 }
 
-// Down rolls back the last migration
-func (m *Migrator) Down(ctx context.Context, dbURL, migrationsDir string) error {
-	return m.exec.Run(ctx, "goose", "postgres", dbURL, "-dir", migrationsDir, "down", "sql")
+// Redo rolls back the most recently applied migration and applies it again
+func (m *Migrator) Redo(ctx context.Context, dbURL, migrationsDir string) error {
+	ctx, unlock, err := m.Lock(ctx, dbURL)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s, err := m.load(ctx, dbURL, migrationsDir)
+	if err != nil {
+		return err
+	}
+	last := s.last()
+	if last == 0 {
+		return ErrNoCurrentVersion
+	}
+
+	mig, err := s.find(last)
+	if err != nil {
+		return err
+	}
+	if err := m.rollback(ctx, dbURL, mig); err != nil {
+		return err
+	}
+	return m.apply(ctx, dbURL, mig)
+}
+
+// Reset rolls back all applied migrations
+func (m *Migrator) Reset(ctx context.Context, dbURL, migrationsDir string) error {
+	return m.DownTo(ctx, dbURL, migrationsDir, 0)
 }
 
-// Status shows the status of all migrations
-func (m *Migrator) Status(ctx context.Context, dbURL, migrationsDir string) error {
-	return m.exec.Run(ctx, "goose", "postgres", dbURL, "-dir", migrationsDir, "status", "sql")
+// Version returns the highest applied version, or 0 if none has been applied
+func (m *Migrator) Version(ctx context.Context, dbURL string) (int64, error) {
+	exists, err := m.hasTable(ctx, dbURL, versionTable)
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	applied, err := m.appliedVersions(ctx, dbURL)
+	if err != nil {
+		return 0, err
+	}
+	if len(applied) == 0 {
+		return 0, nil
+	}
+	return applied[len(applied)-1].Version, nil
+}
+
+// Status returns the status of every migration on disk or recorded in the
+// database, sorted by version. It does not modify the database.
+func (m *Migrator) Status(ctx context.Context, dbURL, migrationsDir string) ([]MigrationStatus, error) {
+	migrations, err := collectAll(ctx, migrationsDir)
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations: %w", err)
+	}
+
+	exists, err := m.hasTable(ctx, dbURL, versionTable)
+	if err != nil {
+		return nil, err
+	}
+	var applied []appliedMigration
+	if exists {
+		if applied, err = m.appliedVersions(ctx, dbURL); err != nil {
+			return nil, err
+		}
+	}
+
+	checksums, err := m.recordedChecksums(ctx, dbURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// A version was applied out of order if a newer version was recorded before it;
+	// walk newest first tracking the earliest row id seen so far
+	outOfOrder := make(map[int64]bool)
+	var minID int64
+	for i := len(applied) - 1; i >= 0; i-- {
+		a := applied[i]
+		if i < len(applied)-1 && a.ID > minID {
+			outOfOrder[a.Version] = true
+		}
+		if i == len(applied)-1 || a.ID < minID {
+			minID = a.ID
+		}
+	}
+
+	byVersion := make(map[int64]appliedMigration, len(applied))
+	var current int64
+	for _, a := range applied {
+		byVersion[a.Version] = a
+		current = max(current, a.Version)
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations)+len(applied))
+	onDisk := make(map[int64]bool, len(migrations))
+	for _, mig := range migrations {
+		onDisk[mig.Version] = true
+		st := MigrationStatus{Version: fmt.Sprint(mig.Version), Name: mig.Name, State: StatePending}
+		if a, ok := byVersion[mig.Version]; ok {
+			st.Applied, st.AppliedAt, st.State = true, a.AppliedAt, StateApplied
+			if outOfOrder[mig.Version] {
+				st.State = StateAppliedOutOfOrder
+			}
+			if recorded, ok := checksums[mig.Version]; ok && mig.Go == nil {
+				sum, err := fileChecksum(mig.Path)
+				if err != nil {
+					return nil, fmt.Errorf("reading %s: %w", mig.File(), err)
+				}
+				st.Modified = sum != recorded
+			}
+		} else {
+			st.BehindCurrent = mig.Version < current
+		}
+		statuses = append(statuses, st)
+	}
+	for _, a := range applied {
+		if !onDisk[a.Version] {
+			statuses = append(statuses, MigrationStatus{
+				Version:   fmt.Sprint(a.Version),
+				State:     StateMissing,
+				Applied:   true,
+				AppliedAt: a.AppliedAt,
+			})
+		}
+	}
+
+	sort.SliceStable(statuses, func(i, j int) bool {
+		vi, _ := strconv.ParseInt(statuses[i].Version, 10, 64)
+		vj, _ := strconv.ParseInt(statuses[j].Version, 10, 64)
+		return vi < vj
+	})
+	return statuses, nil
 }
 
-// Create creates a new migration file with the given name
-func (m *Migrator) Create(migrationsDir, name string) (string, error) {
-	timestamp := time.Now().UTC().Format("20060102150405")
-	filename := fmt.Sprintf("%s_%s.sql", timestamp, name)
-	filepath := filepath.Join(migrationsDir, filename)
+// Verify returns the applied migrations whose files were modified since they
+// were applied or are no longer on disk. Migrations applied before checksums
+// were recorded can only be reported when missing.
+func (m *Migrator) Verify(ctx context.Context, dbURL, migrationsDir string) ([]MigrationStatus, error) {
+	statuses, err := m.Status(ctx, dbURL, migrationsDir)
+	if err != nil {
+		return nil, err
+	}
 
-	content := `-- +goose Up
--- +goose StatementBegin
+	var problems []MigrationStatus
+	for _, st := range statuses {
+		if st.Modified || st.State == StateMissing {
+			problems = append(problems, st)
+		}
+	}
+	return problems, nil
+}
 
--- +goose StatementEnd
+// apply runs a migration's Up section and records its version
+func (m *Migrator) apply(ctx context.Context, dbURL string, mig *Migration) error {
+	step := events.FromContext(ctx).Start("apply-migration", fmt.Sprintf("Applying %s...", mig.File())).Database(dbURL)
+	if mig.Go != nil {
+		record := fmt.Sprintf("INSERT INTO %s (version_id, is_applied) VALUES (%d, true)", versionTable, mig.Version)
+		if err := m.runGo(ctx, dbURL, mig, mig.Go.Up, record); err != nil {
+			return step.End(fmt.Errorf("applying %s: %w", mig.File(), err))
+		}
+		return step.End(nil)
+	}
+	step.AddFiles(mig.Path)
 
--- +goose Down
--- +goose StatementBegin
+	parsed, err := parseMigrationFile(mig.Path)
+	if err != nil {
+		return step.End(err)
+	}
 
--- +goose StatementEnd
-`
+	record := fmt.Sprintf(`INSERT INTO %s (version_id, is_applied) VALUES (%d, true);
+INSERT INTO %s (version_id, checksum) VALUES (%[2]d, '%[4]s')
+    ON CONFLICT (version_id) DO UPDATE SET checksum = EXCLUDED.checksum, recorded_at = now();`,
+		versionTable, mig.Version, checksumTable, parsed.Checksum)
+	if err := m.runScript(ctx, dbURL, migrationScript(parsed.Up, record, sessionDefaults(ctx).merge(parsed.Settings), parsed.NoTransaction)); err != nil {
+		return step.End(fmt.Errorf("applying %s: %w", mig.File(), err))
+	}
+	return step.End(nil)
+}
 
-	if err := os.MkdirAll(migrationsDir, 0755); err != nil {
-		return "", fmt.Errorf("creating migrations directory: %w", err)
+// rollback runs a migration's Down section and removes its version
+func (m *Migrator) rollback(ctx context.Context, dbURL string, mig *Migration) error {
+	step := events.FromContext(ctx).Start("rollback-migration", fmt.Sprintf("Rolling back %s...", mig.File())).Database(dbURL)
+	if mig.Go != nil {
+		if mig.Go.Down == nil {
+			return step.End(fmt.Errorf("%s has no Down function", mig.File()))
+		}
+		record := fmt.Sprintf("DELETE FROM %s WHERE version_id = %d", versionTable, mig.Version)
+		if err := m.runGo(ctx, dbURL, mig, mig.Go.Down, record); err != nil {
+			return step.End(fmt.Errorf("rolling back %s: %w", mig.File(), err))
+		}
+		return step.End(nil)
 	}
+	step.AddFiles(mig.Path)
 
-	if err := os.WriteFile(filepath, []byte(content), 0644); err != nil {
-		return "", fmt.Errorf("writing migration file: %w", err)
+	parsed, err := parseMigrationFile(mig.Path)
+	if err != nil {
+		return step.End(err)
 	}
 
-	return filepath, nil
+	record := fmt.Sprintf("DELETE FROM %s WHERE version_id = %d;\nDELETE FROM %s WHERE version_id = %[2]d;",
+		versionTable, mig.Version, checksumTable)
+	if err := m.runScript(ctx, dbURL, migrationScript(parsed.Down, record, sessionDefaults(ctx).merge(parsed.Settings), parsed.NoTransaction)); err != nil {
+		return step.End(fmt.Errorf("rolling back %s: %w", mig.File(), err))
+	}
+	return step.End(nil)
+}
+
+// runGo runs a Go migration function followed by the statement recording
+// it, in one transaction unless the migration opts out
+func (m *Migrator) runGo(ctx context.Context, dbURL string, mig *Migration, fn executor.Func, record string) error {
+	return m.exec.RunFunc(ctx, dbURL, mig.File(), !mig.Go.NoTransaction, func(ctx context.Context, db executor.DB) error {
+		if settings := sessionDefaults(ctx).sql(); settings != "" {
+			if _, err := db.Exec(ctx, settings); err != nil {
+				return err
+			}
+		}
+		if err := fn(ctx, db); err != nil {
+			return err
+		}
+		_, err := db.Exec(ctx, record)
+		return err
+	})
+}
+
+// migrationScript combines a migration section with the statement recording
+// it, wrapped in a transaction unless the migration opts out. The session
+// settings are applied first, so they also cover the recording statement.
+func migrationScript(body, record string, settings SessionSettings, noTransaction bool) string {
+	var script strings.Builder
+	script.WriteString(settings.sql())
+	if !noTransaction {
+		script.WriteString("BEGIN;\n")
+	}
+	body = strings.TrimRight(body, " \t\r\n")
+	if body != "" {
+		script.WriteString(body)
+		script.WriteString("\n")
+		// Terminate a final statement that lacks a semicolon
+		if !strings.HasSuffix(body, ";") {
+			script.WriteString(";\n")
+		}
+	}
+	script.WriteString(record)
+	script.WriteString("\n")
+	if !noTransaction {
+		script.WriteString("COMMIT;\n")
+	}
+	return script.String()
 }
@@ -0,0 +1,310 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/tmwinc/seedup/pkg/events"
+	"github.com/tmwinc/seedup/pkg/executor"
+)
+
+// fakeExecutor answers queries with canned rows, picked by the first key of
+// results the query contains, and records the statements and scripts it runs.
+// Calls it does not implement panic on the nil embedded Executor.
+type fakeExecutor struct {
+	executor.Executor
+	results []fakeResult
+	sql     []string
+	locks   []string // Connection URLs advisory locks were taken through
+	funcs   []string // Names of the functions run, with "(tx)" if in a transaction
+	dump    string   // Output of pg_dump
+}
+
+type fakeResult struct {
+	match string
+	rows  [][]string
+}
+
+// answer adds canned rows for queries containing match
+func (f *fakeExecutor) answer(match string, rows ...[]string) {
+	f.results = append(f.results, fakeResult{match, rows})
+}
+
+// tables answers table existence checks: the given tables exist, others don't
+func (f *fakeExecutor) tables(names ...string) {
+	for _, name := range names {
+		f.answer(fmt.Sprintf("to_regclass('%s')", name), []string{"t"})
+	}
+	f.answer("to_regclass(", []string{"f"})
+}
+
+// applied answers the applied versions query with rows of id and version
+func (f *fakeExecutor) applied(rows ...[2]int64) {
+	result := make([][]string, len(rows))
+	for i, r := range rows {
+		result[i] = []string{fmt.Sprint(r[0]), fmt.Sprint(r[1]), "2026-01-02T03:04:05"}
+	}
+	f.answer("DISTINCT ON (version_id)", result...)
+}
+
+func (f *fakeExecutor) Query(ctx context.Context, dbURL, query string) (*executor.Result, error) {
+	for _, r := range f.results {
+		if !strings.Contains(query, r.match) {
+			continue
+		}
+		result := &executor.Result{}
+		for _, row := range r.rows {
+			values := make([]sql.NullString, len(row))
+			for i, v := range row {
+				values[i] = sql.NullString{String: v, Valid: true}
+			}
+			result.Rows = append(result.Rows, values)
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("unexpected query: %s", query)
+}
+
+func (f *fakeExecutor) RunSQL(ctx context.Context, dbURL, query string) (string, error) {
+	f.sql = append(f.sql, query)
+	return "", nil
+}
+
+func (f *fakeExecutor) RunSQLFile(ctx context.Context, dbURL, filePath string) error {
+	script, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	f.sql = append(f.sql, string(script))
+	return nil
+}
+
+func (f *fakeExecutor) RunWithOutput(ctx context.Context, name string, args ...string) (string, error) {
+	if name != "pg_dump" {
+		return "", fmt.Errorf("unexpected command: %s", name)
+	}
+	return f.dump, nil
+}
+
+func (f *fakeExecutor) WriteFile(path string, data []byte) error {
+	return os.WriteFile(path, data, 0o644)
+}
+
+func (f *fakeExecutor) TryAdvisoryLock(ctx context.Context, dbURL string, key int64) (func() error, bool, error) {
+	f.locks = append(f.locks, dbURL)
+	return func() error { return nil }, true, nil
+}
+
+func (f *fakeExecutor) RunFunc(ctx context.Context, dbURL, name string, transaction bool, fn executor.Func) error {
+	if transaction {
+		name += " (tx)"
+	}
+	f.funcs = append(f.funcs, name)
+	return fn(ctx, fakeDB{f: f})
+}
+
+// fakeDB records the statements Go migrations execute with its fakeExecutor
+type fakeDB struct {
+	executor.DB
+	f *fakeExecutor
+}
+
+func (db fakeDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	db.f.sql = append(db.f.sql, sql)
+	return pgconn.CommandTag{}, nil
+}
+
+// executed returns the recorded statements and scripts containing s
+func (f *fakeExecutor) executed(s string) []string {
+	var matches []string
+	for _, q := range f.sql {
+		if strings.Contains(q, s) {
+			matches = append(matches, q)
+		}
+	}
+	return matches
+}
+
+// writeMigrations creates migration files with a Down section in a temporary directory
+func writeMigrations(t *testing.T, files ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, file := range files {
+		content := fmt.Sprintf("-- +goose Up\nSELECT 'up %[1]s';\n\n-- +goose Down\nSELECT 'down %[1]s';\n", file)
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func testContext() context.Context {
+	return events.WithLogger(context.Background(), events.New(io.Discard, events.FormatText))
+}
+
+const testDatabaseURL = "postgres://app@localhost:5432/app"
+
+func TestStatus(t *testing.T) {
+	dir := writeMigrations(t, "00001_a.sql", "00002_b.sql", "00003_c.sql", "00005_e.sql", "00006_f.sql")
+
+	// 4 was applied but its file is gone; 3 was applied after 5; 2 and 6 are pending
+	exec := &fakeExecutor{}
+	exec.tables(versionTable)
+	exec.applied([2]int64{2, 1}, [2]int64{5, 3}, [2]int64{3, 4}, [2]int64{4, 5})
+
+	statuses, err := New(exec).Status(testContext(), testDatabaseURL, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appliedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	want := []MigrationStatus{
+		{Version: "1", Name: "a", State: StateApplied, Applied: true, AppliedAt: &appliedAt},
+		{Version: "2", Name: "b", State: StatePending, BehindCurrent: true},
+		{Version: "3", Name: "c", State: StateAppliedOutOfOrder, Applied: true, AppliedAt: &appliedAt},
+		{Version: "4", State: StateMissing, Applied: true, AppliedAt: &appliedAt},
+		{Version: "5", Name: "e", State: StateApplied, Applied: true, AppliedAt: &appliedAt},
+		{Version: "6", Name: "f", State: StatePending},
+	}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("Status:\n got: %+v\nwant: %+v", statuses, want)
+	}
+	if len(exec.sql) != 0 {
+		t.Errorf("Status modified the database: %q", exec.sql)
+	}
+}
+
+func TestStatusWithoutVersionTable(t *testing.T) {
+	dir := writeMigrations(t, "00001_a.sql")
+
+	exec := &fakeExecutor{}
+	exec.tables()
+
+	statuses, err := New(exec).Status(testContext(), testDatabaseURL, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []MigrationStatus{{Version: "1", Name: "a", State: StatePending}}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("Status:\n got: %+v\nwant: %+v", statuses, want)
+	}
+}
+
+// outOfOrderExecutor has 00001, 00003 and then 00002 applied, in that order
+func outOfOrderExecutor() *fakeExecutor {
+	exec := &fakeExecutor{}
+	exec.tables(versionTable, checksumTable)
+	exec.applied([2]int64{2, 1}, [2]int64{4, 2}, [2]int64{3, 3})
+	return exec
+}
+
+func TestDownRollsBackMostRecentlyApplied(t *testing.T) {
+	dir := writeMigrations(t, "00001_a.sql", "00002_b.sql", "00003_c.sql")
+	exec := outOfOrderExecutor()
+
+	if err := New(exec).Down(testContext(), testDatabaseURL, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := exec.executed("SELECT 'down"); len(got) != 1 || !strings.Contains(got[0], "down 00002_b.sql") {
+		t.Errorf("rolled back %q, want only 00002_b.sql", got)
+	}
+}
+
+func TestRedoReappliesMostRecentlyApplied(t *testing.T) {
+	dir := writeMigrations(t, "00001_a.sql", "00002_b.sql", "00003_c.sql")
+	exec := outOfOrderExecutor()
+
+	if err := New(exec).Redo(testContext(), testDatabaseURL, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	got := exec.executed("SELECT '")
+	if len(got) != 2 || !strings.Contains(got[0], "down 00002_b.sql") || !strings.Contains(got[1], "up 00002_b.sql") {
+		t.Errorf("ran %q, want 00002_b.sql rolled back and applied", got)
+	}
+}
+
+func TestDownToRollsBackInApplicationOrder(t *testing.T) {
+	dir := writeMigrations(t, "00001_a.sql", "00002_b.sql", "00003_c.sql")
+	exec := outOfOrderExecutor()
+
+	if err := New(exec).DownTo(testContext(), testDatabaseURL, dir, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	got := exec.executed("SELECT 'down")
+	if len(got) != 2 || !strings.Contains(got[0], "down 00002_b.sql") || !strings.Contains(got[1], "down 00003_c.sql") {
+		t.Errorf("rolled back %q, want 00002_b.sql then 00003_c.sql", got)
+	}
+}
+
+func TestDownWithoutAppliedMigrations(t *testing.T) {
+	dir := writeMigrations(t, "00001_a.sql")
+	exec := &fakeExecutor{}
+	exec.tables(versionTable, checksumTable)
+	exec.applied()
+
+	if err := New(exec).Down(testContext(), testDatabaseURL, dir); err != ErrNoCurrentVersion {
+		t.Errorf("Down = %v, want %v", err, ErrNoCurrentVersion)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir := writeMigrations(t, "00001_a.sql", "00002_b.sql", "00003_c.sql")
+	unchanged, err := fileChecksum(filepath.Join(dir, "00001_a.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 1 is unchanged, 2 was edited after it was applied, 3 predates checksums
+	// and 4 is no longer on disk
+	exec := &fakeExecutor{}
+	exec.tables(versionTable, checksumTable)
+	exec.applied([2]int64{2, 1}, [2]int64{3, 2}, [2]int64{4, 3}, [2]int64{5, 4})
+	exec.answer("FROM "+checksumTable, []string{"1", unchanged}, []string{"2", checksum([]byte("-- +goose Up\nSELECT 1;\n"))})
+
+	problems, err := New(exec).Verify(testContext(), testDatabaseURL, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, st := range problems {
+		got = append(got, fmt.Sprintf("%s %s modified=%v", st.Version, st.State, st.Modified))
+	}
+	want := []string{"2 applied modified=true", "4 missing modified=false"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Verify = %q, want %q", got, want)
+	}
+}
+
+func TestApplyRecordsChecksum(t *testing.T) {
+	dir := writeMigrations(t, "00001_a.sql")
+	sum, err := fileChecksum(filepath.Join(dir, "00001_a.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exec := &fakeExecutor{}
+	exec.tables(versionTable, checksumTable, repeatableTable)
+	exec.applied()
+	exec.answer("FROM " + repeatableTable)
+
+	if err := New(exec).Up(testContext(), testDatabaseURL, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := exec.executed("INSERT INTO " + checksumTable); len(got) != 1 || !strings.Contains(got[0], sum) {
+		t.Errorf("scripts recording a checksum: %q, want one recording %s", got, sum)
+	}
+}
@@ -0,0 +1,40 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+)
+
+// OutOfOrderPolicy decides what up does with pending migrations older than
+// the current version, as left behind when a long-lived branch is merged
+type OutOfOrderPolicy string
+
+const (
+	OutOfOrderError = OutOfOrderPolicy("error")              // Refuse to migrate
+	OutOfOrderAllow = OutOfOrderPolicy("allow")              // Apply them in version order with the others
+	OutOfOrderWarn  = OutOfOrderPolicy("allow-with-warning") // Apply them, reporting each one
+)
+
+// Validate checks that the policy is one of the known policies
+func (p OutOfOrderPolicy) Validate() error {
+	switch p {
+	case OutOfOrderError, OutOfOrderAllow, OutOfOrderWarn:
+		return nil
+	}
+	return fmt.Errorf("invalid out-of-order policy %q: expected error, allow or allow-with-warning", string(p))
+}
+
+type outOfOrderPolicyKey struct{}
+
+// WithOutOfOrderPolicy returns a copy of ctx whose migrations follow the
+// given out-of-order policy. Without one, OutOfOrderError applies.
+func WithOutOfOrderPolicy(ctx context.Context, policy OutOfOrderPolicy) context.Context {
+	return context.WithValue(ctx, outOfOrderPolicyKey{}, policy)
+}
+
+func outOfOrderPolicy(ctx context.Context) OutOfOrderPolicy {
+	if policy, ok := ctx.Value(outOfOrderPolicyKey{}).(OutOfOrderPolicy); ok && policy != "" {
+		return policy
+	}
+	return OutOfOrderError
+}
@@ -0,0 +1,105 @@
+package migrate
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tmwinc/seedup/pkg/events"
+)
+
+func TestPendingOutOfOrder(t *testing.T) {
+	tests := []struct {
+		policy  OutOfOrderPolicy
+		wantErr string
+		warning string
+	}{
+		{"", "found 1 pending migration(s) behind current version 3: 00002_b.sql (set --out-of-order or SEEDUP_OUT_OF_ORDER to allow to apply them)", ""},
+		{OutOfOrderError, "found 1 pending migration(s) behind current version 3", ""},
+		{OutOfOrderAllow, "", ""},
+		{OutOfOrderWarn, "", "Warning: applying 1 migration(s) older than current version 3: 00002_b.sql\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			dir := writeMigrations(t, "00001_a.sql", "00002_b.sql", "00003_c.sql", "00004_d.sql")
+			migrations, err := collectMigrations(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := &state{migrations: migrations, applied: map[int64]appliedMigration{1: {Version: 1}, 3: {Version: 3}}, current: 3}
+
+			var out strings.Builder
+			ctx := events.WithLogger(context.Background(), events.New(&out, events.FormatText))
+			if tt.policy != "" {
+				ctx = WithOutOfOrderPolicy(ctx, tt.policy)
+			}
+
+			pending, err := s.pending(ctx)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Errorf("pending = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var files []string
+			for _, mig := range pending {
+				files = append(files, mig.File())
+			}
+			if got := strings.Join(files, " "); got != "00002_b.sql 00004_d.sql" {
+				t.Errorf("pending = %s, want 00002_b.sql 00004_d.sql in version order", got)
+			}
+			if out.String() != tt.warning {
+				t.Errorf("output = %q, want %q", out.String(), tt.warning)
+			}
+		})
+	}
+}
+
+func TestPendingInOrder(t *testing.T) {
+	dir := writeMigrations(t, "00001_a.sql", "00002_b.sql")
+	migrations, err := collectMigrations(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &state{migrations: migrations, applied: map[int64]appliedMigration{1: {Version: 1}}, current: 1}
+
+	// Only migrations behind the current version are subject to the policy
+	pending, err := s.pending(WithOutOfOrderPolicy(testContext(), OutOfOrderError))
+	if err != nil || len(pending) != 1 || pending[0].Version != 2 {
+		t.Errorf("pending = %v, %v, want 00002_b.sql", pending, err)
+	}
+}
+
+func TestUpAppliesOutOfOrderInVersionOrder(t *testing.T) {
+	dir := writeMigrations(t, "00001_a.sql", "00002_b.sql", "00003_c.sql", "00004_d.sql")
+	exec := &fakeExecutor{}
+	exec.tables(versionTable, checksumTable, repeatableTable)
+	exec.applied([2]int64{2, 1}, [2]int64{3, 3})
+	exec.answer("FROM " + repeatableTable)
+
+	ctx := WithOutOfOrderPolicy(testContext(), OutOfOrderAllow)
+	if err := New(exec).Up(ctx, testDatabaseURL, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	got := exec.executed("SELECT 'up")
+	if len(got) != 2 || !strings.Contains(got[0], "up 00002_b.sql") || !strings.Contains(got[1], "up 00004_d.sql") {
+		t.Errorf("applied %q, want 00002_b.sql then 00004_d.sql", got)
+	}
+}
+
+func TestOutOfOrderPolicyValidate(t *testing.T) {
+	for _, policy := range []OutOfOrderPolicy{OutOfOrderError, OutOfOrderAllow, OutOfOrderWarn} {
+		if err := policy.Validate(); err != nil {
+			t.Errorf("Validate(%s) = %v", policy, err)
+		}
+	}
+	if err := OutOfOrderPolicy("ignore").Validate(); err == nil {
+		t.Error("Validate(ignore) = nil, want an error")
+	}
+}
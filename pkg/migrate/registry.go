@@ -0,0 +1,137 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tmwinc/seedup/pkg/executor"
+)
+
+// GoMigration is a migration written in Go, for changes such as data
+// backfills that need more than SQL. Up and Down run with the same session
+// settings and, unless NoTransaction is set, in the same transaction as the
+// update of the version table.
+type GoMigration struct {
+	Version       int64
+	Name          string
+	Up            executor.Func
+	Down          executor.Func // nil if the migration cannot be rolled back
+	NoTransaction bool
+}
+
+// Registry holds the Go migrations compiled into a binary. Versions share
+// one sequence with the SQL migrations and are applied in the same order.
+type Registry struct {
+	migrations map[int64]*GoMigration
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{migrations: make(map[int64]*GoMigration)}
+}
+
+// Add registers a Go migration run in a transaction. It panics if the
+// version is already registered, as registration happens in init functions.
+func (r *Registry) Add(version int64, name string, up, down executor.Func) {
+	r.Register(&GoMigration{Version: version, Name: name, Up: up, Down: down})
+}
+
+// AddNoTx registers a Go migration run outside of a transaction
+func (r *Registry) AddNoTx(version int64, name string, up, down executor.Func) {
+	r.Register(&GoMigration{Version: version, Name: name, Up: up, Down: down, NoTransaction: true})
+}
+
+// Register registers a Go migration, panicking on an invalid or duplicate version
+func (r *Registry) Register(mig *GoMigration) {
+	if mig.Version < 1 {
+		panic(fmt.Sprintf("migrate: invalid Go migration version %d", mig.Version))
+	}
+	if mig.Up == nil {
+		panic(fmt.Sprintf("migrate: Go migration %d has no Up function", mig.Version))
+	}
+	if _, dup := r.migrations[mig.Version]; dup {
+		panic(fmt.Sprintf("migrate: duplicate Go migration version %d", mig.Version))
+	}
+	r.migrations[mig.Version] = mig
+}
+
+// Migrations returns the registered migrations sorted by version
+func (r *Registry) Migrations() []*GoMigration {
+	migrations := make([]*GoMigration, 0, len(r.migrations))
+	for _, mig := range r.migrations {
+		migrations = append(migrations, mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations
+}
+
+type registryKey struct{}
+
+// WithRegistry returns a copy of ctx whose migrations include the Go
+// migrations of the registry
+func WithRegistry(ctx context.Context, registry *Registry) context.Context {
+	return context.WithValue(ctx, registryKey{}, registry)
+}
+
+func registryFrom(ctx context.Context) *Registry {
+	registry, _ := ctx.Value(registryKey{}).(*Registry)
+	if registry == nil {
+		return NewRegistry()
+	}
+	return registry
+}
+
+// collectAll returns the SQL migrations in dir together with the registered
+// Go migrations, sorted by version. A Go migration file in dir that is not
+// registered is an error: it can only be run by the binary it is compiled into.
+func collectAll(ctx context.Context, dir string) ([]*Migration, error) {
+	migrations, err := collectMigrations(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int64]string, len(migrations))
+	for _, mig := range migrations {
+		seen[mig.Version] = mig.File()
+	}
+
+	registry := registryFrom(ctx)
+	for _, gm := range registry.Migrations() {
+		mig := &Migration{
+			Version: gm.Version,
+			Name:    gm.Name,
+			Path:    filepath.Join(dir, fmt.Sprintf("%d_%s.go", gm.Version, gm.Name)),
+			Go:      gm,
+		}
+		if other, dup := seen[gm.Version]; dup {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", gm.Version, other, mig.File())
+		}
+		seen[gm.Version] = mig.File()
+		migrations = append(migrations, mig)
+	}
+
+	goFiles, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range goFiles {
+		version, _, ok := parseFilename(filepath.Base(path))
+		if !ok || strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		if _, registered := registry.migrations[version]; !registered {
+			return nil, fmt.Errorf("Go migration %s is not registered: run it with the binary built from your migrations package (see seedup.Main)",
+				filepath.Base(path))
+		}
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
@@ -0,0 +1,137 @@
+package migrate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tmwinc/seedup/pkg/executor"
+)
+
+func noop(ctx context.Context, db executor.DB) error { return nil }
+
+func TestRegisterPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		mig  *GoMigration
+		want string
+	}{
+		{"invalid version", &GoMigration{Version: 0, Name: "zero", Up: noop}, "migrate: invalid Go migration version 0"},
+		{"no Up", &GoMigration{Version: 2, Name: "empty"}, "migrate: Go migration 2 has no Up function"},
+		{"duplicate", &GoMigration{Version: 1, Name: "again", Up: noop}, "migrate: duplicate Go migration version 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewRegistry()
+			registry.Add(1, "backfill", noop, nil)
+			defer func() {
+				if got := recover(); got != tt.want {
+					t.Errorf("Register panicked with %v, want %q", got, tt.want)
+				}
+			}()
+			registry.Register(tt.mig)
+		})
+	}
+}
+
+// goMigrationsDir creates a migrations directory with SQL migrations 1 and 3
+// and the source of Go migration 2
+func goMigrationsDir(t *testing.T) string {
+	t.Helper()
+	dir := writeMigrations(t, "00001_a.sql", "00003_c.sql")
+	for _, file := range []string{"00002_backfill.go", "00002_backfill_test.go", "registry.go"} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte("package migrations\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestCollectAll(t *testing.T) {
+	dir := goMigrationsDir(t)
+	registry := NewRegistry()
+	registry.AddNoTx(4, "cleanup", noop, nil)
+	registry.Add(2, "backfill", noop, noop)
+
+	migrations, err := collectAll(WithRegistry(context.Background(), registry), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, mig := range migrations {
+		got = append(got, mig.File())
+	}
+	want := []string{"00001_a.sql", "2_backfill.go", "00003_c.sql", "4_cleanup.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("migrations = %q, want %q", got, want)
+	}
+	if migrations[1].Go == nil || migrations[1].Version != 2 || migrations[0].Go != nil {
+		t.Errorf("Go migration not marked: %+v", migrations)
+	}
+}
+
+func TestCollectAllErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		register func(*Registry)
+		want     string
+	}{
+		{"unregistered", func(r *Registry) {}, "Go migration 00002_backfill.go is not registered"},
+		{"duplicate version", func(r *Registry) {
+			r.Add(2, "backfill", noop, nil)
+			r.Add(3, "recount", noop, nil)
+		}, "duplicate migration version 3: 00003_c.sql and 3_recount.go"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewRegistry()
+			tt.register(registry)
+			_, err := collectAll(WithRegistry(context.Background(), registry), goMigrationsDir(t))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("collectAll = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpRunsGoMigrations(t *testing.T) {
+	dir := writeMigrations(t, "00001_a.sql")
+	registry := NewRegistry()
+	registry.Add(2, "backfill", func(ctx context.Context, db executor.DB) error {
+		_, err := db.Exec(ctx, "UPDATE users SET name = ''")
+		return err
+	}, nil)
+	registry.AddNoTx(3, "reindex", noop, nil)
+
+	exec := &fakeExecutor{}
+	exec.tables(versionTable, checksumTable, repeatableTable)
+	exec.applied()
+	exec.answer("FROM " + repeatableTable)
+
+	ctx := WithSessionDefaults(WithRegistry(testContext(), registry), SessionSettings{LockTimeout: "5s"})
+	if err := New(exec).Up(ctx, testDatabaseURL, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"2_backfill.go (tx)", "3_reindex.go"}; !reflect.DeepEqual(exec.funcs, want) {
+		t.Errorf("ran functions %q, want %q", exec.funcs, want)
+	}
+	// Each runs with the session settings and records its version
+	got := exec.sql[len(exec.sql)-5:]
+	want := []string{
+		"SET lock_timeout = '5s';\n",
+		"UPDATE users SET name = ''",
+		"INSERT INTO goose_db_version (version_id, is_applied) VALUES (2, true)",
+		"SET lock_timeout = '5s';\n",
+		"INSERT INTO goose_db_version (version_id, is_applied) VALUES (3, true)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("executed %q, want %q", got, want)
+	}
+}
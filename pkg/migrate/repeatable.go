@@ -0,0 +1,96 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tmwinc/seedup/pkg/events"
+)
+
+// repeatableDir is the subdirectory of the migrations directory holding
+// repeatable migrations
+const repeatableDir = "repeatable"
+
+// Repeatable is a migration that is re-applied whenever its file changes,
+// typically one that creates or replaces views, functions and triggers
+type Repeatable struct {
+	Name string // File name, e.g. "views.sql"
+	Path string
+}
+
+// Repeatables returns the repeatable migrations of a migrations directory,
+// sorted by name, which is the order they are applied in
+func (m *Migrator) Repeatables(migrationsDir string) ([]*Repeatable, error) {
+	return collectRepeatables(migrationsDir)
+}
+
+func collectRepeatables(migrationsDir string) ([]*Repeatable, error) {
+	files, err := filepath.Glob(filepath.Join(migrationsDir, repeatableDir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+
+	repeatables := make([]*Repeatable, len(files))
+	for i, path := range files {
+		repeatables[i] = &Repeatable{Name: filepath.Base(path), Path: path}
+	}
+	return repeatables, nil
+}
+
+// applyRepeatables applies the repeatable migrations that are new or changed
+// since they were last applied. Each runs in its own transaction together
+// with recording its checksum.
+func (m *Migrator) applyRepeatables(ctx context.Context, dbURL, migrationsDir string) error {
+	repeatables, err := collectRepeatables(migrationsDir)
+	if err != nil {
+		return fmt.Errorf("reading repeatable migrations: %w", err)
+	}
+	if len(repeatables) == 0 {
+		return nil
+	}
+
+	if err := m.ensureRepeatableTable(ctx, dbURL); err != nil {
+		return err
+	}
+	applied, err := m.appliedRepeatables(ctx, dbURL)
+	if err != nil {
+		return err
+	}
+
+	log := events.FromContext(ctx)
+	var count int
+	for _, r := range repeatables {
+		content, err := os.ReadFile(r.Path)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", r.Name, err)
+		}
+		sum := checksum(content)
+		if applied[r.Name] == sum {
+			continue
+		}
+
+		directives, err := parseDirectives(string(content))
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", r.Name, err)
+		}
+
+		step := log.Start("apply-repeatable", fmt.Sprintf("Applying repeatable %s...", r.Name)).Database(dbURL)
+		step.AddFiles(r.Path)
+		record := fmt.Sprintf(`INSERT INTO %s (name, checksum) VALUES ('%s', '%s')
+    ON CONFLICT (name) DO UPDATE SET checksum = EXCLUDED.checksum, applied_at = now();`,
+			repeatableTable, strings.ReplaceAll(r.Name, "'", "''"), sum)
+		if err := step.End(m.runScript(ctx, dbURL, migrationScript(string(content), record,
+			sessionDefaults(ctx).merge(directives.Settings), directives.NoTransaction))); err != nil {
+			return fmt.Errorf("applying repeatable %s: %w", r.Name, err)
+		}
+		count++
+	}
+
+	if count > 0 {
+		log.Info("migrate", fmt.Sprintf("Applied %d repeatable migration(s)", count))
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package migrate
+
+import (
+	"context"
+	"strings"
+
+	"github.com/tmwinc/seedup/pkg/executor"
+)
+
+// DumpSchema returns the schema of the database as written by pg_dump
+// --schema-only, excluding the tables seedup uses to track migrations
+func (m *Migrator) DumpSchema(ctx context.Context, dbURL string) (string, error) {
+	return dumpSchema(ctx, m.exec, dbURL)
+}
+
+// dumpSchema returns the schema of the database as SQL, without seedup's
+// bookkeeping tables, ownership and privileges
+func dumpSchema(ctx context.Context, exec executor.Executor, dbURL string) (string, error) {
+	args := []string{dbURL, "--schema-only", "--no-owner"}
+	for _, table := range BookkeepingTables {
+		args = append(args, "--exclude-table=public."+table)
+	}
+	args = append(args, "--exclude-table=public.goose_db_version_id_seq", "--no-privileges")
+
+	output, err := exec.RunWithOutput(ctx, "pg_dump", args...)
+	if err != nil {
+		return "", err
+	}
+
+	// Clean up the schema dump
+	// Remove search_path config that can cause issues
+	// Remove CloudSQL specific commands
+	var cleanedLines []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.Contains(line, "set_config") && strings.Contains(line, "search_path") {
+			continue
+		}
+		if strings.HasPrefix(line, "\\restrict") || strings.HasPrefix(line, "\\unrestrict") {
+			continue
+		}
+		cleanedLines = append(cleanedLines, line)
+	}
+
+	return strings.Join(cleanedLines, "\n"), nil
+}
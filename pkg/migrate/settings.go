@@ -0,0 +1,108 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SessionSettings are PostgreSQL settings applied to the session running a
+// migration. Values use PostgreSQL's duration syntax, e.g. "5s" or "10min";
+// empty leaves the server's setting unchanged and "0" disables the timeout.
+type SessionSettings struct {
+	LockTimeout      string // Abort a statement waiting this long for a lock
+	StatementTimeout string // Abort a statement running this long
+}
+
+type sessionDefaultsKey struct{}
+
+// WithSessionDefaults returns a copy of ctx whose migrations run with the
+// given settings unless they set their own with a directive
+func WithSessionDefaults(ctx context.Context, defaults SessionSettings) context.Context {
+	return context.WithValue(ctx, sessionDefaultsKey{}, defaults)
+}
+
+func sessionDefaults(ctx context.Context) SessionSettings {
+	defaults, _ := ctx.Value(sessionDefaultsKey{}).(SessionSettings)
+	return defaults
+}
+
+var timeoutRe = regexp.MustCompile(`^\d+(\.\d+)?\s*(us|ms|s|min|h|d)?$`)
+
+// Validate checks that the settings are valid PostgreSQL durations
+func (s SessionSettings) Validate() error {
+	for _, setting := range [][2]string{{"lock_timeout", s.LockTimeout}, {"statement_timeout", s.StatementTimeout}} {
+		if setting[1] != "" && !timeoutRe.MatchString(setting[1]) {
+			return fmt.Errorf("invalid %s %q: expected a duration such as 500ms, 5s or 10min", setting[0], setting[1])
+		}
+	}
+	return nil
+}
+
+// merge returns s with the settings set in override replacing its own
+func (s SessionSettings) merge(override SessionSettings) SessionSettings {
+	if override.LockTimeout != "" {
+		s.LockTimeout = override.LockTimeout
+	}
+	if override.StatementTimeout != "" {
+		s.StatementTimeout = override.StatementTimeout
+	}
+	return s
+}
+
+// sql returns the SET statements applying the settings
+func (s SessionSettings) sql() string {
+	var sql strings.Builder
+	if s.LockTimeout != "" {
+		fmt.Fprintf(&sql, "SET lock_timeout = '%s';\n", s.LockTimeout)
+	}
+	if s.StatementTimeout != "" {
+		fmt.Fprintf(&sql, "SET statement_timeout = '%s';\n", s.StatementTimeout)
+	}
+	return sql.String()
+}
+
+// directivePrefix starts a seedup directive comment, e.g. "-- seedup:lock_timeout=5s"
+const directivePrefix = "-- seedup:"
+
+// parseDirective applies a "-- seedup:" directive line to a parsed migration.
+// Lint suppressions are left to the linter.
+func parseDirective(parsed *parsedMigration, line string) error {
+	directive := strings.TrimSpace(strings.TrimPrefix(line, directivePrefix))
+	key, value, _ := strings.Cut(directive, "=")
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+	switch key {
+	case "lock_timeout":
+		parsed.Settings.LockTimeout = value
+	case "statement_timeout":
+		parsed.Settings.StatementTimeout = value
+	case "no-transaction":
+		parsed.NoTransaction = true
+		return nil
+	default:
+		if strings.HasPrefix(key, "lint-ignore") {
+			return nil
+		}
+		return fmt.Errorf("unknown directive %q", line)
+	}
+
+	if value == "" {
+		return fmt.Errorf("directive %q needs a value", line)
+	}
+	return parsed.Settings.Validate()
+}
+
+// parseDirectives reads the "-- seedup:" directives of a plain SQL file
+func parseDirectives(content string) (*parsedMigration, error) {
+	var parsed parsedMigration
+	for i, line := range strings.Split(content, "\n") {
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, directivePrefix) {
+			if err := parseDirective(&parsed, trimmed); err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+		}
+	}
+	return &parsed, nil
+}
@@ -0,0 +1,64 @@
+package migrate
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSessionSettingsValidate(t *testing.T) {
+	tests := []struct {
+		settings SessionSettings
+		wantErr  string
+	}{
+		{SessionSettings{}, ""},
+		{SessionSettings{LockTimeout: "500ms", StatementTimeout: "10min"}, ""},
+		{SessionSettings{LockTimeout: "0", StatementTimeout: "1.5 h"}, ""},
+		{SessionSettings{LockTimeout: "5 seconds"}, `invalid lock_timeout "5 seconds": expected a duration such as 500ms, 5s or 10min`},
+		{SessionSettings{StatementTimeout: "5s'; DROP TABLE users; --"}, `invalid statement_timeout "5s'; DROP TABLE users; --": expected a duration such as 500ms, 5s or 10min`},
+	}
+
+	for _, tt := range tests {
+		err := tt.settings.Validate()
+		if got := errString(err); got != tt.wantErr {
+			t.Errorf("Validate(%+v) = %q, want %q", tt.settings, got, tt.wantErr)
+		}
+	}
+}
+
+func TestSessionSettingsSQL(t *testing.T) {
+	defaults := SessionSettings{LockTimeout: "5s", StatementTimeout: "1min"}
+	ctx := WithSessionDefaults(context.Background(), defaults)
+
+	// A migration's directives override the defaults one setting at a time
+	settings := sessionDefaults(ctx).merge(SessionSettings{StatementTimeout: "0"})
+	want := "SET lock_timeout = '5s';\nSET statement_timeout = '0';\n"
+	if got := settings.sql(); got != want {
+		t.Errorf("sql() = %q, want %q", got, want)
+	}
+
+	if got := sessionDefaults(context.Background()).sql(); got != "" {
+		t.Errorf("sql() without defaults = %q, want nothing", got)
+	}
+}
+
+func TestParseDirectives(t *testing.T) {
+	parsed, err := parseDirectives("-- seedup:no-transaction\n  -- seedup:lock_timeout = 2s\nCREATE VIEW v AS SELECT 1; -- seedup:fast\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.NoTransaction || parsed.Settings != (SessionSettings{LockTimeout: "2s"}) {
+		t.Errorf("parseDirectives = %+v, want no transaction and a 2s lock timeout", parsed)
+	}
+
+	_, err = parseDirectives("CREATE VIEW v AS SELECT 1;\n-- seedup:statement_timeout\n")
+	if want := `line 2: directive "-- seedup:statement_timeout" needs a value`; errString(err) != want {
+		t.Errorf("parseDirectives = %v, want %q", err, want)
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,211 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migration is a versioned migration: a SQL file in the migrations directory
+// or a registered Go migration
+type Migration struct {
+	Version int64
+	Name    string // Name without version prefix and extension, e.g. "add_users"
+	Path    string
+	Go      *GoMigration // nil for SQL migrations
+}
+
+// File returns the migration's file name
+func (m *Migration) File() string {
+	return filepath.Base(m.Path)
+}
+
+// collectMigrations returns the migrations in dir sorted by version.
+// Files must be named <version>_<name>.sql; other files are ignored.
+func collectMigrations(dir string) ([]*Migration, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []*Migration
+	seen := make(map[int64]string)
+	for _, path := range files {
+		version, name, ok := parseFilename(filepath.Base(path))
+		if !ok {
+			continue
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, other, filepath.Base(path))
+		}
+		seen[version] = filepath.Base(path)
+		migrations = append(migrations, &Migration{Version: version, Name: name, Path: path})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// parseFilename splits "<version>_<name>.<ext>" into its version and name
+func parseFilename(file string) (int64, string, bool) {
+	base := strings.TrimSuffix(file, filepath.Ext(file))
+	prefix, name, _ := strings.Cut(base, "_")
+	version, err := strconv.ParseInt(prefix, 10, 64)
+	if err != nil || version < 1 {
+		return 0, "", false
+	}
+	return version, name, true
+}
+
+// parsedMigration holds the sections of a goose-format SQL migration
+type parsedMigration struct {
+	Up            string
+	Down          string
+	UpLine        int // File line of the first line of Up
+	DownLine      int // File line of the first line of Down
+	HasDown       bool
+	NoTransaction bool
+	Settings      SessionSettings // Set by "-- seedup:" directives
+	Checksum      string          // SHA-256 of the file contents
+}
+
+// parseMigrationFile reads and parses a goose-format SQL migration
+func parseMigrationFile(path string) (*parsedMigration, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := parseMigration(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", filepath.Base(path), err)
+	}
+	parsed.Checksum = checksum(content)
+	return parsed, nil
+}
+
+// fileChecksum returns the checksum of a migration file
+func fileChecksum(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return checksum(content), nil
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+var envsubRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// parseMigration splits a migration into its Up and Down sections following
+// goose's annotations: "-- +goose Up", "-- +goose Down", "-- +goose
+// StatementBegin"/"StatementEnd", "-- +goose NO TRANSACTION" and
+// "-- +goose ENVSUB ON"/"OFF", as well as seedup's own "-- seedup:"
+// directives (see parseDirective). Statement blocks need no special handling
+// since statements are split like psql does, honouring quotes and
+// dollar-quoted bodies. Annotation lines within a section are kept as blank
+// lines so section line numbers map back to the file.
+func parseMigration(content string) (*parsedMigration, error) {
+	var (
+		parsed  parsedMigration
+		up      strings.Builder
+		down    strings.Builder
+		section *strings.Builder
+		inBlock bool
+		envsub  bool
+		hasUp   bool
+	)
+
+	for i, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "-- +goose ") {
+			directive := strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(trimmed, "-- +goose ")))
+			switch directive {
+			case "UP":
+				if inBlock {
+					return nil, fmt.Errorf("line %d: Up annotation inside StatementBegin block", i+1)
+				}
+				hasUp = true
+				section = &up
+				parsed.UpLine = i + 2
+			case "DOWN":
+				if inBlock {
+					return nil, fmt.Errorf("line %d: Down annotation inside StatementBegin block", i+1)
+				}
+				parsed.HasDown = true
+				section = &down
+				parsed.DownLine = i + 2
+			case "STATEMENTBEGIN":
+				if inBlock {
+					return nil, fmt.Errorf("line %d: nested StatementBegin", i+1)
+				}
+				inBlock = true
+			case "STATEMENTEND":
+				if !inBlock {
+					return nil, fmt.Errorf("line %d: StatementEnd without StatementBegin", i+1)
+				}
+				inBlock = false
+			case "NO TRANSACTION":
+				parsed.NoTransaction = true
+			case "ENVSUB ON":
+				envsub = true
+			case "ENVSUB OFF":
+				envsub = false
+			default:
+				return nil, fmt.Errorf("line %d: unknown annotation %q", i+1, trimmed)
+			}
+			if section != nil && directive != "UP" && directive != "DOWN" {
+				section.WriteString("\n")
+			}
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, directivePrefix) {
+			if err := parseDirective(&parsed, trimmed); err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+		}
+
+		if section == nil {
+			if trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+				return nil, fmt.Errorf("line %d: statement before '-- +goose Up' annotation", i+1)
+			}
+			continue
+		}
+
+		if envsub {
+			line = envsubRe.ReplaceAllStringFunc(line, func(ref string) string {
+				m := envsubRe.FindStringSubmatch(ref)
+				if value, ok := os.LookupEnv(m[1]); ok {
+					return value
+				}
+				return m[2]
+			})
+		}
+
+		section.WriteString(line)
+		section.WriteString("\n")
+	}
+
+	if !hasUp {
+		return nil, fmt.Errorf("missing '-- +goose Up' annotation")
+	}
+	if inBlock {
+		return nil, fmt.Errorf("StatementBegin without matching StatementEnd")
+	}
+
+	parsed.Up = up.String()
+	parsed.Down = down.String()
+	return &parsed, nil
+}
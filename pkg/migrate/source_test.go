@@ -0,0 +1,132 @@
+package migrate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMigration(t *testing.T) {
+	t.Setenv("SEEDUP_TEST_TABLE", "accounts")
+
+	tests := []struct {
+		name    string
+		content string
+		want    *parsedMigration
+	}{
+		{
+			name:    "up and down",
+			content: "-- +goose Up\nCREATE TABLE t (id int);\n\n-- +goose Down\nDROP TABLE t;\n",
+			want: &parsedMigration{
+				Up:       "CREATE TABLE t (id int);\n\n",
+				Down:     "DROP TABLE t;\n\n",
+				UpLine:   2,
+				DownLine: 5,
+				HasDown:  true,
+			},
+		},
+		{
+			name:    "up only, after leading comments",
+			content: "-- Adds t\n\n-- +goose Up\nCREATE TABLE t (id int);",
+			want:    &parsedMigration{Up: "CREATE TABLE t (id int);\n", UpLine: 4},
+		},
+		{
+			name: "statement block kept as blank lines",
+			content: "-- +goose Up\n-- +goose StatementBegin\nCREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql;\n" +
+				"-- +goose StatementEnd\n",
+			want: &parsedMigration{
+				Up:     "\nCREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql;\n\n\n",
+				UpLine: 2,
+			},
+		},
+		{
+			name:    "no transaction",
+			content: "-- +goose NO TRANSACTION\n-- +goose Up\nCREATE INDEX CONCURRENTLY i ON t (id);\n",
+			want:    &parsedMigration{Up: "CREATE INDEX CONCURRENTLY i ON t (id);\n\n", UpLine: 3, NoTransaction: true},
+		},
+		{
+			name: "seedup directives",
+			content: "-- +goose Up\n-- seedup:no-transaction\n-- seedup:lock_timeout=5s\n-- seedup:statement_timeout = 10min\n" +
+				"-- seedup:lint-ignore drop-column\nALTER TABLE t DROP COLUMN c;\n",
+			want: &parsedMigration{
+				Up: "-- seedup:no-transaction\n-- seedup:lock_timeout=5s\n-- seedup:statement_timeout = 10min\n" +
+					"-- seedup:lint-ignore drop-column\nALTER TABLE t DROP COLUMN c;\n\n",
+				UpLine:        2,
+				NoTransaction: true,
+				Settings:      SessionSettings{LockTimeout: "5s", StatementTimeout: "10min"},
+			},
+		},
+		{
+			name: "envsub",
+			content: "-- +goose Up\n-- +goose ENVSUB ON\nCREATE TABLE ${SEEDUP_TEST_TABLE} (id int);\n" +
+				"CREATE TABLE ${SEEDUP_TEST_UNSET:-fallback} (id int);\n-- +goose ENVSUB OFF\nSELECT '${SEEDUP_TEST_TABLE}';\n",
+			want: &parsedMigration{
+				Up:     "\nCREATE TABLE accounts (id int);\nCREATE TABLE fallback (id int);\n\nSELECT '${SEEDUP_TEST_TABLE}';\n\n",
+				UpLine: 2,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMigration(tt.content)
+			if err != nil {
+				t.Fatalf("parseMigration: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMigration\n got: %#v\nwant: %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMigrationErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"missing up", "CREATE TABLE t (id int);\n", "line 1: statement before '-- +goose Up' annotation"},
+		{"empty", "-- just a comment\n", "missing '-- +goose Up' annotation"},
+		{"nested block", "-- +goose Up\n-- +goose StatementBegin\n-- +goose StatementBegin\n", "line 3: nested StatementBegin"},
+		{"end without begin", "-- +goose Up\n-- +goose StatementEnd\n", "line 2: StatementEnd without StatementBegin"},
+		{"unclosed block", "-- +goose Up\n-- +goose StatementBegin\nSELECT 1;\n", "StatementBegin without matching StatementEnd"},
+		{"section inside block", "-- +goose Up\n-- +goose StatementBegin\n-- +goose Down\n", "line 3: Down annotation inside StatementBegin block"},
+		{"unknown annotation", "-- +goose Up\n-- +goose Sideways\n", `line 2: unknown annotation "-- +goose Sideways"`},
+		{"unknown directive", "-- +goose Up\n-- seedup:fast\n", `line 2: unknown directive "-- seedup:fast"`},
+		{"directive without value", "-- +goose Up\n-- seedup:lock_timeout=\n", `line 2: directive "-- seedup:lock_timeout=" needs a value`},
+		{"invalid timeout", "-- +goose Up\n-- seedup:lock_timeout=soon\n", `line 2: invalid lock_timeout "soon"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseMigration(tt.content)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("parseMigration error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilename(t *testing.T) {
+	tests := []struct {
+		file    string
+		version int64
+		name    string
+		ok      bool
+	}{
+		{"00001_create_users.sql", 1, "create_users", true},
+		{"20260101120000_add_index.go", 20260101120000, "add_index", true},
+		{"42.sql", 42, "", true},
+		{"00000_zero.sql", 0, "", false},
+		{"readme.sql", 0, "", false},
+		{"v1_init.sql", 0, "", false},
+	}
+
+	for _, tt := range tests {
+		version, name, ok := parseFilename(tt.file)
+		if version != tt.version || name != tt.name || ok != tt.ok {
+			t.Errorf("parseFilename(%q) = %d, %q, %v; want %d, %q, %v", tt.file, version, name, ok, tt.version, tt.name, tt.ok)
+		}
+	}
+}
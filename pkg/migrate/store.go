@@ -0,0 +1,198 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// versionTable is the goose-compatible table recording applied migrations
+	versionTable = "goose_db_version"
+
+	// checksumTable records the checksum of each applied migration file
+	checksumTable = "seedup_migration_checksums"
+
+	// repeatableTable records the checksum each repeatable migration was last applied with
+	repeatableTable = "seedup_repeatable_migrations"
+
+	// dataTable records the progress of data migrations
+	dataTable = "seedup_data_migrations"
+)
+
+// BookkeepingTables are the tables seedup maintains in the public schema to
+// track migrations; they are excluded from schema dumps and seed data
+var BookkeepingTables = []string{versionTable, checksumTable, repeatableTable, dataTable}
+
+// appliedMigration is a version recorded in the version table
+type appliedMigration struct {
+	ID        int64 // Row id, reflecting the order versions were applied in
+	Version   int64
+	AppliedAt *time.Time
+}
+
+// ensureVersionTable creates the version table if it doesn't exist, using the
+// same layout and initial row as goose
+func (m *Migrator) ensureVersionTable(ctx context.Context, dbURL string) error {
+	exists, err := m.hasTable(ctx, dbURL, versionTable)
+	if err != nil || exists {
+		return err
+	}
+
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]s (
+    id serial NOT NULL,
+    version_id bigint NOT NULL,
+    is_applied boolean NOT NULL,
+    tstamp timestamp NULL DEFAULT now(),
+    PRIMARY KEY (id)
+);
+INSERT INTO %[1]s (version_id, is_applied) SELECT 0, true WHERE NOT EXISTS (SELECT 1 FROM %[1]s);`, versionTable)
+	if _, err := m.exec.RunSQL(ctx, dbURL, query); err != nil {
+		return fmt.Errorf("creating version table: %w", err)
+	}
+	return nil
+}
+
+// ensureChecksumTable creates the checksum table if it doesn't exist
+func (m *Migrator) ensureChecksumTable(ctx context.Context, dbURL string) error {
+	exists, err := m.hasTable(ctx, dbURL, checksumTable)
+	if err != nil || exists {
+		return err
+	}
+
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+    version_id bigint PRIMARY KEY,
+    checksum text NOT NULL,
+    recorded_at timestamptz NOT NULL DEFAULT now()
+)`, checksumTable)
+	if _, err := m.exec.RunSQL(ctx, dbURL, query); err != nil {
+		return fmt.Errorf("creating checksum table: %w", err)
+	}
+	return nil
+}
+
+// ensureRepeatableTable creates the repeatable migrations table if it doesn't exist
+func (m *Migrator) ensureRepeatableTable(ctx context.Context, dbURL string) error {
+	exists, err := m.hasTable(ctx, dbURL, repeatableTable)
+	if err != nil || exists {
+		return err
+	}
+
+	if _, err := m.exec.RunSQL(ctx, dbURL, createRepeatableTable()); err != nil {
+		return fmt.Errorf("creating repeatable migrations table: %w", err)
+	}
+	return nil
+}
+
+// createRepeatableTable returns the statement creating the repeatable migrations table
+func createRepeatableTable() string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+    name text PRIMARY KEY,
+    checksum text NOT NULL,
+    applied_at timestamptz NOT NULL DEFAULT now()
+)`, repeatableTable)
+}
+
+// appliedRepeatables returns the checksum each repeatable migration was last
+// applied with. A missing table, as in plan mode, means none was applied.
+func (m *Migrator) appliedRepeatables(ctx context.Context, dbURL string) (map[string]string, error) {
+	checksums := make(map[string]string)
+	exists, err := m.hasTable(ctx, dbURL, repeatableTable)
+	if err != nil || !exists {
+		return checksums, err
+	}
+
+	result, err := m.exec.Query(ctx, dbURL, fmt.Sprintf("SELECT name, checksum FROM %s", repeatableTable))
+	if err != nil {
+		return nil, fmt.Errorf("reading repeatable migrations: %w", err)
+	}
+
+	for _, row := range result.Rows {
+		checksums[row[0].String] = row[1].String
+	}
+	return checksums, nil
+}
+
+// hasTable reports whether a table exists on the search path
+func (m *Migrator) hasTable(ctx context.Context, dbURL, table string) (bool, error) {
+	result, err := m.exec.Query(ctx, dbURL, fmt.Sprintf("SELECT to_regclass('%s') IS NOT NULL", table))
+	if err != nil {
+		return false, fmt.Errorf("checking table %s: %w", table, err)
+	}
+	return len(result.Rows) > 0 && result.Rows[0][0].String == "t", nil
+}
+
+// appliedVersions returns the applied migrations sorted by version.
+// As with goose, the latest row for a version decides whether it is applied.
+func (m *Migrator) appliedVersions(ctx context.Context, dbURL string) ([]appliedMigration, error) {
+	query := fmt.Sprintf(`SELECT id, version_id, to_char(tstamp, 'YYYY-MM-DD"T"HH24:MI:SS') FROM (
+    SELECT DISTINCT ON (version_id) id, version_id, is_applied, tstamp
+    FROM %s ORDER BY version_id, id DESC
+) v WHERE is_applied AND version_id > 0 ORDER BY version_id`, versionTable)
+
+	result, err := m.exec.Query(ctx, dbURL, query)
+	if err != nil {
+		return nil, fmt.Errorf("reading applied versions: %w", err)
+	}
+
+	applied := make([]appliedMigration, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		id, err := strconv.ParseInt(row[0].String, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q: %w", row[0].String, err)
+		}
+		version, err := strconv.ParseInt(row[1].String, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q: %w", row[1].String, err)
+		}
+		a := appliedMigration{ID: id, Version: version}
+		if row[2].Valid {
+			if t, err := time.Parse("2006-01-02T15:04:05", row[2].String); err == nil {
+				a.AppliedAt = &t
+			}
+		}
+		applied = append(applied, a)
+	}
+	return applied, nil
+}
+
+// recordedChecksums returns the checksums recorded for applied versions.
+// Versions applied before checksums were recorded have no entry.
+func (m *Migrator) recordedChecksums(ctx context.Context, dbURL string) (map[int64]string, error) {
+	checksums := make(map[int64]string)
+	exists, err := m.hasTable(ctx, dbURL, checksumTable)
+	if err != nil || !exists {
+		return checksums, err
+	}
+
+	result, err := m.exec.Query(ctx, dbURL, fmt.Sprintf("SELECT version_id, checksum FROM %s", checksumTable))
+	if err != nil {
+		return nil, fmt.Errorf("reading checksums: %w", err)
+	}
+	for _, row := range result.Rows {
+		version, err := strconv.ParseInt(row[0].String, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q: %w", row[0].String, err)
+		}
+		checksums[version] = row[1].String
+	}
+	return checksums, nil
+}
+
+// runScript writes script to a temporary file and executes it in one session
+func (m *Migrator) runScript(ctx context.Context, dbURL, script string) error {
+	tmpFile, err := os.CreateTemp("", "migration-*.sql")
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.WriteString(script); err != nil {
+		return fmt.Errorf("writing migration script: %w", err)
+	}
+	tmpFile.Close()
+
+	return m.exec.RunSQLFile(ctx, dbURL, tmpFile.Name())
+}
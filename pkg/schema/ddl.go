@@ -0,0 +1,332 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Plan returns the DDL statements that turn schema from into schema to.
+// Objects are dropped first, dependents before what they depend on, then
+// created or altered in kind order. Indexes, constraints, triggers, policies
+// and views whose definitions differ are dropped and recreated; columns,
+// sequences and extensions are altered in place and functions replaced.
+// Changes with no safe DDL equivalent, like a modified enum type, domain or
+// partition key, and any change to an object of KindOther, are returned as
+// unsupported instead.
+func Plan(from, to Schema) (statements []string, unsupported []Change) {
+	changes := make(map[string]Change)
+	for _, c := range Diff(to, from) {
+		if c.Type == Modified {
+			changes[c.Expected.key()] = c
+		}
+	}
+
+	// Drops, in reverse kind order
+	for i := len(kindOrder) - 1; i >= 0; i-- {
+		kind := kindOrder[i]
+		for _, o := range from.Objects(kind) {
+			_, kept := to[o.key()]
+			switch {
+			case o.Table != "" && !to.hasTable(o.Schema, o.Table):
+				// Dropped with the table
+			case kind == KindOther && !kept:
+				unsupported = append(unsupported, Change{Type: Extra, Kind: kind, Name: o.QualifiedName(), Actual: &o})
+			case !kept:
+				statements = append(statements, dropSQL(o))
+			case recreated(changes, o):
+				statements = append(statements, dropSQL(o))
+			}
+		}
+	}
+	for _, name := range schemaNames(from) {
+		if !to.hasSchema(name) && name != "public" {
+			statements = append(statements, "DROP SCHEMA IF EXISTS "+ident(name))
+		}
+	}
+
+	// Creates and alters, in kind order
+	for _, name := range schemaNames(to) {
+		if !from.hasSchema(name) && name != "public" {
+			statements = append(statements, "CREATE SCHEMA IF NOT EXISTS "+ident(name))
+		}
+	}
+	for _, kind := range kindOrder {
+		for _, o := range to.Objects(kind) {
+			old, exists := from[o.key()]
+			switch {
+			case kind == KindColumn && !from.hasTable(o.Schema, o.Table):
+				// Created with the table
+			case kind == KindOther && !exists:
+				unsupported = append(unsupported, Change{Type: Missing, Kind: kind, Name: o.QualifiedName(), Expected: &o})
+			case !exists:
+				statements = append(statements, createSQL(o, to))
+			case recreated(changes, o):
+				statements = append(statements, createSQL(o, to))
+			default:
+				c, modified := changes[o.key()]
+				if !modified {
+					continue
+				}
+				alter, ok := alterSQL(old, o)
+				if !ok {
+					unsupported = append(unsupported, c)
+					continue
+				}
+				statements = append(statements, alter...)
+			}
+		}
+	}
+
+	// Sequences are created unowned, as their owning tables may not exist
+	// until after them
+	for _, o := range to.Objects(KindSequence) {
+		_, owner := sequenceOptions(o.Definition)
+		var oldOwner string
+		if old, exists := from[o.key()]; exists {
+			_, oldOwner = sequenceOptions(old.Definition)
+		}
+		if owner == oldOwner {
+			continue
+		}
+		if owner == "" {
+			owner = "NONE"
+		}
+		statements = append(statements, fmt.Sprintf("ALTER SEQUENCE %s OWNED BY %s", o.ident(), owner))
+	}
+
+	return statements, unsupported
+}
+
+// sequenceOptions splits a sequence definition into its options and the
+// column owning the sequence, if any
+func sequenceOptions(definition string) (options, owner string) {
+	options, owner, _ = strings.Cut(definition, " OWNED BY ")
+	return options, owner
+}
+
+// recreated reports whether a modified object is dropped and created again
+func recreated(changes map[string]Change, o Object) bool {
+	if _, modified := changes[o.key()]; !modified {
+		return false
+	}
+	switch o.Kind {
+	case KindConstraint, KindIndex, KindView, KindTrigger, KindPolicy:
+		return true
+	}
+	return false
+}
+
+func createSQL(o Object, s Schema) string {
+	switch o.Kind {
+	case KindExtension:
+		return fmt.Sprintf("CREATE EXTENSION IF NOT EXISTS %s WITH SCHEMA %s %s", ident(o.Name), ident(o.Schema), o.Definition)
+	case KindDomain:
+		return fmt.Sprintf("CREATE DOMAIN %s AS %s", o.ident(), o.Definition)
+	case KindSequence:
+		options, _ := sequenceOptions(o.Definition)
+		return fmt.Sprintf("CREATE SEQUENCE %s %s", o.ident(), options)
+	case KindPolicy:
+		return fmt.Sprintf("CREATE POLICY %s ON %s %s", ident(o.Name), o.tableIdent(), o.Definition)
+	case KindType:
+		return fmt.Sprintf("CREATE TYPE %s AS %s", o.ident(), o.Definition)
+	case KindTable:
+		var columns []string
+		for _, c := range s.Objects(KindColumn) {
+			if c.Schema == o.Schema && c.Table == o.Name {
+				columns = append(columns, "    "+ident(c.Name)+" "+c.Definition)
+			}
+		}
+		sql := fmt.Sprintf("CREATE TABLE %s (\n%s\n)", o.ident(), strings.Join(columns, ",\n"))
+		if o.Definition != "" {
+			sql += " " + o.Definition
+		}
+		return sql
+	case KindColumn:
+		return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", o.tableIdent(), ident(o.Name), o.Definition)
+	case KindConstraint:
+		return fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s", o.tableIdent(), ident(o.Name), o.Definition)
+	case KindView:
+		return fmt.Sprintf("CREATE %s", strings.Replace(strings.TrimSuffix(o.Definition, ";"), "VIEW AS ", "VIEW "+o.ident()+" AS\n", 1))
+	default:
+		// Indexes, functions and triggers are defined by a full CREATE statement
+		return o.Definition
+	}
+}
+
+func dropSQL(o Object) string {
+	switch o.Kind {
+	case KindExtension:
+		return "DROP EXTENSION " + ident(o.Name)
+	case KindDomain:
+		return "DROP DOMAIN " + o.ident()
+	case KindSequence:
+		return "DROP SEQUENCE " + o.ident()
+	case KindPolicy:
+		return fmt.Sprintf("DROP POLICY %s ON %s", ident(o.Name), o.tableIdent())
+	case KindType:
+		return "DROP TYPE " + o.ident()
+	case KindTable:
+		return "DROP TABLE " + o.ident()
+	case KindColumn:
+		return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", o.tableIdent(), ident(o.Name))
+	case KindConstraint:
+		return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", o.tableIdent(), ident(o.Name))
+	case KindIndex:
+		return "DROP INDEX " + o.ident()
+	case KindFunction:
+		name, args, _ := strings.Cut(o.Name, "(")
+		return fmt.Sprintf("DROP ROUTINE %s.%s(%s", ident(o.Schema), ident(name), args)
+	case KindView:
+		if strings.HasPrefix(o.Definition, "MATERIALIZED ") {
+			return "DROP MATERIALIZED VIEW " + o.ident()
+		}
+		return "DROP VIEW " + o.ident()
+	case KindTrigger:
+		return fmt.Sprintf("DROP TRIGGER %s ON %s", ident(o.Name), o.tableIdent())
+	}
+	return ""
+}
+
+// alterSQL returns the statements that change old into o in place
+func alterSQL(old, o Object) ([]string, bool) {
+	switch o.Kind {
+	case KindFunction:
+		return []string{o.Definition}, true
+	case KindColumn:
+		return alterColumnSQL(old, o)
+	case KindExtension:
+		version := strings.TrimPrefix(o.Definition, "VERSION ")
+		return []string{fmt.Sprintf("ALTER EXTENSION %s UPDATE TO %s", ident(o.Name), version)}, true
+	case KindSequence:
+		// A change of owner alone is applied once the tables exist
+		from, _ := sequenceOptions(old.Definition)
+		to, _ := sequenceOptions(o.Definition)
+		if from == to {
+			return nil, true
+		}
+		return []string{fmt.Sprintf("ALTER SEQUENCE %s %s", o.ident(), to)}, true
+	}
+	// Enum values cannot be removed or reordered, nor composite types and
+	// domains changed, and a table's partitioning cannot be changed without
+	// recreating it
+	return nil, false
+}
+
+func alterColumnSQL(old, o Object) ([]string, bool) {
+	from, to := parseColumn(old.Definition), parseColumn(o.Definition)
+	if from.generated != to.generated {
+		return nil, false
+	}
+
+	prefix := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s ", o.tableIdent(), ident(o.Name))
+	var statements []string
+	if from.dataType != to.dataType {
+		statements = append(statements, fmt.Sprintf("%sTYPE %s USING %s::%s", prefix, to.dataType, ident(o.Name), to.dataType))
+	}
+	if from.defaultExpr != to.defaultExpr {
+		if to.defaultExpr == "" {
+			statements = append(statements, prefix+"DROP DEFAULT")
+		} else {
+			statements = append(statements, prefix+"SET DEFAULT "+to.defaultExpr)
+		}
+	}
+	if from.notNull != to.notNull {
+		if to.notNull {
+			statements = append(statements, prefix+"SET NOT NULL")
+		} else {
+			statements = append(statements, prefix+"DROP NOT NULL")
+		}
+	}
+	return statements, len(statements) > 0
+}
+
+// column is a column definition as produced by the column catalog query
+type column struct {
+	dataType    string
+	notNull     bool
+	defaultExpr string
+	generated   string // Generation expression or identity clause
+}
+
+func parseColumn(definition string) column {
+	var c column
+	end := len(definition)
+	for _, marker := range []string{" NOT NULL", " DEFAULT ", " GENERATED "} {
+		if i := strings.Index(definition, marker); i >= 0 && i < end {
+			end = i
+		}
+	}
+	c.dataType, definition = definition[:end], definition[end:]
+
+	if rest, ok := strings.CutPrefix(definition, " NOT NULL"); ok {
+		c.notNull = true
+		definition = rest
+	}
+	if rest, ok := strings.CutPrefix(definition, " DEFAULT "); ok {
+		c.defaultExpr = rest
+	} else {
+		c.generated = strings.TrimSpace(definition)
+	}
+	return c
+}
+
+func (o Object) ident() string {
+	return ident(o.Schema) + "." + ident(o.Name)
+}
+
+func (o Object) tableIdent() string {
+	return ident(o.Schema) + "." + ident(o.Table)
+}
+
+// schemaNames returns the sorted names of the schemas containing objects
+func schemaNames(s Schema) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, o := range s {
+		if !seen[o.Schema] {
+			seen[o.Schema] = true
+			names = append(names, o.Schema)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s Schema) hasSchema(name string) bool {
+	for _, o := range s {
+		if o.Schema == name {
+			return true
+		}
+	}
+	return false
+}
+
+var plainIdentRe = regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`)
+
+// reservedWords are the PostgreSQL keywords that cannot be used as bare identifiers
+var reservedWords = map[string]bool{
+	"all": true, "analyse": true, "analyze": true, "and": true, "any": true, "array": true, "as": true,
+	"asc": true, "asymmetric": true, "both": true, "case": true, "cast": true, "check": true,
+	"collate": true, "column": true, "constraint": true, "create": true, "current_catalog": true,
+	"current_date": true, "current_role": true, "current_time": true, "current_timestamp": true,
+	"current_user": true, "default": true, "deferrable": true, "desc": true, "distinct": true,
+	"do": true, "else": true, "end": true, "except": true, "false": true, "fetch": true, "for": true,
+	"foreign": true, "from": true, "grant": true, "group": true, "having": true, "in": true,
+	"initially": true, "intersect": true, "into": true, "lateral": true, "leading": true,
+	"limit": true, "localtime": true, "localtimestamp": true, "not": true, "null": true,
+	"offset": true, "on": true, "only": true, "or": true, "order": true, "placing": true,
+	"primary": true, "references": true, "returning": true, "select": true, "session_user": true,
+	"some": true, "symmetric": true, "table": true, "then": true, "to": true, "trailing": true,
+	"true": true, "union": true, "unique": true, "user": true, "using": true, "variadic": true,
+	"when": true, "where": true, "window": true, "with": true,
+}
+
+// ident quotes an identifier unless it can be written bare
+func ident(name string) string {
+	if plainIdentRe.MatchString(name) && !reservedWords[name] {
+		return name
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
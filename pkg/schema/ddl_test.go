@@ -0,0 +1,129 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	emailNotNull := usersEmail
+	emailNotNull.Definition = "character varying(255) NOT NULL DEFAULT ''::character varying"
+	uniqueEmail := usersEmailIx
+	uniqueEmail.Definition = "CREATE UNIQUE INDEX users_email_idx ON public.users USING btree (email)"
+	legacy := Object{Kind: KindColumn, Schema: "public", Table: "users", Name: "legacy", Definition: "text", Position: 3}
+	audit := Object{Kind: KindTable, Schema: "audit", Name: "events"}
+	auditAt := Object{Kind: KindColumn, Schema: "audit", Table: "events", Name: "at", Definition: "timestamp with time zone", Position: 1}
+	auditUser := Object{Kind: KindColumn, Schema: "audit", Table: "events", Name: "user", Definition: "bigint", Position: 2}
+	citext := Object{Kind: KindExtension, Schema: "public", Name: "citext", Definition: "VERSION '1.6'"}
+
+	tests := []struct {
+		name     string
+		from, to Schema
+		want     []string
+	}{
+		{
+			name: "create",
+			from: schemaOf(),
+			to:   schemaOf(citext, audit, auditAt, auditUser, usersTable, usersID, usersEmail, usersPkey, usersEmailIx),
+			want: []string{
+				"CREATE SCHEMA IF NOT EXISTS audit",
+				"CREATE EXTENSION IF NOT EXISTS citext WITH SCHEMA public VERSION '1.6'",
+				"CREATE TABLE audit.events (\n    at timestamp with time zone,\n    \"user\" bigint\n)",
+				"CREATE TABLE public.users (\n    id bigint NOT NULL,\n    email text\n)",
+				"ALTER TABLE public.users ADD CONSTRAINT users_pkey PRIMARY KEY (id)",
+				"CREATE INDEX users_email_idx ON public.users USING btree (email)",
+			},
+		},
+		{
+			name: "drop",
+			from: schemaOf(audit, auditAt, usersTable, usersID, legacy, usersEmailIx),
+			to:   schemaOf(usersTable, usersID),
+			want: []string{
+				"DROP INDEX public.users_email_idx",
+				"ALTER TABLE public.users DROP COLUMN legacy",
+				"DROP TABLE audit.events",
+				"DROP SCHEMA IF EXISTS audit",
+			},
+		},
+		{
+			name: "alter",
+			from: schemaOf(usersTable, usersID, usersEmail, usersEmailIx),
+			to:   schemaOf(usersTable, usersID, emailNotNull, uniqueEmail, legacy),
+			want: []string{
+				"DROP INDEX public.users_email_idx",
+				"ALTER TABLE public.users ALTER COLUMN email TYPE character varying(255) USING email::character varying(255)",
+				"ALTER TABLE public.users ALTER COLUMN email SET DEFAULT ''::character varying",
+				"ALTER TABLE public.users ALTER COLUMN email SET NOT NULL",
+				"ALTER TABLE public.users ADD COLUMN legacy text",
+				"CREATE UNIQUE INDEX users_email_idx ON public.users USING btree (email)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, unsupported := Plan(tt.from, tt.to)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Plan =\n%q\nwant:\n%q", got, tt.want)
+			}
+			if len(unsupported) > 0 {
+				t.Errorf("unsupported changes:\n%s", describeChanges(unsupported))
+			}
+		})
+	}
+}
+
+func TestPlanSequences(t *testing.T) {
+	options := "AS bigint INCREMENT BY 1 MINVALUE 1 MAXVALUE 9223372036854775807 START WITH 1 CACHE 1 NO CYCLE"
+	seq := Object{Kind: KindSequence, Schema: "public", Table: "users", Name: "users_id_seq",
+		Definition: options + " OWNED BY public.users.id"}
+	serialID := usersID
+	serialID.Definition = "bigint NOT NULL DEFAULT nextval('users_id_seq'::regclass)"
+
+	// The sequence is created before the table using it, and owned after
+	got, _ := Plan(schemaOf(), schemaOf(seq, usersTable, serialID))
+	want := []string{
+		"CREATE SEQUENCE public.users_id_seq " + options,
+		"CREATE TABLE public.users (\n    id bigint NOT NULL DEFAULT nextval('users_id_seq'::regclass)\n)",
+		"ALTER SEQUENCE public.users_id_seq OWNED BY public.users.id",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Plan =\n%q\nwant:\n%q", got, want)
+	}
+
+	cycling := seq
+	cycling.Definition = "AS bigint INCREMENT BY 10 MINVALUE 1 MAXVALUE 9223372036854775807 START WITH 1 CACHE 1 CYCLE"
+	got, _ = Plan(schemaOf(seq, usersTable, serialID), schemaOf(cycling, usersTable, serialID))
+	want = []string{
+		"ALTER SEQUENCE public.users_id_seq " + cycling.Definition,
+		"ALTER SEQUENCE public.users_id_seq OWNED BY NONE",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Plan =\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestPlanUnsupported(t *testing.T) {
+	status := Object{Kind: KindType, Schema: "public", Name: "status", Definition: "ENUM ('active', 'inactive')"}
+	reordered := status
+	reordered.Definition = "ENUM ('inactive', 'active')"
+	rule := Object{Kind: KindOther, Schema: "public", Name: "rule users_log on public.users", Definition: "CREATE RULE ..."}
+	rls := Object{Kind: KindOther, Schema: "public", Name: "row level security on public.users", Definition: "ENABLE"}
+
+	statements, unsupported := Plan(schemaOf(status, rule, usersTable), schemaOf(reordered, rls, usersTable))
+	if len(statements) != 0 {
+		t.Errorf("statements = %q, want none", statements)
+	}
+	var got []string
+	for _, c := range unsupported {
+		got = append(got, string(c.Type)+" "+c.Kind+" "+c.Name)
+	}
+	want := []string{
+		"extra other rule users_log on public.users",
+		"modified type public.status",
+		"missing other row level security on public.users",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unsupported = %q, want %q", got, want)
+	}
+}
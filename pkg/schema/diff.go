@@ -0,0 +1,75 @@
+package schema
+
+import (
+	"sort"
+	"strings"
+)
+
+// ChangeType describes how an object differs between two schemas
+type ChangeType string
+
+const (
+	Missing  ChangeType = "missing"  // In the expected schema only
+	Extra    ChangeType = "extra"    // In the actual schema only
+	Modified ChangeType = "modified" // In both, with different definitions
+)
+
+// Change is a difference between an expected and an actual schema
+type Change struct {
+	Type     ChangeType `json:"type"`
+	Kind     string     `json:"kind"`
+	Name     string     `json:"name"`
+	Expected *Object    `json:"expected,omitempty"`
+	Actual   *Object    `json:"actual,omitempty"`
+}
+
+// Diff compares two schemas object by object. Definitions are compared with
+// whitespace normalized, so formatting differences are not reported.
+// Objects of a missing or extra table are implied by the table's change and
+// not listed separately. Changes are ordered by kind (types, tables, columns,
+// ...) and name.
+func Diff(expected, actual Schema) []Change {
+	var changes []Change
+	for key, want := range expected {
+		got, ok := actual[key]
+		switch {
+		case !ok && want.Table != "" && !actual.hasTable(want.Schema, want.Table):
+			// Reported with the table
+		case !ok:
+			changes = append(changes, Change{Type: Missing, Kind: want.Kind, Name: want.QualifiedName(), Expected: &want})
+		case normalize(want.Definition) != normalize(got.Definition):
+			changes = append(changes, Change{Type: Modified, Kind: want.Kind, Name: want.QualifiedName(), Expected: &want, Actual: &got})
+		}
+	}
+	for key, got := range actual {
+		if got.Table != "" && !expected.hasTable(got.Schema, got.Table) {
+			continue
+		}
+		if _, ok := expected[key]; !ok {
+			changes = append(changes, Change{Type: Extra, Kind: got.Kind, Name: got.QualifiedName(), Actual: &got})
+		}
+	}
+
+	rank := make(map[string]int, len(kindOrder))
+	for i, kind := range kindOrder {
+		rank[kind] = i
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Kind != changes[j].Kind {
+			return rank[changes[i].Kind] < rank[changes[j].Kind]
+		}
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// hasTable reports whether the schema has a table or view with the given name
+func (s Schema) hasTable(schema, table string) bool {
+	_, isTable := s[Object{Kind: KindTable, Schema: schema, Name: table}.key()]
+	_, isView := s[Object{Kind: KindView, Schema: schema, Name: table}.key()]
+	return isTable || isView
+}
+
+func normalize(definition string) string {
+	return strings.Join(strings.Fields(definition), " ")
+}
@@ -0,0 +1,79 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+)
+
+func schemaOf(objects ...Object) Schema {
+	s := make(Schema)
+	for _, o := range objects {
+		s[o.key()] = o
+	}
+	return s
+}
+
+var (
+	usersTable   = Object{Kind: KindTable, Schema: "public", Name: "users"}
+	usersID      = Object{Kind: KindColumn, Schema: "public", Table: "users", Name: "id", Definition: "bigint NOT NULL", Position: 1}
+	usersEmail   = Object{Kind: KindColumn, Schema: "public", Table: "users", Name: "email", Definition: "text", Position: 2}
+	usersPkey    = Object{Kind: KindConstraint, Schema: "public", Table: "users", Name: "users_pkey", Definition: "PRIMARY KEY (id)"}
+	usersEmailIx = Object{Kind: KindIndex, Schema: "public", Table: "users", Name: "users_email_idx",
+		Definition: "CREATE INDEX users_email_idx ON public.users USING btree (email)"}
+)
+
+func TestDiff(t *testing.T) {
+	posts := Object{Kind: KindTable, Schema: "public", Name: "posts"}
+	postsTitle := Object{Kind: KindColumn, Schema: "public", Table: "posts", Name: "title", Definition: "text", Position: 1}
+	status := Object{Kind: KindType, Schema: "public", Name: "status", Definition: "ENUM ('active', 'inactive')"}
+	emailNotNull := usersEmail
+	emailNotNull.Definition = "text NOT NULL"
+	reformatted := usersEmailIx
+	reformatted.Definition = "CREATE INDEX users_email_idx\n    ON public.users USING btree (email)"
+
+	expected := schemaOf(status, usersTable, usersID, emailNotNull, usersPkey, usersEmailIx, posts, postsTitle)
+	actual := schemaOf(usersTable, usersID, usersEmail, reformatted)
+
+	got := Diff(expected, actual)
+	want := []Change{
+		{Type: Missing, Kind: KindType, Name: "public.status", Expected: &status},
+		{Type: Missing, Kind: KindTable, Name: "public.posts", Expected: &posts},
+		{Type: Modified, Kind: KindColumn, Name: "public.users.email", Expected: &emailNotNull, Actual: &usersEmail},
+		{Type: Missing, Kind: KindConstraint, Name: "public.users.users_pkey", Expected: &usersPkey},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff =\n%s\nwant:\n%s", describeChanges(got), describeChanges(want))
+	}
+
+	// Reversed, missing objects are extra
+	got = Diff(actual, expected)
+	if len(got) != 4 || got[0].Type != Extra || got[2].Type != Modified {
+		t.Errorf("reversed Diff =\n%s", describeChanges(got))
+	}
+
+	if got := Diff(expected, expected); len(got) != 0 {
+		t.Errorf("Diff of identical schemas =\n%s", describeChanges(got))
+	}
+}
+
+func TestDiffSequenceOwner(t *testing.T) {
+	seq := Object{Kind: KindSequence, Schema: "public", Name: "users_id_seq",
+		Definition: "AS bigint INCREMENT BY 1 MINVALUE 1 MAXVALUE 9223372036854775807 START WITH 1 CACHE 1 NO CYCLE"}
+	owned := seq
+	owned.Table = "users"
+	owned.Definition += " OWNED BY public.users.id"
+
+	// Owning a sequence is a modification, not a different sequence
+	got := Diff(schemaOf(usersTable, owned), schemaOf(usersTable, seq))
+	if len(got) != 1 || got[0].Type != Modified || got[0].Name != "public.users_id_seq" {
+		t.Errorf("Diff =\n%s", describeChanges(got))
+	}
+}
+
+func describeChanges(changes []Change) string {
+	var s string
+	for _, c := range changes {
+		s += string(c.Type) + " " + c.Kind + " " + c.Name + "\n"
+	}
+	return s
+}
@@ -0,0 +1,305 @@
+package schema
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/tmwinc/seedup/pkg/executor"
+)
+
+// Identifiers as pg_dump writes them: quoted only when necessary
+const (
+	identPattern = `(?:"(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_$]*)`
+	qnamePattern = `(` + identPattern + `(?:\.` + identPattern + `)?)`
+)
+
+var (
+	skippedStatementRe = regexp.MustCompile(`(?is)^(?:SET\s|SELECT\s+pg_catalog\.set_config|SELECT\s+pg_catalog\.setval|COMMENT\s+ON\s|GRANT\s|REVOKE\s|ALTER\s+DEFAULT\s+PRIVILEGES\s|ALTER\s.*\sOWNER\s+TO\s)`)
+
+	createExtensionRe = regexp.MustCompile(`(?is)^CREATE\s+EXTENSION\s+(?:IF\s+NOT\s+EXISTS\s+)?(` + identPattern + `)(?:.*\sSCHEMA\s+(` + identPattern + `))?`)
+	createTypeRe      = regexp.MustCompile(`(?is)^CREATE\s+TYPE\s+` + qnamePattern + `\s+AS\s`)
+	createDomainRe    = regexp.MustCompile(`(?is)^CREATE\s+DOMAIN\s+` + qnamePattern + `\s+(.*)$`)
+	createSequenceRe  = regexp.MustCompile(`(?is)^CREATE\s+SEQUENCE\s+` + qnamePattern + `\s*(.*)$`)
+	sequenceOwnerRe   = regexp.MustCompile(`(?is)^ALTER\s+SEQUENCE\s+` + qnamePattern + `\s+OWNED\s+BY\s+(` + identPattern + `(?:\.` + identPattern + `)*)$`)
+	createTableRe     = regexp.MustCompile(`(?is)^CREATE\s+(?:UNLOGGED\s+)?TABLE\s+` + qnamePattern + `\s*(.*)$`)
+	columnDefaultRe   = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(?:ONLY\s+)?` + qnamePattern + `\s+ALTER\s+COLUMN\s+(` + identPattern + `)\s+SET\s+DEFAULT\s+(.*)$`)
+	columnIdentityRe  = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(?:ONLY\s+)?` + qnamePattern + `\s+ALTER\s+COLUMN\s+(` + identPattern + `)\s+ADD\s+(GENERATED\s+(?:ALWAYS|BY\s+DEFAULT)\s+AS\s+IDENTITY)`)
+	addConstraintRe   = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(?:ONLY\s+)?` + qnamePattern + `\s+ADD\s+CONSTRAINT\s+(` + identPattern + `)\s+(.*)$`)
+	rowSecurityRe     = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(?:ONLY\s+)?` + qnamePattern + `\s+(ENABLE|FORCE)\s+ROW\s+LEVEL\s+SECURITY$`)
+	createIndexRe     = regexp.MustCompile(`(?is)^CREATE\s+(?:UNIQUE\s+)?INDEX\s+(` + identPattern + `)\s+ON\s+(?:ONLY\s+)?` + qnamePattern + `\s`)
+	createFunctionRe  = regexp.MustCompile(`(?is)^CREATE\s+(?:OR\s+REPLACE\s+)?(?:FUNCTION|PROCEDURE)\s+` + qnamePattern + `\(`)
+	createViewRe      = regexp.MustCompile(`(?is)^CREATE\s+(?:OR\s+REPLACE\s+)?(?:MATERIALIZED\s+)?VIEW\s+` + qnamePattern + `[\s(]`)
+	createTriggerRe   = regexp.MustCompile(`(?is)^CREATE\s+(?:OR\s+REPLACE\s+)?(?:CONSTRAINT\s+)?TRIGGER\s+(` + identPattern + `)\s.*?\sON\s+` + qnamePattern + `\s`)
+	createPolicyRe    = regexp.MustCompile(`(?is)^CREATE\s+POLICY\s+(` + identPattern + `)\s+ON\s+` + qnamePattern + `(?:\s|$)`)
+	// Keywords are matched case-sensitively: pg_dump writes them in upper
+	// case and quotes identifiers that are not lower case
+	otherStatementRe  = regexp.MustCompile(`(?s)^(?:CREATE|ALTER)\s+(?:OR\s+REPLACE\s+)?((?:[A-Z]+\s+)+)` + qnamePattern)
+	tableConstraintRe = regexp.MustCompile(`(?is)^CONSTRAINT\s+(` + identPattern + `)\s+(.*)$`)
+	columnRe          = regexp.MustCompile(`(?is)^(` + identPattern + `)\s+(.*)$`)
+)
+
+// ParseDump reads the schema of a pg_dump --schema-only script, so dumps
+// can be compared object by object with Diff. Objects are described by the
+// statements pg_dump wrote for them: columns by their type and modifiers
+// (with defaults and identity folded in), constraints by their definition
+// and other objects by their CREATE statement. Statements seedup does not
+// compare (SET, comments, ownership and privileges) are skipped; those of
+// any other kind become objects of KindOther.
+func ParseDump(dump string) Schema {
+	p := &dumpParser{schema: make(Schema)}
+	for _, cmd := range executor.SplitScript(dump) {
+		if !cmd.Meta {
+			p.statement(strings.TrimSuffix(stripComments(cmd.Text), ";"))
+		}
+	}
+	return p.schema
+}
+
+type dumpParser struct {
+	schema Schema
+}
+
+func (p *dumpParser) add(o Object) {
+	o.Definition = strings.TrimSpace(o.Definition)
+	p.schema[o.key()] = o
+}
+
+func (p *dumpParser) statement(stmt string) {
+	stmt = strings.TrimSpace(stmt)
+	if stmt == "" || skippedStatementRe.MatchString(stmt) {
+		return
+	}
+
+	if m := createExtensionRe.FindStringSubmatch(stmt); m != nil {
+		p.add(Object{Kind: KindExtension, Schema: unquote(m[2]), Name: unquote(m[1]), Definition: stmt})
+	} else if m := createTypeRe.FindStringSubmatch(stmt); m != nil {
+		schema, name := splitName(m[1])
+		p.add(Object{Kind: KindType, Schema: schema, Name: name, Definition: stmt})
+	} else if m := createDomainRe.FindStringSubmatch(stmt); m != nil {
+		schema, name := splitName(m[1])
+		p.add(Object{Kind: KindDomain, Schema: schema, Name: name, Definition: m[2]})
+	} else if m := createSequenceRe.FindStringSubmatch(stmt); m != nil {
+		schema, name := splitName(m[1])
+		p.add(Object{Kind: KindSequence, Schema: schema, Name: name, Definition: m[2]})
+	} else if m := sequenceOwnerRe.FindStringSubmatch(stmt); m != nil {
+		p.sequenceOwner(m[1], m[2])
+	} else if m := createTableRe.FindStringSubmatch(stmt); m != nil {
+		p.table(m[1], m[2])
+	} else if m := columnDefaultRe.FindStringSubmatch(stmt); m != nil {
+		p.extendColumn(m[1], m[2], "DEFAULT "+m[3])
+	} else if m := columnIdentityRe.FindStringSubmatch(stmt); m != nil {
+		p.extendColumn(m[1], m[2], m[3])
+	} else if m := addConstraintRe.FindStringSubmatch(stmt); m != nil {
+		schema, table := splitName(m[1])
+		p.add(Object{Kind: KindConstraint, Schema: schema, Table: table, Name: unquote(m[2]), Definition: m[3]})
+	} else if m := rowSecurityRe.FindStringSubmatch(stmt); m != nil {
+		p.rowSecurity(m[1], strings.ToUpper(m[2]))
+	} else if m := createIndexRe.FindStringSubmatch(stmt); m != nil {
+		schema, table := splitName(m[2])
+		p.add(Object{Kind: KindIndex, Schema: schema, Table: table, Name: unquote(m[1]), Definition: stmt})
+	} else if m := createFunctionRe.FindStringSubmatch(stmt); m != nil {
+		schema, name := splitName(m[1])
+		args, _ := parenthesized(stmt[len(m[0])-1:])
+		p.add(Object{Kind: KindFunction, Schema: schema, Name: name + "(" + normalize(args) + ")", Definition: stmt})
+	} else if m := createViewRe.FindStringSubmatch(stmt); m != nil {
+		schema, name := splitName(m[1])
+		p.add(Object{Kind: KindView, Schema: schema, Name: name, Definition: stmt})
+	} else if m := createTriggerRe.FindStringSubmatch(stmt); m != nil {
+		schema, table := splitName(m[2])
+		p.add(Object{Kind: KindTrigger, Schema: schema, Table: table, Name: unquote(m[1]), Definition: stmt})
+	} else if m := createPolicyRe.FindStringSubmatch(stmt); m != nil {
+		schema, table := splitName(m[2])
+		p.add(Object{Kind: KindPolicy, Schema: schema, Table: table, Name: unquote(m[1]), Definition: stmt})
+	} else {
+		p.other(stmt)
+	}
+}
+
+// table adds a table with its columns and the constraints pg_dump writes
+// inline, such as CHECK constraints
+func (p *dumpParser) table(qname, rest string) {
+	schema, name := splitName(qname)
+	table := Object{Kind: KindTable, Schema: schema, Name: name, Definition: rest}
+
+	body, ok := parenthesized(rest)
+	if !ok {
+		// A partition or typed table without a column list
+		p.add(table)
+		return
+	}
+	table.Definition = strings.TrimSpace(rest[len(body)+2:])
+	p.add(table)
+
+	position := 0
+	for _, element := range splitTopLevel(body) {
+		if m := tableConstraintRe.FindStringSubmatch(element); m != nil {
+			p.add(Object{Kind: KindConstraint, Schema: schema, Table: name, Name: unquote(m[1]), Definition: m[2]})
+		} else if m := columnRe.FindStringSubmatch(element); m != nil {
+			position++
+			p.add(Object{Kind: KindColumn, Schema: schema, Table: name, Name: unquote(m[1]), Definition: m[2], Position: position})
+		}
+	}
+}
+
+// extendColumn appends a default or identity pg_dump sets after creating the table
+func (p *dumpParser) extendColumn(qname, column, modifier string) {
+	schema, table := splitName(qname)
+	key := Object{Kind: KindColumn, Schema: schema, Table: table, Name: unquote(column)}.key()
+	if col, ok := p.schema[key]; ok {
+		col.Definition += " " + modifier
+		p.add(col)
+	}
+}
+
+// sequenceOwner attaches a sequence to the column owning it; it belongs to
+// the column's table when in the same schema
+func (p *dumpParser) sequenceOwner(qname, owner string) {
+	schema, name := splitName(qname)
+	key := Object{Kind: KindSequence, Schema: schema, Name: name}.key()
+	seq, ok := p.schema[key]
+	if !ok {
+		return
+	}
+	seq.Definition += " OWNED BY " + owner
+	if parts := splitQualified(owner); len(parts) == 3 && parts[0] == schema {
+		seq.Table = parts[1]
+	}
+	p.add(seq)
+}
+
+func (p *dumpParser) rowSecurity(qname, mode string) {
+	schema, table := splitName(qname)
+	o := Object{Kind: KindOther, Schema: schema, Table: table, Name: "row level security on " + schema + "." + table, Definition: "ENABLE"}
+	if existing, ok := p.schema[o.key()]; ok {
+		o.Definition = existing.Definition
+	}
+	if mode == "FORCE" {
+		o.Definition += ", FORCE"
+	}
+	p.add(o)
+}
+
+// other adds a statement of a kind not compared in detail, named by the
+// kind and name of the object it creates or alters. Several statements
+// about one object, such as partitions attached to a table, form one object.
+func (p *dumpParser) other(stmt string) {
+	name := normalize(stmt)
+	schema := ""
+	if m := otherStatementRe.FindStringSubmatch(stmt); m != nil {
+		schema, _ = splitName(m[2])
+		name = strings.ToLower(normalize(m[1])) + " " + m[2]
+	}
+
+	o := Object{Kind: KindOther, Schema: schema, Name: name, Definition: stmt}
+	if existing, ok := p.schema[o.key()]; ok {
+		o.Definition = existing.Definition + "\n" + stmt
+	}
+	p.add(o)
+}
+
+// stripComments removes the comment lines pg_dump writes before each statement
+func stripComments(text string) string {
+	lines := strings.Split(text, "\n")
+	for len(lines) > 0 && (strings.HasPrefix(strings.TrimSpace(lines[0]), "--") || strings.TrimSpace(lines[0]) == "") {
+		lines = lines[1:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parenthesized returns the text between s's first opening parenthesis,
+// which must start s after leading whitespace, and its matching closing one
+func parenthesized(s string) (string, bool) {
+	start := strings.IndexByte(s, '(')
+	if start < 0 || strings.TrimSpace(s[:start]) != "" {
+		return "", false
+	}
+	depth := 0
+	inQuote := byte(0)
+	for i := start; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inQuote != 0:
+			if c == inQuote {
+				inQuote = 0
+			}
+		case c == '\'' || c == '"':
+			inQuote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return s[start+1 : i], true
+			}
+		}
+	}
+	return "", false
+}
+
+// splitTopLevel splits s on commas outside parentheses and quotes
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, last := 0, 0
+	inQuote := byte(0)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inQuote != 0:
+			if c == inQuote {
+				inQuote = 0
+			}
+		case c == '\'' || c == '"':
+			inQuote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(s[last:i]))
+			last = i + 1
+		}
+	}
+	if rest := strings.TrimSpace(s[last:]); rest != "" {
+		parts = append(parts, rest)
+	}
+	return parts
+}
+
+// splitName splits a possibly schema-qualified name, defaulting to public
+func splitName(qname string) (schema, name string) {
+	parts := splitQualified(qname)
+	if len(parts) == 1 {
+		return "public", parts[0]
+	}
+	return parts[0], parts[len(parts)-1]
+}
+
+// splitQualified splits a dotted name into its unquoted parts
+func splitQualified(qname string) []string {
+	var parts []string
+	var part strings.Builder
+	inQuote := false
+	for i := 0; i < len(qname); i++ {
+		c := qname[i]
+		switch {
+		case c == '"' && inQuote && i+1 < len(qname) && qname[i+1] == '"':
+			part.WriteByte('"')
+			i++
+		case c == '"':
+			inQuote = !inQuote
+		case c == '.' && !inQuote:
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(c)
+		}
+	}
+	return append(parts, part.String())
+}
+
+func unquote(ident string) string {
+	if strings.HasPrefix(ident, `"`) && strings.HasSuffix(ident, `"`) && len(ident) >= 2 {
+		return strings.ReplaceAll(ident[1:len(ident)-1], `""`, `"`)
+	}
+	return ident
+}
@@ -0,0 +1,234 @@
+package schema
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+const testDump = `--
+-- PostgreSQL database dump
+--
+
+SET statement_timeout = 0;
+SET client_encoding = 'UTF8';
+SELECT pg_catalog.set_config('search_path', '', false);
+
+--
+-- Name: audit; Type: SCHEMA; Schema: -; Owner: -
+--
+
+CREATE SCHEMA audit;
+
+--
+-- Name: pgcrypto; Type: EXTENSION; Schema: -; Owner: -
+--
+
+CREATE EXTENSION IF NOT EXISTS pgcrypto WITH SCHEMA public;
+
+--
+-- Name: EXTENSION pgcrypto; Type: COMMENT; Schema: -; Owner: -
+--
+
+COMMENT ON EXTENSION pgcrypto IS 'cryptographic functions';
+
+--
+-- Name: status; Type: TYPE; Schema: public; Owner: -
+--
+
+CREATE TYPE public.status AS ENUM (
+    'active',
+    'inactive'
+);
+
+--
+-- Name: touch(); Type: FUNCTION; Schema: public; Owner: -
+--
+
+CREATE FUNCTION public.touch() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+    NEW.updated_at := now();
+    RETURN NEW;
+END;
+$$;
+
+--
+-- Name: users; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE public.users (
+    id integer NOT NULL,
+    "Email" text NOT NULL,
+    status public.status DEFAULT 'active'::public.status,
+    updated_at timestamp with time zone,
+    CONSTRAINT users_email_check CHECK (("Email" <> ''::text))
+);
+
+--
+-- Name: users_id_seq; Type: SEQUENCE; Schema: public; Owner: -
+--
+
+CREATE SEQUENCE public.users_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+--
+-- Name: users_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: -
+--
+
+ALTER SEQUENCE public.users_id_seq OWNED BY public.users.id;
+
+--
+-- Name: events; Type: TABLE; Schema: audit; Owner: -
+--
+
+CREATE TABLE audit.events (
+    id bigint NOT NULL,
+    at timestamp with time zone DEFAULT now()
+)
+PARTITION BY RANGE (at);
+
+--
+-- Name: events id; Type: DEFAULT; Schema: audit; Owner: -
+--
+
+ALTER TABLE audit.events ALTER COLUMN id ADD GENERATED ALWAYS AS IDENTITY (
+    SEQUENCE NAME audit.events_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1
+);
+
+--
+-- Name: active_users; Type: VIEW; Schema: public; Owner: -
+--
+
+CREATE VIEW public.active_users AS
+ SELECT id
+   FROM public.users
+  WHERE (status = 'active'::public.status);
+
+--
+-- Name: users id; Type: DEFAULT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY public.users ALTER COLUMN id SET DEFAULT nextval('public.users_id_seq'::regclass);
+
+--
+-- Name: users users_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY public.users
+    ADD CONSTRAINT users_pkey PRIMARY KEY (id);
+
+--
+-- Name: users_status_idx; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX users_status_idx ON public.users USING btree (status);
+
+--
+-- Name: users users_touch; Type: TRIGGER; Schema: public; Owner: -
+--
+
+CREATE TRIGGER users_touch BEFORE UPDATE ON public.users FOR EACH ROW EXECUTE FUNCTION public.touch();
+
+--
+-- Name: users; Type: ROW SECURITY; Schema: public; Owner: -
+--
+
+ALTER TABLE public.users ENABLE ROW LEVEL SECURITY;
+
+--
+-- Name: users own_rows; Type: POLICY; Schema: public; Owner: -
+--
+
+CREATE POLICY own_rows ON public.users USING ((id = 1));
+
+--
+-- PostgreSQL database dump complete
+--
+`
+
+func TestParseDump(t *testing.T) {
+	got := ParseDump(testDump)
+
+	want := []string{
+		"column audit.events.at: timestamp with time zone DEFAULT now()",
+		"column audit.events.id: bigint NOT NULL GENERATED ALWAYS AS IDENTITY",
+		"column public.users.Email: text NOT NULL",
+		"column public.users.id: integer NOT NULL DEFAULT nextval('public.users_id_seq'::regclass)",
+		"column public.users.status: public.status DEFAULT 'active'::public.status",
+		"column public.users.updated_at: timestamp with time zone",
+		"constraint public.users.users_email_check: CHECK ((\"Email\" <> ''::text))",
+		"constraint public.users.users_pkey: PRIMARY KEY (id)",
+		"extension public.pgcrypto: CREATE EXTENSION IF NOT EXISTS pgcrypto WITH SCHEMA public",
+		"function public.touch(): CREATE FUNCTION public.touch() RETURNS trigger LANGUAGE plpgsql AS $$ BEGIN NEW.updated_at := now(); RETURN NEW; END; $$",
+		"index public.users_status_idx: CREATE INDEX users_status_idx ON public.users USING btree (status)",
+		"other row level security on public.users: ENABLE",
+		"other schema audit: CREATE SCHEMA audit",
+		"policy public.users.own_rows: CREATE POLICY own_rows ON public.users USING ((id = 1))",
+		"sequence public.users_id_seq: AS integer START WITH 1 INCREMENT BY 1 NO MINVALUE NO MAXVALUE CACHE 1 OWNED BY public.users.id",
+		"table audit.events: PARTITION BY RANGE (at)",
+		"table public.users: ",
+		"trigger public.users.users_touch: CREATE TRIGGER users_touch BEFORE UPDATE ON public.users FOR EACH ROW EXECUTE FUNCTION public.touch()",
+		"type public.status: CREATE TYPE public.status AS ENUM ( 'active', 'inactive' )",
+		"view public.active_users: CREATE VIEW public.active_users AS SELECT id FROM public.users WHERE (status = 'active'::public.status)",
+	}
+	if objects := describeObjects(got); !reflect.DeepEqual(objects, want) {
+		t.Errorf("ParseDump =\n%s\nwant:\n%s", join(objects), join(want))
+	}
+
+	if seq := got[Object{Kind: KindSequence, Schema: "public", Name: "users_id_seq"}.key()]; seq.Table != "users" {
+		t.Errorf("sequence table = %q, want its owning table", seq.Table)
+	}
+	if col := got[Object{Kind: KindColumn, Schema: "public", Table: "users", Name: "updated_at"}.key()]; col.Position != 4 {
+		t.Errorf("updated_at position = %d, want 4", col.Position)
+	}
+}
+
+func TestParseDumpDiff(t *testing.T) {
+	// A hotfix applied by hand: an extra index and a changed column
+	hotfixed := testDump + `
+CREATE INDEX users_email_idx ON public.users USING btree ("Email");
+`
+	expected := ParseDump(testDump)
+	actual := ParseDump(hotfixed)
+	col := Object{Kind: KindColumn, Schema: "public", Table: "users", Name: "updated_at"}.key()
+	changed := actual[col]
+	changed.Definition = "timestamp with time zone NOT NULL"
+	actual[col] = changed
+
+	got := describeChanges(Diff(expected, actual))
+	want := "modified column public.users.updated_at\nextra index public.users_email_idx\n"
+	if got != want {
+		t.Errorf("Diff =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// describeObjects returns "kind name: definition" for each object, sorted,
+// with whitespace normalized
+func describeObjects(s Schema) []string {
+	var objects []string
+	for _, o := range s {
+		objects = append(objects, o.Kind+" "+o.QualifiedName()+": "+normalize(o.Definition))
+	}
+	sort.Strings(objects)
+	return objects
+}
+
+func join(lines []string) string {
+	var s string
+	for _, line := range lines {
+		s += "  " + line + "\n"
+	}
+	return s
+}
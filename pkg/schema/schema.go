@@ -0,0 +1,289 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tmwinc/seedup/pkg/executor"
+)
+
+// Object kinds, in the order changes are reported
+const (
+	KindExtension  = "extension"
+	KindType       = "type" // Enum and composite types
+	KindDomain     = "domain"
+	KindSequence   = "sequence"
+	KindTable      = "table"
+	KindColumn     = "column"
+	KindConstraint = "constraint"
+	KindIndex      = "index"
+	KindFunction   = "function"
+	KindView       = "view"
+	KindTrigger    = "trigger"
+	KindPolicy     = "policy"
+
+	// KindOther covers the user objects of any other kind, such as
+	// aggregates, range types, rules and row level security settings. They
+	// are compared by name and definition, but Plan cannot generate DDL for them.
+	KindOther = "other"
+)
+
+var kindOrder = []string{
+	KindExtension, KindType, KindDomain, KindSequence, KindTable, KindColumn, KindConstraint,
+	KindIndex, KindFunction, KindView, KindTrigger, KindPolicy, KindOther,
+}
+
+// Object is a database object with its definition as reported by PostgreSQL
+type Object struct {
+	Kind       string `json:"kind"`
+	Schema     string `json:"schema"`
+	Table      string `json:"table,omitempty"` // Owning table of columns, constraints, indexes, triggers, policies and sequences
+	Name       string `json:"name"`
+	Definition string `json:"definition"`
+	Position   int    `json:"-"` // Column number, used to recreate tables in order
+}
+
+// QualifiedName returns the object's name qualified by schema and, for
+// objects belonging to a table, by table
+func (o Object) QualifiedName() string {
+	switch {
+	case o.Kind == KindOther:
+		return o.Name
+	case o.Table != "" && o.Kind != KindIndex && o.Kind != KindSequence:
+		return o.Schema + "." + o.Table + "." + o.Name
+	}
+	return o.Schema + "." + o.Name
+}
+
+func (o Object) key() string {
+	if o.Kind == KindSequence {
+		// A sequence keeps its identity when its owning column changes
+		return o.Kind + " " + o.Schema + ".." + o.Name
+	}
+	return o.Kind + " " + o.Schema + "." + o.Table + "." + o.Name
+}
+
+// Schema is the set of objects in a database
+type Schema map[string]Object
+
+// Objects returns the objects of the given kind sorted by name
+func (s Schema) Objects(kind string) []Object {
+	var objects []Object
+	for _, o := range s {
+		if o.Kind == kind {
+			objects = append(objects, o)
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].Schema+"."+objects[i].Table != objects[j].Schema+"."+objects[j].Table {
+			return objects[i].Schema+"."+objects[i].Table < objects[j].Schema+"."+objects[j].Table
+		}
+		if objects[i].Position != objects[j].Position {
+			return objects[i].Position < objects[j].Position
+		}
+		return objects[i].Name < objects[j].Name
+	})
+	return objects
+}
+
+// Inspector reads database schemas from the system catalogs
+type Inspector struct {
+	exec executor.Executor
+}
+
+// New creates a new Inspector with the given executor
+func New(exec executor.Executor) *Inspector {
+	return &Inspector{exec: exec}
+}
+
+// userObjects restricts a catalog query to user schemas and objects not owned by an extension
+const userObjects = `n.nspname NOT IN ('pg_catalog', 'information_schema')
+	AND n.nspname NOT LIKE 'pg_toast%' AND n.nspname NOT LIKE 'pg_temp%'`
+
+func notFromExtension(oid string) string {
+	return fmt.Sprintf("NOT EXISTS (SELECT 1 FROM pg_depend dep WHERE dep.objid = %s AND dep.deptype = 'e')", oid)
+}
+
+// catalogQueries return schema, table, name, definition and position for each kind
+var catalogQueries = map[string]string{
+	KindExtension: `SELECT n.nspname, '', x.extname, 'VERSION ' || quote_literal(x.extversion), 0
+	FROM pg_extension x JOIN pg_namespace n ON n.oid = x.extnamespace
+	WHERE ` + userObjects,
+
+	KindType: `SELECT n.nspname, '', t.typname,
+		'ENUM (' || string_agg(quote_literal(e.enumlabel), ', ' ORDER BY e.enumsortorder) || ')', 0
+	FROM pg_type t JOIN pg_namespace n ON n.oid = t.typnamespace JOIN pg_enum e ON e.enumtypid = t.oid
+	WHERE ` + userObjects + ` AND ` + notFromExtension("t.oid") + `
+	GROUP BY n.nspname, t.typname
+	UNION ALL
+	SELECT n.nspname, '', t.typname,
+		'(' || string_agg(quote_ident(a.attname) || ' ' || format_type(a.atttypid, a.atttypmod), ', ' ORDER BY a.attnum) || ')', 0
+	FROM pg_type t JOIN pg_namespace n ON n.oid = t.typnamespace
+	JOIN pg_class c ON c.oid = t.typrelid AND c.relkind = 'c'
+	JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+	WHERE ` + userObjects + ` AND ` + notFromExtension("t.oid") + `
+	GROUP BY n.nspname, t.typname`,
+
+	KindDomain: `SELECT n.nspname, '', t.typname,
+		format_type(t.typbasetype, t.typtypmod)
+		|| CASE WHEN t.typnotnull THEN ' NOT NULL' ELSE '' END
+		|| COALESCE(' DEFAULT ' || t.typdefault, '')
+		|| COALESCE((SELECT string_agg(' CONSTRAINT ' || quote_ident(k.conname) || ' ' || pg_get_constraintdef(k.oid), '' ORDER BY k.conname)
+			FROM pg_constraint k WHERE k.contypid = t.oid AND k.contype = 'c'), ''), 0
+	FROM pg_type t JOIN pg_namespace n ON n.oid = t.typnamespace
+	WHERE t.typtype = 'd' AND ` + userObjects + ` AND ` + notFromExtension("t.oid"),
+
+	// Identity sequences are part of their column. A sequence owned by a
+	// column (serial) belongs to the column's table when in the same schema.
+	KindSequence: `SELECT n.nspname, COALESCE(o.relname, ''), c.relname,
+		'AS ' || format_type(s.seqtypid, NULL) || ' INCREMENT BY ' || s.seqincrement
+		|| ' MINVALUE ' || s.seqmin || ' MAXVALUE ' || s.seqmax || ' START WITH ' || s.seqstart
+		|| ' CACHE ' || s.seqcache || CASE WHEN s.seqcycle THEN ' CYCLE' ELSE ' NO CYCLE' END
+		|| COALESCE(' OWNED BY ' || o.owner, ''), 0
+	FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace JOIN pg_sequence s ON s.seqrelid = c.oid
+	LEFT JOIN LATERAL (
+		SELECT CASE WHEN tc.relnamespace = c.relnamespace THEN tc.relname END AS relname,
+			quote_ident(tn.nspname) || '.' || quote_ident(tc.relname) || '.' || quote_ident(a.attname) AS owner
+		FROM pg_depend d JOIN pg_class tc ON tc.oid = d.refobjid JOIN pg_namespace tn ON tn.oid = tc.relnamespace
+		JOIN pg_attribute a ON a.attrelid = tc.oid AND a.attnum = d.refobjsubid
+		WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.refclassid = 'pg_class'::regclass AND d.deptype = 'a'
+		LIMIT 1
+	) o ON true
+	WHERE c.relkind = 'S' AND ` + userObjects + ` AND ` + notFromExtension("c.oid") + `
+		AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype = 'i')`,
+
+	KindTable: `SELECT n.nspname, '', c.relname,
+		CASE WHEN c.relkind = 'p' THEN 'PARTITION BY ' || pg_get_partkeydef(c.oid) ELSE '' END, 0
+	FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE c.relkind IN ('r', 'p') AND NOT c.relispartition AND ` + userObjects + ` AND ` + notFromExtension("c.oid"),
+
+	KindColumn: `SELECT n.nspname, c.relname, a.attname,
+		format_type(a.atttypid, a.atttypmod)
+		|| CASE WHEN a.attnotnull THEN ' NOT NULL' ELSE '' END
+		|| CASE WHEN a.attgenerated = 's' THEN ' GENERATED ALWAYS AS (' || pg_get_expr(d.adbin, d.adrelid) || ') STORED'
+			WHEN d.adbin IS NOT NULL THEN ' DEFAULT ' || pg_get_expr(d.adbin, d.adrelid) ELSE '' END
+		|| CASE a.attidentity WHEN 'a' THEN ' GENERATED ALWAYS AS IDENTITY'
+			WHEN 'd' THEN ' GENERATED BY DEFAULT AS IDENTITY' ELSE '' END,
+		a.attnum
+	FROM pg_attribute a
+	JOIN pg_class c ON c.oid = a.attrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+	LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+	WHERE a.attnum > 0 AND NOT a.attisdropped AND c.relkind IN ('r', 'p') AND NOT c.relispartition
+		AND ` + userObjects + ` AND ` + notFromExtension("c.oid"),
+
+	KindConstraint: `SELECT n.nspname, c.relname, k.conname, pg_get_constraintdef(k.oid), 0
+	FROM pg_constraint k JOIN pg_class c ON c.oid = k.conrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE k.contype IN ('p', 'u', 'f', 'c', 'x') AND k.conparentid = 0 AND NOT c.relispartition
+		AND ` + userObjects + ` AND ` + notFromExtension("c.oid"),
+
+	KindIndex: `SELECT n.nspname, c.relname, i.relname, pg_get_indexdef(i.oid), 0
+	FROM pg_index x JOIN pg_class i ON i.oid = x.indexrelid
+	JOIN pg_class c ON c.oid = x.indrelid JOIN pg_namespace n ON n.oid = i.relnamespace
+	WHERE c.relkind IN ('r', 'p', 'm') AND NOT c.relispartition
+		AND NOT EXISTS (SELECT 1 FROM pg_constraint k WHERE k.conindid = x.indexrelid AND k.contype IN ('p', 'u', 'x'))
+		AND ` + userObjects + ` AND ` + notFromExtension("c.oid"),
+
+	KindFunction: `SELECT n.nspname, '', p.proname || '(' || pg_get_function_identity_arguments(p.oid) || ')',
+		pg_get_functiondef(p.oid), 0
+	FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+	WHERE p.prokind IN ('f', 'p') AND ` + userObjects + ` AND ` + notFromExtension("p.oid"),
+
+	KindView: `SELECT n.nspname, '', c.relname,
+		CASE c.relkind WHEN 'm' THEN 'MATERIALIZED ' ELSE '' END || 'VIEW AS ' || pg_get_viewdef(c.oid, true), 0
+	FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE c.relkind IN ('v', 'm') AND ` + userObjects + ` AND ` + notFromExtension("c.oid"),
+
+	KindTrigger: `SELECT n.nspname, c.relname, t.tgname, pg_get_triggerdef(t.oid), 0
+	FROM pg_trigger t JOIN pg_class c ON c.oid = t.tgrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE NOT t.tgisinternal AND ` + userObjects + ` AND ` + notFromExtension("c.oid"),
+
+	KindPolicy: `SELECT n.nspname, c.relname, p.polname,
+		'AS ' || CASE WHEN p.polpermissive THEN 'PERMISSIVE' ELSE 'RESTRICTIVE' END
+		|| ' FOR ' || CASE p.polcmd WHEN 'r' THEN 'SELECT' WHEN 'a' THEN 'INSERT' WHEN 'w' THEN 'UPDATE' WHEN 'd' THEN 'DELETE' ELSE 'ALL' END
+		|| ' TO ' || CASE WHEN p.polroles = '{0}' THEN 'PUBLIC'
+			ELSE (SELECT string_agg(quote_ident(r.rolname), ', ' ORDER BY r.rolname) FROM pg_roles r WHERE r.oid = ANY (p.polroles)) END
+		|| COALESCE(' USING (' || pg_get_expr(p.polqual, p.polrelid) || ')', '')
+		|| COALESCE(' WITH CHECK (' || pg_get_expr(p.polwithcheck, p.polrelid) || ')', ''), 0
+	FROM pg_policy p JOIN pg_class c ON c.oid = p.polrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE ` + userObjects + ` AND ` + notFromExtension("c.oid"),
+
+	// Names describe the object, since they span several catalogs
+	KindOther: `SELECT n.nspname, '', 'aggregate ' || quote_ident(n.nspname) || '.' || p.proname
+			|| '(' || pg_get_function_identity_arguments(p.oid) || ')', pg_get_function_result(p.oid), 0
+		FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE p.prokind IN ('a', 'w') AND ` + userObjects + ` AND ` + notFromExtension("p.oid") + `
+	UNION ALL
+	SELECT n.nspname, '', 'range type ' || quote_ident(n.nspname) || '.' || t.typname,
+			'SUBTYPE = ' || format_type(r.rngsubtype, NULL), 0
+		FROM pg_range r JOIN pg_type t ON t.oid = r.rngtypid JOIN pg_namespace n ON n.oid = t.typnamespace
+		WHERE ` + userObjects + ` AND ` + notFromExtension("t.oid") + `
+	UNION ALL
+	SELECT n.nspname, c.relname, 'rule ' || r.rulename || ' on ' || quote_ident(n.nspname) || '.' || c.relname,
+			pg_get_ruledef(r.oid), 0
+		FROM pg_rewrite r JOIN pg_class c ON c.oid = r.ev_class JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE r.rulename <> '_RETURN' AND ` + userObjects + ` AND ` + notFromExtension("c.oid") + `
+	UNION ALL
+	SELECT n.nspname, c.relname, 'row level security on ' || quote_ident(n.nspname) || '.' || c.relname,
+			CASE WHEN c.relforcerowsecurity THEN 'ENABLE, FORCE' ELSE 'ENABLE' END, 0
+		FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relrowsecurity AND ` + userObjects + ` AND ` + notFromExtension("c.oid") + `
+	UNION ALL
+	SELECT n.nspname, '', 'foreign table ' || quote_ident(n.nspname) || '.' || c.relname, '', 0
+		FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind = 'f' AND ` + userObjects + ` AND ` + notFromExtension("c.oid") + `
+	UNION ALL
+	SELECT n.nspname, '', 'collation ' || quote_ident(n.nspname) || '.' || c.collname, '', 0
+		FROM pg_collation c JOIN pg_namespace n ON n.oid = c.collnamespace
+		WHERE ` + userObjects + ` AND ` + notFromExtension("c.oid") + `
+	UNION ALL
+	SELECT n.nspname, '', 'operator ' || quote_ident(n.nspname) || '.' || o.oprname
+			|| '(' || format_type(o.oprleft, NULL) || ', ' || format_type(o.oprright, NULL) || ')', '', 0
+		FROM pg_operator o JOIN pg_namespace n ON n.oid = o.oprnamespace
+		WHERE ` + userObjects + ` AND ` + notFromExtension("o.oid") + `
+	UNION ALL
+	SELECT n.nspname, '', 'text search configuration ' || quote_ident(n.nspname) || '.' || c.cfgname, '', 0
+		FROM pg_ts_config c JOIN pg_namespace n ON n.oid = c.cfgnamespace
+		WHERE ` + userObjects + ` AND ` + notFromExtension("c.oid"),
+}
+
+// Inspect reads the schema of the database. Tables listed in exclude (in the
+// public schema) are left out together with their columns, indexes,
+// constraints and triggers.
+func (i *Inspector) Inspect(ctx context.Context, dbURL string, exclude []string) (Schema, error) {
+	excluded := make(map[string]bool, len(exclude))
+	for _, table := range exclude {
+		excluded[table] = true
+	}
+
+	s := make(Schema)
+	for _, kind := range kindOrder {
+		result, err := i.exec.Query(ctx, dbURL, catalogQueries[kind])
+		if err != nil {
+			return nil, fmt.Errorf("reading %ss: %w", kind, err)
+		}
+
+		for _, row := range result.Rows {
+			o := Object{
+				Kind:       kind,
+				Schema:     row[0].String,
+				Table:      row[1].String,
+				Name:       row[2].String,
+				Definition: strings.TrimSpace(row[3].String),
+			}
+			o.Position, _ = strconv.Atoi(row[4].String)
+
+			table := o.Table
+			if kind == KindTable {
+				table = o.Name
+			}
+			if o.Schema == "public" && excluded[table] {
+				continue
+			}
+			s[o.key()] = o
+		}
+	}
+	return s, nil
+}
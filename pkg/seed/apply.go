@@ -3,46 +3,58 @@ package seed
 import (
 	"bytes"
 	"context"
+	"encoding/csv"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+
+	"github.com/tmwinc/seedup/pkg/events"
 )
 
 // Apply seeds the database with data from CSV files
 // It runs the initial migration, loads seed data, then runs remaining migrations
 func (s *Seeder) Apply(ctx context.Context, dbURL, migrationsDir, seedDir string) error {
+	ctx, unlock, err := s.migrator.Lock(ctx, dbURL)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	log := events.FromContext(ctx)
+
 	// Run the initial migration (schema at point of creating seed)
 	// Use UpByOneAllowNoop to handle the case where migrations are already applied
-	fmt.Println("Running initial migration (if pending)...")
-	if err := s.migrator.UpByOneAllowNoop(ctx, dbURL, migrationsDir); err != nil {
+	step := log.Start("migrate-initial", "Running initial migration (if pending)...").Database(dbURL)
+	if err := step.End(s.migrator.UpByOneAllowNoop(ctx, dbURL, migrationsDir)); err != nil {
 		return fmt.Errorf("running initial migration: %w", err)
 	}
 
 	// Build and execute the seed script
-	fmt.Println("Seeding database...")
-	if err := s.loadSeedData(ctx, dbURL, seedDir); err != nil {
+	step = log.Start("load-seed", "Seeding database...").Database(dbURL)
+	if err := step.End(s.loadSeedData(ctx, dbURL, seedDir, step)); err != nil {
 		return fmt.Errorf("loading seed data: %w", err)
 	}
 
 	// Run all remaining migrations
-	fmt.Println("Running remaining migrations...")
-	if err := s.migrator.Up(ctx, dbURL, migrationsDir); err != nil {
+	step = log.Start("migrate", "Running remaining migrations...").Database(dbURL)
+	if err := step.End(s.migrator.Up(ctx, dbURL, migrationsDir)); err != nil {
 		return fmt.Errorf("running remaining migrations: %w", err)
 	}
 
 	return nil
 }
 
-func (s *Seeder) loadSeedData(ctx context.Context, dbURL, seedDir string) error {
+func (s *Seeder) loadSeedData(ctx context.Context, dbURL, seedDir string, step *events.Step) error {
 	csvFiles, err := filepath.Glob(filepath.Join(seedDir, "*.csv"))
 	if err != nil {
 		return fmt.Errorf("finding CSV files: %w", err)
 	}
 
 	if len(csvFiles) == 0 {
-		fmt.Println("No CSV files found in seed directory")
+		events.FromContext(ctx).Info("load-seed", "No CSV files found in seed directory")
 		return nil
 	}
 
@@ -63,7 +75,8 @@ func (s *Seeder) loadSeedData(ctx context.Context, dbURL, seedDir string) error
 
 	var script bytes.Buffer
 
-	// Begin transaction
+	// Load everything in one transaction: if the run is interrupted the
+	// session ends and PostgreSQL rolls back, leaving the tables untouched
 	script.WriteString("BEGIN;\n")
 
 	// Truncate all tables in reverse order (respects FK constraints)
@@ -96,7 +109,45 @@ func (s *Seeder) loadSeedData(ctx context.Context, dbURL, seedDir string) error
 	}
 	tmpFile.Close()
 
-	return s.exec.RunSQLFile(ctx, dbURL, tmpFile.Name())
+	if err := s.exec.RunSQLFile(ctx, dbURL, tmpFile.Name()); err != nil {
+		return err
+	}
+
+	// Report the rows loaded from each file
+	for _, table := range orderedTables {
+		rows, err := countCSVRows(csvByTable[table])
+		if err != nil {
+			return fmt.Errorf("counting rows in %s: %w", csvByTable[table], err)
+		}
+		step.AddRows(rows)
+		step.AddFiles(csvByTable[table])
+	}
+
+	return nil
+}
+
+// countCSVRows returns the number of data records in a CSV file with a header
+func countCSVRows(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+
+	var n int64
+	for {
+		if _, err := r.Read(); err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return max(n-1, 0), nil
 }
 
 // getImportOrder returns tables sorted by foreign key dependencies
@@ -119,7 +170,7 @@ func (s *Seeder) getImportOrder(ctx context.Context, dbURL string, tables []stri
 		WHERE tc.constraint_type = 'FOREIGN KEY'
 	`
 
-	output, err := s.exec.RunSQL(ctx, dbURL, query)
+	fkRows, err := s.exec.Query(ctx, dbURL, query)
 	if err != nil {
 		// If we can't get dependencies, just return tables in original order
 		return tables, nil
@@ -131,15 +182,9 @@ func (s *Seeder) getImportOrder(ctx context.Context, dbURL string, tables []stri
 		deps[table] = nil
 	}
 
-	// Parse the output (format: "dependent | referenced" per line)
-	lines := strings.Split(strings.TrimSpace(output), "\n")
-	for _, line := range lines {
-		parts := strings.Split(line, "|")
-		if len(parts) != 2 {
-			continue
-		}
-		dependent := strings.TrimSpace(parts[0])
-		referenced := strings.TrimSpace(parts[1])
+	for _, row := range fkRows.Rows {
+		dependent := row[0].String
+		referenced := row[1].String
 
 		// Only consider dependencies between tables we're importing
 		if _, ok := deps[dependent]; ok {
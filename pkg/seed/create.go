@@ -8,22 +8,17 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/tmwinc/seedup/pkg/events"
+	"github.com/tmwinc/seedup/pkg/executor"
 	"github.com/tmwinc/seedup/pkg/migrate"
 )
 
 // CreateOptions configures the seed creation process
-type CreateOptions struct {
-	DryRun bool
-}
+type CreateOptions struct{}
 
 // Create creates seed data from a database
 // It dumps the schema, flattens migrations, and exports seed data to CSV files
 func (s *Seeder) Create(ctx context.Context, dbURL, migrationsDir, seedDir, queryFile string, opts CreateOptions) error {
-	// Ensure seed directory exists
-	if err := os.MkdirAll(seedDir, 0755); err != nil {
-		return fmt.Errorf("creating seed directory: %w", err)
-	}
-
 	// Get all tables in the database
 	tables, err := s.getTables(ctx, dbURL)
 	if err != nil {
@@ -37,25 +32,40 @@ func (s *Seeder) Create(ctx context.Context, dbURL, migrationsDir, seedDir, quer
 	}
 	defer os.RemoveAll(tempDir)
 
-	if err := s.extractSeedData(ctx, dbURL, tables, queryFile, tempDir); err != nil {
-		return fmt.Errorf("extracting seed data: %w", err)
-	}
+	log := events.FromContext(ctx)
 
-	if opts.DryRun {
-		fmt.Println("Dry run mode - not modifying any files")
-		return nil
+	step := log.Start("extract-seed", "").Database(dbURL)
+	if err := step.End(s.extractSeedData(ctx, dbURL, tables, queryFile, tempDir)); err != nil {
+		return fmt.Errorf("extracting seed data: %w", err)
 	}
 
-	// Flatten migrations
+	// Flatten migrations. Once Flatten has changed files, the CSV swap below
+	// runs without checking ctx so an interrupt cannot leave flattened
+	// migrations next to seed data from the previous schema.
 	flattener := migrate.NewFlattener(s.exec)
 	if err := flattener.Flatten(ctx, dbURL, migrationsDir); err != nil {
 		return fmt.Errorf("flattening migrations: %w", err)
 	}
 
 	// Clean old CSV files and move new ones
+	step = log.Start("write-seed", "")
+	return step.End(s.replaceSeedFiles(tempDir, seedDir, step))
+}
+
+// replaceSeedFiles replaces the CSV files in seedDir with those in tempDir.
+// In plan mode the extraction did not run, so tempDir is empty; the plan
+// notes the replacement rather than listing every CSV as removed.
+func (s *Seeder) replaceSeedFiles(tempDir, seedDir string, step *events.Step) error {
+	if noter, ok := s.exec.(executor.Noter); ok {
+		noter.Note(fmt.Sprintf("replace %s with the extracted files", filepath.Join(seedDir, "*.csv")))
+		return nil
+	}
+
 	oldCSVs, _ := filepath.Glob(filepath.Join(seedDir, "*.csv"))
 	for _, csv := range oldCSVs {
-		os.Remove(csv)
+		if err := s.exec.Remove(csv); err != nil {
+			return fmt.Errorf("removing %s: %w", csv, err)
+		}
 	}
 
 	newCSVs, _ := filepath.Glob(filepath.Join(tempDir, "*.csv"))
@@ -65,9 +75,15 @@ func (s *Seeder) Create(ctx context.Context, dbURL, migrationsDir, seedDir, quer
 		if err != nil {
 			return fmt.Errorf("reading %s: %w", csv, err)
 		}
-		if err := os.WriteFile(dest, data, 0644); err != nil {
+		if err := s.exec.WriteFile(dest, data); err != nil {
 			return fmt.Errorf("writing %s: %w", dest, err)
 		}
+		rows, err := countCSVRows(csv)
+		if err != nil {
+			return fmt.Errorf("counting rows in %s: %w", csv, err)
+		}
+		step.AddRows(rows)
+		step.AddFiles(dest)
 	}
 
 	return nil
@@ -79,31 +95,29 @@ type tableInfo struct {
 }
 
 func (s *Seeder) getTables(ctx context.Context, dbURL string) ([]tableInfo, error) {
-	output, err := s.exec.RunSQL(ctx, dbURL, `
+	// Skip the tables seedup uses to track migrations
+	excluded := make([]string, len(migrate.BookkeepingTables))
+	for i, table := range migrate.BookkeepingTables {
+		excluded[i] = "'" + table + "'"
+	}
+
+	result, err := s.exec.Query(ctx, dbURL, fmt.Sprintf(`
 		SELECT schemaname, tablename
 		FROM pg_catalog.pg_tables
 		WHERE schemaname NOT IN ('information_schema', 'pg_catalog')
-		AND schemaname NOT LIKE 'pg_temp%'
-		AND tablename <> 'goose_db_version'
+		AND schemaname NOT LIKE 'pg_temp%%'
+		AND NOT (schemaname = 'public' AND tablename IN (%s))
 		ORDER BY schemaname, tablename
-	`)
+	`, strings.Join(excluded, ", ")))
 	if err != nil {
 		return nil, err
 	}
 
 	var tables []tableInfo
-	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		parts := strings.Split(line, "|")
-		if len(parts) != 2 {
-			continue
-		}
+	for _, row := range result.Rows {
 		tables = append(tables, tableInfo{
-			Schema: strings.TrimSpace(parts[0]),
-			Name:   strings.TrimSpace(parts[1]),
+			Schema: row[0].String,
+			Name:   row[1].String,
 		})
 	}
 
@@ -125,7 +139,8 @@ func (s *Seeder) extractSeedData(ctx context.Context, dbURL string, tables []tab
 		queryContent, err := os.ReadFile(queryFile)
 		if err != nil {
 			if os.IsNotExist(err) {
-				fmt.Printf("Warning: seed query file '%s' not found, proceeding without custom queries\n", queryFile)
+				events.FromContext(ctx).Info("extract-seed",
+					fmt.Sprintf("Warning: seed query file '%s' not found, proceeding without custom queries", queryFile))
 			} else {
 				return fmt.Errorf("reading query file: %w", err)
 			}
@@ -0,0 +1,2 @@
+INSERT INTO pg_temp."seed.public.users" SELECT * FROM users WHERE email LIKE '%@example.com';
+INSERT INTO pg_temp."seed.public.posts" SELECT p.* FROM posts p JOIN pg_temp."seed.public.users" u ON u.id = p.user_id;
@@ -0,0 +1,50 @@
+// Package seedup runs the seedup command line. Projects with Go migrations
+// build their own binary around Main so the migrations are compiled in:
+//
+//	package main
+//
+//	import (
+//		"github.com/tmwinc/seedup"
+//		"example.com/project/migrations"
+//	)
+//
+//	func main() {
+//		seedup.Main(migrations.Registry)
+//	}
+package seedup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/tmwinc/seedup/internal/cli"
+	"github.com/tmwinc/seedup/pkg/executor"
+	"github.com/tmwinc/seedup/pkg/migrate"
+)
+
+// Main runs the seedup command line with the Go migrations of registry,
+// which may be nil. It exits with a non-zero status if the command fails.
+func Main(registry *migrate.Registry) {
+	// The first SIGINT/SIGTERM cancels the running command so it can stop its
+	// child processes and clean up; a second one terminates immediately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := cli.Execute(migrate.WithRegistry(ctx, registry))
+	interrupted := ctx.Err() != nil
+	stop()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, executor.Redact(err.Error()))
+		if interrupted {
+			os.Exit(130)
+		}
+		os.Exit(1)
+	}
+}